@@ -1,22 +1,111 @@
 package config
 
 import (
+	"encoding"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
 	"github.com/BurntSushi/toml"
 	log "github.com/Sirupsen/logrus"
 	"github.com/juju/errors"
 )
 
-// Config is the application-wide config
+// envPrefix prefixes the environment variables that override config fields.
+const envPrefix = "TRANSCRIBE_"
+
+const (
+	// pathEnv names the environment variable holding the path of the config
+	// file read at startup.
+	pathEnv = envPrefix + "CONFIG"
+	// defaultPath is the config file read when pathEnv is unset.
+	defaultPath = "config.toml"
+)
+
+// Config is the application-wide config. Code that may run while it is
+// replaced by SetConfig, such as a transcription job, reads it with GetConfig.
 var Config AppConfig
 
+// configMutex guards Config for GetConfig and SetConfig.
+var configMutex sync.RWMutex
+
+// GetConfig returns a copy of Config. The copy is not affected by later calls
+// to SetConfig, so settings that belong together, such as a username and
+// password, should be read from the same copy. Its slices and maps are shared
+// with Config and must not be modified.
+func GetConfig() AppConfig {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return Config
+}
+
+// SetConfig validates config and replaces Config with it, such as to rotate
+// credentials without restarting. Jobs already running keep the settings
+// they started with where they hold a copy.
+func SetConfig(config AppConfig) error {
+	if err := config.Validate(); err != nil {
+		return errors.Trace(err)
+	}
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	Config = config
+	return nil
+}
+
+// init loads the config file. If the default file is missing, such as when
+// tests run in a clean checkout, Config is left empty.
 func init() {
-	err := parseConfigFile(&Config, "config.toml")
+	path := os.Getenv(pathEnv)
+	if len(path) == 0 {
+		path = defaultPath
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			log.Warnf("%s not found, so the config is empty (set %s to read another file)", path, pathEnv)
+			return
+		}
+	}
+	config, err := LoadConfig(path)
 	if err != nil {
 		log.Fatal(err)
 	}
+	Config = *config
 	log.Infof("%+v", Config)
 }
 
+// LoadConfig reads a JSON or TOML config file, depending on its extension, and
+// applies environment variable overrides before validating the result. Each
+// field can be overridden by an environment variable named after it, e.g.
+// TRANSCRIBE_IBM_USERNAME overrides IBMUsername.
+func LoadConfig(path string) (*AppConfig, error) {
+	config := new(AppConfig)
+	if filepath.Ext(path) == ".json" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		defer file.Close()
+		if err := json.NewDecoder(file).Decode(config); err != nil {
+			return nil, errors.Annotatef(err, "could not parse %s", path)
+		}
+	} else if err := parseConfigFile(config, path); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err := applyEnvOverrides(config); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return config, nil
+}
+
 // parseConfigFile parses the specified file into a given struct
 func parseConfigFile(config *AppConfig, filename string) error {
 	if _, err := toml.DecodeFile(filename, config); err != nil {
@@ -25,19 +114,275 @@ func parseConfigFile(config *AppConfig, filename string) error {
 	return nil
 }
 
+// applyEnvOverrides sets every field of config that has a matching environment
+// variable.
+func applyEnvOverrides(config *AppConfig) error {
+	v := reflect.ValueOf(config).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := envPrefix + envName(t.Field(i).Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return errors.Annotatef(err, "invalid value for %s", name)
+		}
+	}
+	return nil
+}
+
+// envWords are the words in field names whose case does not mark where they
+// start and end, such as the second F of FFmpeg.
+var envWords = []string{"FFmpeg"}
+
+// envName converts a field name such as IBMUsername to IBM_USERNAME.
+func envName(fieldName string) string {
+	runes := []rune(fieldName)
+	var name []rune
+	for i := 0; i < len(runes); i++ {
+		if word := envWordAt(runes, i); len(word) > 0 {
+			if i > 0 {
+				name = append(name, '_')
+			}
+			name = append(name, []rune(strings.ToUpper(word))...)
+			i += len([]rune(word)) - 1
+			continue
+		}
+		r := runes[i]
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				name = append(name, '_')
+			}
+		}
+		name = append(name, unicode.ToUpper(r))
+	}
+	return string(name)
+}
+
+// envWordAt returns the word of envWords that starts at runes[i], if any.
+func envWordAt(runes []rune, i int) string {
+	for _, word := range envWords {
+		if strings.HasPrefix(string(runes[i:]), word) {
+			return word
+		}
+	}
+	return ""
+}
+
+// Duration is a time.Duration that is written as a string such as "1h30m" in
+// config files and environment variables.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	d.Duration = duration
+	return nil
+}
+
+// setField parses value into the given field.
+func setField(field reflect.Value, value string) error {
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return errors.Trace(unmarshaler.UnmarshalText([]byte(value)))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return errors.Errorf("unsupported type %s", field.Type())
+		}
+		field.Set(reflect.ValueOf(strings.Split(value, ",")))
+	case reflect.Map:
+		// Maps are written as key=value pairs separated by commas.
+		if field.Type() != reflect.TypeOf(map[string]string{}) {
+			return errors.Errorf("unsupported type %s", field.Type())
+		}
+		m := make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return errors.Errorf("expected key=value, got %q", pair)
+			}
+			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		field.Set(reflect.ValueOf(m))
+	default:
+		return errors.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate checks that every enabled feature has the fields it requires.
+func (c *AppConfig) Validate() error {
+	missing := []string{}
+	require := func(enabled bool, fields map[string]bool) {
+		if !enabled {
+			return
+		}
+		for name, ok := range fields {
+			if !ok {
+				missing = append(missing, name)
+			}
+		}
+	}
+
+	require(len(c.BackblazeAccountID) > 0, map[string]bool{
+		"BackblazeApplicationKey": len(c.BackblazeApplicationKey) > 0,
+		"BackblazeBucket":         len(c.BackblazeBucket) > 0,
+	})
+	require(len(c.AzureConnectionString) > 0, map[string]bool{
+		"AzureContainer": len(c.AzureContainer) > 0,
+	})
+	require(len(c.EmailUsername) > 0, map[string]bool{
+		"EmailPassword":   len(c.EmailPassword) > 0,
+		"EmailSMTPServer": len(c.EmailSMTPServer) > 0,
+		"EmailPort":       c.EmailPort > 0,
+	})
+	require(len(c.FTPUsername) > 0 || len(c.SFTPKeyFile) > 0, map[string]bool{
+		"FTPHost": len(c.FTPHost) > 0,
+	})
+	require(c.CacheTranscriptions && len(c.MongoURL) == 0, map[string]bool{
+		"CacheDir": len(c.CacheDir) > 0,
+	})
+	require(len(c.IBMUsername) > 0, map[string]bool{
+		"IBMPassword": len(c.IBMPassword) > 0,
+	})
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.Errorf("config is missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 // AppConfig contains the app config variables.
 type AppConfig struct {
-	BackblazeAccountID      string
-	BackblazeApplicationKey string
-	BackblazeBucket         string
-	Debug                   bool
-	EmailUsername           string
-	EmailPassword           string
-	EmailSMTPServer         string
-	EmailPort               int
-	IBMUsername             string
-	IBMPassword             string
-	MongoURL                string
-	Port                    int
-	SecretKey               string
+	AlertWords                  []string
+	AudioChannels               string
+	AzureConnectionString       string
+	AzureContainer              string
+	AzureSASExpiry              Duration
+	BackblazeAccountID          string
+	BackblazeApplicationKey     string
+	BackblazeBucket             string
+	BackblazeCreateBucket       bool
+	BackblazeLargeFileThreshold int64
+	BackblazePrivateBucket      bool
+	CACertFile                  string
+	CacheDir                    string
+	CacheTranscriptions         bool
+	CheckAudioURL               bool
+	ChunkOverlapSeconds         int
+	ChunkPauseSeconds           float64
+	ChunkPauseSeparator         string
+	ChunkRetries                int
+	Debug                       bool
+	Denoise                     bool
+	DenoiseFilter               string
+	DetectSilence               bool
+	DetectSilentChannels        bool
+	EmailUsername               string
+	EmailPassword               string
+	EmailSMTPServer             string
+	EmailPort                   int
+	EmailArchiveBCC             string
+	EmailCC                     []string
+	EmailFailureBody            string
+	EmailFailureSubject         string
+	EmailFailureThrottle        Duration
+	EmailSuccessBody            string
+	EmailSuccessSubject         string
+	FFmpegInputOptions          []string
+	FFmpegRetries               int
+	FFmpegWorkers               int
+	FTPHost                     string
+	FTPPassword                 string
+	FTPUsername                 string
+	FailedJobRetries            int
+	HTTPProxy                   string
+	HashTranscriptions          bool
+	IBMBurst                    int
+	IBMFallbackConfidence       float64
+	IBMFallbackModel            string
+	IBMInactivityTimeout        Duration
+	IBMMaxConcurrent            int
+	IBMModel                    string
+	IBMNarrowbandModel          string
+	IBMParams                   map[string]string
+	IBMUsername                 string
+	IBMPassword                 string
+	IBMRequestsPerSecond        float64
+	IBMTimeout                  Duration
+	InterpolateWordTimes        bool
+	KeywordMaxDistance          int
+	KeywordStemming             bool
+	LowConfidenceReplacement    string
+	LowConfidenceThreshold      float64
+	MaxChunkBytes               int64
+	MaxConcurrentTasks          int
+	MaxDownloadBytes            int64
+	MinAudioSeconds             float64
+	MinWordConfidence           float64
+	MongoChunkUpdates           bool
+	MongoConnectTimeout         Duration
+	MongoFallbackDir            string
+	MongoPoolLimit              int
+	MongoRetries                int
+	MongoSocketTimeout          Duration
+	MongoURL                    string
+	NormalizeAudio              bool
+	NormalizeTranscript         bool
+	OutputDir                   string
+	OutputSRT                   bool
+	OutputVTT                   bool
+	OverwriteConvertedAudio     bool
+	PadShortAudio               bool
+	Port                        int
+	RawIBMResponseDir           string
+	RawTranscript               bool
+	RecordChunkBoundaries       bool
+	RequireFFmpeg               bool
+	RichVTT                     bool
+	SaveRawIBMResponses         bool
+	SecretKey                   string
+	SelfTestAudioPath           string
+	SelfTestWords               []string
+	SFTPKeyFile                 string
+	ShutdownTimeout             Duration
+	SlackWebhookURL             string
+	SplitOnChapters             bool
+	SpoolResults                bool
+	TempDir                     string
+	TempFileMode                string
+	WebhookRetries              int
+	WebhookSecret               string
+	WebhookURL                  string
 }
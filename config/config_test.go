@@ -0,0 +1,128 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfigFile writes contents to a file called name in a new temporary
+// directory, and returns its path and a function removing it.
+func writeConfigFile(t *testing.T, name, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+// setEnv sets the environment variable key to value and returns a function
+// unsetting it.
+func setEnv(key, value string) func() {
+	os.Setenv(key, value)
+	return func() { os.Unsetenv(key) }
+}
+
+func TestEnvName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("PORT", envName("Port"))
+	assert.Equal("IBM_USERNAME", envName("IBMUsername"))
+	assert.Equal("EMAIL_SMTP_SERVER", envName("EmailSMTPServer"))
+	assert.Equal("CA_CERT_FILE", envName("CACertFile"))
+	assert.Equal("RAW_IBM_RESPONSE_DIR", envName("RawIBMResponseDir"))
+	assert.Equal("FFMPEG_WORKERS", envName("FFmpegWorkers"))
+	assert.Equal("REQUIRE_FFMPEG", envName("RequireFFmpeg"))
+}
+
+func TestLoadConfig(t *testing.T) {
+	assert := assert.New(t)
+	path, remove := writeConfigFile(t, "config.toml", `
+Port = 8080
+IBMTimeout = "90s"
+AlertWords = ["fire", "flood"]
+`)
+	defer remove()
+
+	config, err := LoadConfig(path)
+	assert.NoError(err)
+	assert.Equal(8080, config.Port)
+	assert.Equal(90*time.Second, config.IBMTimeout.Duration)
+	assert.Equal([]string{"fire", "flood"}, config.AlertWords)
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	assert := assert.New(t)
+	path, remove := writeConfigFile(t, "config.json", `{"Port": 8080, "IBMTimeout": "90s"}`)
+	defer remove()
+
+	config, err := LoadConfig(path)
+	assert.NoError(err)
+	assert.Equal(8080, config.Port)
+	assert.Equal(90*time.Second, config.IBMTimeout.Duration)
+
+	path, remove = writeConfigFile(t, "config.json", `{"Port": "8080"}`)
+	defer remove()
+	_, err = LoadConfig(path)
+	assert.Error(err)
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	assert := assert.New(t)
+	path, remove := writeConfigFile(t, "config.toml", "Port = 8080\nFFmpegWorkers = 2\n")
+	defer remove()
+	defer setEnv("TRANSCRIBE_PORT", "9090")()
+	defer setEnv("TRANSCRIBE_FFMPEG_WORKERS", "4")()
+	defer setEnv("TRANSCRIBE_IBM_PARAMS", "customization_id=abc, audio_metrics=true")()
+	defer setEnv("TRANSCRIBE_ALERT_WORDS", "fire,flood")()
+	defer setEnv("TRANSCRIBE_MONGO_SOCKET_TIMEOUT", "1m")()
+
+	config, err := LoadConfig(path)
+	assert.NoError(err)
+	assert.Equal(9090, config.Port)
+	assert.Equal(4, config.FFmpegWorkers)
+	assert.Equal(map[string]string{"customization_id": "abc", "audio_metrics": "true"}, config.IBMParams)
+	assert.Equal([]string{"fire", "flood"}, config.AlertWords)
+	assert.Equal(time.Minute, config.MongoSocketTimeout.Duration)
+
+	defer setEnv("TRANSCRIBE_PORT", "eighty")()
+	_, err = LoadConfig(path)
+	assert.Error(err)
+}
+
+func TestLoadConfigValidates(t *testing.T) {
+	assert := assert.New(t)
+	path, remove := writeConfigFile(t, "config.toml", `IBMUsername = "user"`)
+	defer remove()
+
+	_, err := LoadConfig(path)
+	assert.EqualError(err, "config is missing required fields: IBMPassword")
+
+	defer setEnv("TRANSCRIBE_IBM_PASSWORD", "secret")()
+	_, err = LoadConfig(path)
+	assert.NoError(err)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError((&AppConfig{}).Validate())
+
+	config := &AppConfig{BackblazeAccountID: "id", EmailUsername: "me", FTPUsername: "ftp"}
+	assert.EqualError(config.Validate(), "config is missing required fields: "+
+		"BackblazeApplicationKey, BackblazeBucket, EmailPassword, EmailPort, EmailSMTPServer, FTPHost")
+
+	config = &AppConfig{SFTPKeyFile: "id_rsa", FTPHost: "ftp.example.com", AzureConnectionString: "conn", AzureContainer: "audio"}
+	assert.NoError(config.Validate())
+
+	config = &AppConfig{CacheTranscriptions: true}
+	assert.EqualError(config.Validate(), "config is missing required fields: CacheDir")
+	config.MongoURL = "mongodb://localhost"
+	assert.NoError(config.Validate())
+}
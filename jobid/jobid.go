@@ -0,0 +1,44 @@
+// Package jobid generates the ids of transcription jobs. It has no
+// dependencies within the project, so that both the task executer and the
+// transcription pipeline can use it.
+package jobid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// alphabet is Crockford's base32, whose characters sort in the same order as
+// the values they encode.
+const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// New returns a new unique job id in the ULID format: 26 characters encoding
+// the current time in milliseconds followed by 80 random bits. Ids sort by
+// the time they were generated, and are safe to generate from many goroutines
+// and processes at once.
+func New() string {
+	return At(time.Now())
+}
+
+// At is New for an id generated at t.
+func At(t time.Time) string {
+	var id [16]byte
+	millis := uint64(t.UnixNano() / 1e6)
+	binary.BigEndian.PutUint64(id[:8], millis<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		// crypto/rand does not fail on supported platforms.
+		panic(err)
+	}
+
+	// The 128 bits are written 5 at a time, after 2 padding bits.
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	encoded := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		encoded[i] = alphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(encoded)
+}
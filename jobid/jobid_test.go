@@ -0,0 +1,37 @@
+package jobid
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAt(t *testing.T) {
+	assert := assert.New(t)
+	earlier := At(time.Unix(1500000000, 0))
+	assert.Len(earlier, 26)
+	assert.Equal("01BMZFF600", earlier[:10])
+	assert.True(At(time.Unix(1500000000, 1e6)) > earlier)
+}
+
+func TestNewIsUnique(t *testing.T) {
+	assert := assert.New(t)
+	ids := make(chan string, 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids <- New()
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	seen := make(map[string]bool)
+	for id := range ids {
+		assert.False(seen[id], "duplicate id %s", id)
+		seen[id] = true
+	}
+}
@@ -2,19 +2,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof" // import for side effects
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/dzhang55/go-torch/config"
+	"github.com/dzhang55/go-torch/transcription"
 	"github.com/dzhang55/go-torch/web"
 )
 
+// defaultShutdownTimeout leaves time to exit within the 30 second grace
+// period Kubernetes gives before killing a pod.
+const defaultShutdownTimeout = 25 * time.Second
+
 func init() {
 	log.SetOutput(os.Stderr)
-	if config.Config.Debug {
+	if config.GetConfig().Debug {
 		log.SetLevel(log.DebugLevel)
 	} else {
 		log.SetLevel(log.InfoLevel)
@@ -22,6 +31,19 @@ func init() {
 }
 
 func main() {
+	cfg := config.GetConfig()
+	if err := transcription.CheckFFmpeg(); err != nil {
+		if cfg.RequireFFmpeg {
+			log.Fatal(err)
+		}
+		log.Error(err)
+	}
+	if len(cfg.IBMUsername) > 0 {
+		if err := transcription.VerifyIBMCredentials(cfg.IBMUsername, cfg.IBMPassword); err != nil {
+			log.Errorf("Could not verify IBM credentials: %v", err)
+		}
+	}
+
 	router := web.NewRouter()
 	middlewareRouter := web.ApplyMiddleware(router)
 
@@ -29,9 +51,40 @@ func main() {
 	http.Handle("/", middlewareRouter)
 	http.Handle("/static/", http.FileServer(http.Dir(".")))
 
-	log.Infof("Server is running at http://localhost:%d", config.Config.Port)
-	addr := fmt.Sprintf(":%d", config.Config.Port)
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	log.Infof("Server is running at http://localhost:%d", cfg.Port)
+	server := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Port)}
+	done := make(chan struct{})
+	go shutdownOnSignal(server, done)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Error(err)
+		return
+	}
+	// ListenAndServe returns as soon as shutdown starts, so wait for the
+	// running transcriptions to finish before exiting.
+	<-done
+}
+
+// shutdownOnSignal waits for SIGTERM or SIGINT, then stops the server and lets
+// the running transcriptions finish, cancelling them if they take longer than
+// config.Config.ShutdownTimeout. It closes done once they have.
+func shutdownOnSignal(server *http.Server, done chan<- struct{}) {
+	defer close(done)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	log.Infof("Received %v, shutting down", sig)
+
+	timeout := config.GetConfig().ShutdownTimeout.Duration
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := transcription.Shutdown(ctx); err != nil {
+		log.Errorf("Cancelled running transcriptions: %v", err)
+	}
+	if err := server.Shutdown(ctx); err != nil {
 		log.Error(err)
 	}
 }
@@ -0,0 +1,116 @@
+package tasks
+
+import (
+	"container/heap"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// Priority orders the tasks waiting for a worker slot.
+type Priority int
+
+// These are some enumerated Priority constants.
+// LOW: Batch tasks that can wait, such as nightly runs.
+// NORMAL: The default.
+// HIGH: Interactive tasks that someone is waiting for.
+const (
+	LOW Priority = iota
+	NORMAL
+	HIGH
+)
+
+// ParsePriority returns the Priority named s, which is "low", "normal" or
+// "high" in any case. An empty s is NORMAL.
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(s) {
+	case "low":
+		return LOW, nil
+	case "", "normal":
+		return NORMAL, nil
+	case "high":
+		return HIGH, nil
+	}
+	return NORMAL, errors.NotValidf("priority %q", s)
+}
+
+// slotWaiter is a task waiting for a worker slot.
+type slotWaiter struct {
+	priority Priority
+	// seq orders waiters of the same priority by arrival.
+	seq   uint64
+	ready chan struct{}
+}
+
+// waiterHeap is a heap of waiters with the highest priority, and then the
+// earliest arrival, first.
+type waiterHeap []*slotWaiter
+
+func (h waiterHeap) Len() int { return len(h) }
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h waiterHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *waiterHeap) Push(x interface{}) { *h = append(*h, x.(*slotWaiter)) }
+func (h *waiterHeap) Pop() interface{} {
+	old := *h
+	waiter := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return waiter
+}
+
+// slotQueue limits the number of tasks running at once. Tasks that have to
+// wait are given the next free slot in order of priority, so that a high
+// priority task only waits for running tasks, not queued ones.
+type slotQueue struct {
+	mu      sync.Mutex
+	active  int
+	seq     uint64
+	waiting waiterHeap
+	// maxActive returns the number of slots, or nil for
+	// config.Config.MaxConcurrentTasks.
+	maxActive func() int
+}
+
+// limit returns the number of slots, which is unlimited if zero or less.
+func (q *slotQueue) limit() int {
+	if q.maxActive != nil {
+		return q.maxActive()
+	}
+	return config.GetConfig().MaxConcurrentTasks
+}
+
+// acquire waits for a free slot for a task of the given priority.
+func (q *slotQueue) acquire(priority Priority) {
+	limit := q.limit()
+	q.mu.Lock()
+	if limit <= 0 || (q.active < limit && len(q.waiting) == 0) {
+		q.active++
+		q.mu.Unlock()
+		return
+	}
+	waiter := &slotWaiter{priority: priority, seq: q.seq, ready: make(chan struct{})}
+	q.seq++
+	heap.Push(&q.waiting, waiter)
+	q.mu.Unlock()
+	<-waiter.ready
+}
+
+// release frees the slot of a finished task and gives the free slots to the
+// waiting tasks with the highest priority.
+func (q *slotQueue) release() {
+	limit := q.limit()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active--
+	for len(q.waiting) > 0 && (limit <= 0 || q.active < limit) {
+		close(heap.Pop(&q.waiting).(*slotWaiter).ready)
+		q.active++
+	}
+}
@@ -0,0 +1,58 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlotQueueRunsHigherPriorityFirst(t *testing.T) {
+	assert := assert.New(t)
+	q := &slotQueue{maxActive: func() int { return 1 }}
+	q.acquire(NORMAL)
+
+	order := make(chan Priority, 3)
+	for i, priority := range []Priority{LOW, NORMAL, HIGH} {
+		go func(priority Priority) {
+			q.acquire(priority)
+			order <- priority
+			q.release()
+		}(priority)
+		// Wait for the task to be queued, so that they arrive in order.
+		for queued(q) <= i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	q.release()
+	assert.Equal(HIGH, <-order)
+	assert.Equal(NORMAL, <-order)
+	assert.Equal(LOW, <-order)
+}
+
+func TestSlotQueueWithoutLimit(t *testing.T) {
+	q := &slotQueue{maxActive: func() int { return 0 }}
+	for i := 0; i < 10; i++ {
+		q.acquire(LOW)
+	}
+	assert.Equal(t, 10, q.active)
+}
+
+// queued returns the number of tasks waiting in q.
+func queued(q *slotQueue) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiting)
+}
+
+func TestParsePriority(t *testing.T) {
+	assert := assert.New(t)
+	for s, expected := range map[string]Priority{"": NORMAL, "low": LOW, "Normal": NORMAL, "HIGH": HIGH} {
+		priority, err := ParsePriority(s)
+		assert.NoError(err)
+		assert.Equal(expected, priority)
+	}
+	_, err := ParsePriority("urgent")
+	assert.Error(err)
+}
@@ -2,13 +2,14 @@
 package tasks
 
 import (
-	"math/rand"
 	"runtime/debug"
 	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/jobid"
 )
 
 // Status is the status of the task.
@@ -17,8 +18,9 @@ type Status int
 // TaskExecuter executes a series of task functions.
 type TaskExecuter interface {
 	QueueTask(task func(string) error, onFailure func(string, string)) string
+	QueueTaskWithPriority(task func(string) error, onFailure func(string, string), priority Priority) string
 	GetTaskStatus(id string) Status
-	completeTask(id string, task func(string) error, onFailure func(string, string))
+	completeTask(id string, task func(string) error, onFailure func(string, string), priority Priority)
 }
 
 type taskInfo struct {
@@ -34,6 +36,7 @@ type concurrentTaskInfoMap struct {
 type defaultExecuter struct {
 	cMap       concurrentTaskInfoMap
 	expiration time.Duration
+	slots      slotQueue
 }
 
 // These are some enumerated Status constants.
@@ -108,14 +111,21 @@ func NewTaskExecuter(expiration time.Duration) TaskExecuter {
 // task panics, the panic will be caught. However, if the task launches another
 // goroutine which panics, the panic cannot be caught.
 func (ex *defaultExecuter) QueueTask(task func(string) error, onFailure func(string, string)) string {
-	id := generateID(20)
+	return ex.QueueTaskWithPriority(task, onFailure, NORMAL)
+}
+
+// QueueTaskWithPriority is like QueueTask, but when more than
+// config.Config.MaxConcurrentTasks tasks are queued, the task runs before
+// waiting tasks of a lower priority. The task is INPROGRESS while it waits.
+func (ex *defaultExecuter) QueueTaskWithPriority(task func(string) error, onFailure func(string, string), priority Priority) string {
+	id := jobid.New()
 	ex.cMap.put(id, taskInfo{
 		status:  INPROGRESS,
 		started: time.Now(),
 	})
 	log.WithField("task", id).
 		Info("Task started")
-	go ex.completeTask(id, task, onFailure)
+	go ex.completeTask(id, task, onFailure, priority)
 	return id
 }
 
@@ -127,7 +137,9 @@ func (ex *defaultExecuter) GetTaskStatus(id string) Status {
 	return NOTFOUND
 }
 
-func (ex *defaultExecuter) completeTask(id string, task func(string) error, onFailure func(string, string)) {
+func (ex *defaultExecuter) completeTask(id string, task func(string) error, onFailure func(string, string), priority Priority) {
+	ex.slots.acquire(priority)
+	defer ex.slots.release()
 	defer func() {
 		if r := recover(); r != nil {
 			log.WithField("task", id).
@@ -176,14 +188,3 @@ func (ex *defaultExecuter) deleteExpiredInfo() {
 		ex.cMap.Unlock()
 	}
 }
-
-// Borrowed from https://siongui.github.io/2015/04/13/go-generate-random-string/
-func generateID(strlen int) string {
-	rand.Seed(time.Now().UTC().UnixNano())
-	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	result := make([]byte, strlen)
-	for i := 0; i < strlen; i++ {
-		result[i] = chars[rand.Intn(len(chars))]
-	}
-	return string(result)
-}
@@ -0,0 +1,84 @@
+package transcription
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// Alert is an alert word recognized in a stream.
+type Alert struct {
+	Word       string  `json:"word"`
+	StartTime  float64 `json:"start_time"`
+	EndTime    float64 `json:"end_time"`
+	Confidence float64 `json:"confidence"`
+	// Transcript is the text of the result the word was recognized in.
+	Transcript string `json:"transcript"`
+}
+
+// WatchStreamWithIBM transcribes a stream like StreamWithIBM and calls onAlert
+// the moment one of alertWords is recognized, rather than when the stream
+// ends. The words are spotted by IBM, so they may be phrases. It returns the
+// transcription of the whole stream.
+func WatchStreamWithIBM(ctx context.Context, id string, r io.Reader, contentType string, alertWords []string, IBMUsername string, IBMPassword string, onAlert func(Alert)) (*Transcription, error) {
+	cfg := config.GetConfig()
+	builder := newTranscriptionBuilder(&cfg)
+	err := StreamWithIBM(ctx, id, r, contentType, alertWords, IBMUsername, IBMPassword, func(result *IBMResult) {
+		builder.add(result)
+		for _, alert := range alertsIn(result) {
+			onAlert(alert)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return builder.build(), nil
+}
+
+// MonitorStream watches a stream for config.Config.AlertWords with the
+// configured IBM credentials and sends every alert to the configured
+// notifiers, with emails going to emailAddresses. Alerts are sent in the
+// background so that a slow notifier does not hold up the stream.
+func MonitorStream(ctx context.Context, id string, r io.Reader, contentType string, emailAddresses []string) (*Transcription, error) {
+	cfg := config.GetConfig()
+	notifiers := configuredNotifiers(&cfg, emailAddresses)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	return WatchStreamWithIBM(ctx, id, r, contentType, cfg.AlertWords, cfg.IBMUsername, cfg.IBMPassword, func(alert Alert) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			notifyAll(notifiers, JobEvent{ID: id, Status: ALERTED, Alert: &alert})
+		}()
+	})
+}
+
+// alertsIn returns the keywords IBM spotted in result, in the order they were
+// spoken.
+func alertsIn(result *IBMResult) []Alert {
+	alerts := []Alert{}
+	for _, field := range result.Results {
+		transcript := ""
+		if len(field.Alternatives) > 0 {
+			transcript = field.Alternatives[0].Transcript
+		}
+		for _, matches := range field.KeywordMap {
+			for _, match := range matches {
+				alerts = append(alerts, Alert{
+					Word:       match.Word,
+					StartTime:  match.StartTime,
+					EndTime:    match.EndTime,
+					Confidence: match.Confidence,
+					Transcript: transcript,
+				})
+			}
+		}
+	}
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].StartTime < alerts[j].StartTime
+	})
+	return alerts
+}
@@ -0,0 +1,35 @@
+package transcription
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertsIn(t *testing.T) {
+	assert := assert.New(t)
+	result := &IBMResult{}
+	assert.NoError(json.Unmarshal([]byte(`{"results": [{
+		"alternatives": [{"transcript": "open the gate then close the door "}],
+		"keywords_result": {
+			"gate": [{"normalized_text": "gate", "start_time": 1.5, "end_time": 2, "confidence": 0.9}],
+			"open": [{"normalized_text": "open", "start_time": 0.5, "end_time": 1, "confidence": 0.8}]
+		}
+	}]}`), result))
+
+	assert.Equal([]Alert{
+		{"open", 0.5, 1, 0.8, "open the gate then close the door "},
+		{"gate", 1.5, 2, 0.9, "open the gate then close the door "},
+	}, alertsIn(result))
+}
+
+func TestAlertMessages(t *testing.T) {
+	assert := assert.New(t)
+	event := JobEvent{ID: "feed", Status: ALERTED, Alert: &Alert{Word: "gate", StartTime: 61.5, Transcript: "open the gate "}}
+
+	assert.Equal("Alert: \"gate\" heard at 00:01:01,500 in feed\n> open the gate", slackMessage(event))
+	subject, body := alertEmail(event)
+	assert.Equal(`Alert: "gate" heard in feed`, subject)
+	assert.Equal("\"gate\" was heard at 00:01:01,500 in feed:\n\nopen the gate\n", body)
+}
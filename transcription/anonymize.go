@@ -0,0 +1,94 @@
+package transcription
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultPIIPatterns match email addresses, US phone numbers and social
+// security numbers.
+var DefaultPIIPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	regexp.MustCompile(`\b(?:\+?1[ .-]?)?\(?\d{3}\)?[ .-]?\d{3}[ .-]?\d{4}\b`),
+	regexp.MustCompile(`\b\d{3}[ -]?\d{2}[ -]?\d{4}\b`),
+}
+
+// Anonymize replaces every match of patterns in the transcript with
+// replacement. Each run of timestamped words that is part of a match, such as
+// the three words of "555 123 4567", is replaced by a single replacement word
+// spanning their times, with the lowest of their confidences, so that the
+// transcript still has a word for every timestamp. If the transcript is not
+// made of the timestamped words, each of the words is replaced instead.
+func (t *Transcription) Anonymize(patterns []*regexp.Regexp, replacement string) {
+	words := make([]string, len(t.Timestamps))
+	for i, ts := range t.Timestamps {
+		words[i] = ts.Word
+	}
+	text := strings.Join(words, " ")
+	aligned := len(words) > 0 && strings.Join(strings.Fields(t.Transcript), " ") == text
+	if !aligned {
+		for _, pattern := range patterns {
+			t.Transcript = pattern.ReplaceAllLiteralString(t.Transcript, replacement)
+		}
+	}
+
+	// Match against the timestamped words joined by spaces, so that matches
+	// spanning several words, such as "555 123 4567", are found.
+	starts := make([]int, len(words))
+	offset := 0
+	for i, word := range words {
+		starts[i] = offset
+		offset += len(word) + 1
+	}
+	masked := make([]bool, len(words))
+	for _, pattern := range patterns {
+		for _, match := range pattern.FindAllStringIndex(text, -1) {
+			for i := range words {
+				if starts[i] < match[1] && starts[i]+len(words[i]) > match[0] {
+					masked[i] = true
+				}
+			}
+		}
+	}
+
+	hasConfidences := len(t.Confidences) == len(t.Timestamps)
+	timestamps := []timestamp{}
+	confidences := []confidence{}
+	for i, word := range t.Timestamps {
+		if !masked[i] {
+			timestamps = append(timestamps, word)
+			if hasConfidences {
+				confidences = append(confidences, t.Confidences[i])
+			}
+			continue
+		}
+		if aligned && i > 0 && masked[i-1] {
+			// The word continues the run of the one before it.
+			last := len(timestamps) - 1
+			timestamps[last].EndTime = word.EndTime
+			if hasConfidences && t.Confidences[i].Score < confidences[last].Score {
+				confidences[last].Score = t.Confidences[i].Score
+			}
+			continue
+		}
+		timestamps = append(timestamps, timestamp{replacement, word.StartTime, word.EndTime})
+		if hasConfidences {
+			confidences = append(confidences, confidence{replacement, t.Confidences[i].Score})
+		}
+	}
+
+	if len(timestamps) != len(t.Timestamps) {
+		t.CueStarts = nil
+	}
+	t.Timestamps = timestamps
+	if hasConfidences {
+		t.Confidences = confidences
+	}
+	if aligned {
+		words = make([]string, len(timestamps))
+		for i, word := range timestamps {
+			words[i] = word.Word
+		}
+		t.Transcript = strings.Join(words, " ")
+	}
+}
@@ -0,0 +1,45 @@
+package transcription
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymize(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{
+		Transcript:  "call 555 123 4567 or email jane@example.com today",
+		Timestamps:  []timestamp{{"call", 0, 1}, {"555", 1, 2}, {"123", 2, 3}, {"4567", 3, 4}, {"or", 4, 5}, {"email", 5, 6}, {"jane@example.com", 6, 7}, {"today", 7, 8}},
+		Confidences: []confidence{{"call", 1}, {"555", 1}, {"123", 1}, {"4567", 1}, {"or", 1}, {"email", 1}, {"jane@example.com", 1}, {"today", 1}},
+	}
+
+	transcription.Anonymize(DefaultPIIPatterns, "[redacted]")
+	assert.Equal("call [redacted] or email [redacted] today", transcription.Transcript)
+	assert.Equal([]timestamp{{"call", 0, 1}, {"[redacted]", 1, 4}, {"or", 4, 5}, {"email", 5, 6}, {"[redacted]", 6, 7}, {"today", 7, 8}}, transcription.Timestamps)
+	assert.Len(transcription.Confidences, 6)
+	assert.Equal("[redacted]", transcription.Confidences[1].Word)
+	assert.Equal("today", transcription.Confidences[5].Word)
+	assert.NoError(transcription.Validate())
+}
+
+func TestAnonymizeSSN(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{Transcript: "my number is 123-45-6789"}
+
+	transcription.Anonymize([]*regexp.Regexp{DefaultPIIPatterns[2]}, "XXX")
+	assert.Equal("my number is XXX", transcription.Transcript)
+}
+
+func TestAnonymizeUnalignedTranscript(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{
+		Transcript: "Call 555-123-4567.",
+		Timestamps: []timestamp{{"call", 0, 1}, {"555", 1, 2}, {"123", 2, 3}, {"4567", 3, 4}},
+	}
+
+	transcription.Anonymize(DefaultPIIPatterns, "[redacted]")
+	assert.Equal("Call [redacted].", transcription.Transcript)
+	assert.Equal([]timestamp{{"call", 0, 1}, {"[redacted]", 1, 2}, {"[redacted]", 2, 3}, {"[redacted]", 3, 4}}, transcription.Timestamps)
+}
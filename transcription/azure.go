@@ -0,0 +1,202 @@
+package transcription
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+const (
+	// azureAPIVersion is the version of the Blob Storage REST API that is used.
+	azureAPIVersion = "2019-12-12"
+	// azureUploadTimeout is how long an upload may take, on top of the time
+	// it takes at azureMinUploadRate bytes a second.
+	azureUploadTimeout = time.Minute
+	azureMinUploadRate = 256 * 1024
+)
+
+// azureAccount holds the parts of an Azure Storage connection string.
+type azureAccount struct {
+	name     string
+	key      []byte
+	protocol string
+	suffix   string
+}
+
+// UploadFileToAzure uploads the given file to the given Azure Blob Storage
+// container and returns the blob URL. If config.Config.AzureSASExpiry is set,
+// the URL carries a read-only SAS token valid for that long, so that it works
+// for private containers.
+func UploadFileToAzure(filePath string, containerName string, connectionString string) (string, error) {
+	cfg := config.GetConfig()
+	account, err := parseAzureConnectionString(connectionString)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	name := filepath.Base(filePath)
+	blobURL := account.blobURL(containerName, name)
+	req, err := http.NewRequest("PUT", blobURL, file)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	req.ContentLength = stat.Size()
+	req.Header.Set("Content-Length", strconv.FormatInt(stat.Size(), 10))
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-date", now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("Authorization", "SharedKey "+account.name+":"+account.sign(sharedKeyStringToSign(account.name, req)))
+
+	client, err := apiClient(azureUploadTimeout + time.Duration(stat.Size()/azureMinUploadRate)*time.Second)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", errors.Errorf("could not upload %s to azure: %s", name, resp.Status)
+	}
+
+	if cfg.AzureSASExpiry.Duration > 0 {
+		return blobURL + "?" + account.blobSAS(containerName, name, cfg.AzureSASExpiry.Duration), nil
+	}
+	return blobURL, nil
+}
+
+// parseAzureConnectionString parses a connection string of the form
+// DefaultEndpointsProtocol=https;AccountName=...;AccountKey=...;EndpointSuffix=...
+func parseAzureConnectionString(connectionString string) (*azureAccount, error) {
+	account := &azureAccount{protocol: "https", suffix: "core.windows.net"}
+	for _, part := range strings.Split(connectionString, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "DefaultEndpointsProtocol":
+			account.protocol = kv[1]
+		case "AccountName":
+			account.name = kv[1]
+		case "AccountKey":
+			key, err := base64.StdEncoding.DecodeString(kv[1])
+			if err != nil {
+				return nil, errors.Annotate(err, "invalid azure account key")
+			}
+			account.key = key
+		case "EndpointSuffix":
+			account.suffix = kv[1]
+		}
+	}
+	if len(account.name) == 0 || len(account.key) == 0 {
+		return nil, errors.NotValidf("azure connection string without AccountName and AccountKey")
+	}
+	return account, nil
+}
+
+func (a *azureAccount) blobURL(container, blob string) string {
+	return a.protocol + "://" + a.name + ".blob." + a.suffix + "/" + container + "/" + url.PathEscape(blob)
+}
+
+// sign returns the base64 HMAC-SHA256 of s under the account key.
+func (a *azureAccount) sign(s string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(s))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// blobSAS returns a service SAS query string granting read access to a single
+// blob until expiry from now.
+func (a *azureAccount) blobSAS(container, blob string, expiry time.Duration) string {
+	expires := now().UTC().Add(expiry).Format("2006-01-02T15:04:05Z")
+	stringToSign := blobSASStringToSign(a.name, container, blob, expires)
+
+	query := url.Values{}
+	query.Set("sv", azureAPIVersion)
+	query.Set("sr", "b")
+	query.Set("sp", "r")
+	query.Set("se", expires)
+	query.Set("spr", "https")
+	query.Set("sig", a.sign(stringToSign))
+	return query.Encode()
+}
+
+// blobSASStringToSign builds the string signed for a read-only, HTTPS-only
+// service SAS of a blob that expires at expires.
+func blobSASStringToSign(accountName, container, blob, expires string) string {
+	resource := "/blob/" + accountName + "/" + container + "/" + blob
+	// permissions, start, expiry, resource, identifier, IP, protocol, version,
+	// resource type, snapshot time and five response header overrides
+	return strings.Join([]string{"r", "", expires, resource, "", "", "https", azureAPIVersion, "b", "", "", "", "", "", ""}, "\n")
+}
+
+// sharedKeyStringToSign builds the string signed for Shared Key authorization
+// of a Blob Storage request.
+func sharedKeyStringToSign(accountName string, req *http.Request) string {
+	contentLength := req.Header.Get("Content-Length")
+	if contentLength == "0" {
+		contentLength = ""
+	}
+	headers := []string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, superseded by x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	}
+
+	msHeaders := []string{}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower+":"+strings.TrimSpace(req.Header.Get(name)))
+		}
+	}
+	sort.Strings(msHeaders)
+
+	resource := "/" + accountName + req.URL.EscapedPath()
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		resource += "\n" + strings.ToLower(key) + ":" + strings.Join(values, ",")
+	}
+
+	return strings.Join(headers, "\n") + "\n" + strings.Join(msHeaders, "\n") + "\n" + resource
+}
@@ -0,0 +1,91 @@
+package transcription
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const azureConnectionString = "DefaultEndpointsProtocol=https;AccountName=archive;AccountKey=a2V5;EndpointSuffix=core.windows.net"
+
+// emulatorConnectionString is that of the account of the Azure Storage
+// emulator, whose key is published.
+const emulatorConnectionString = "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;AccountKey=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+func TestParseAzureConnectionString(t *testing.T) {
+	assert := assert.New(t)
+
+	account, err := parseAzureConnectionString(azureConnectionString)
+	assert.NoError(err)
+	assert.Equal("archive", account.name)
+	assert.Equal([]byte("key"), account.key)
+	assert.Equal("https://archive.blob.core.windows.net/audio/talk%201.mp3", account.blobURL("audio", "talk 1.mp3"))
+
+	_, err = parseAzureConnectionString("AccountName=archive")
+	assert.Error(err)
+}
+
+func TestAzureBlobSAS(t *testing.T) {
+	assert := assert.New(t)
+	defer freezeTime(time.Date(2016, 6, 1, 12, 0, 0, 0, time.UTC))()
+
+	account, _ := parseAzureConnectionString(azureConnectionString)
+	query, err := url.ParseQuery(account.blobSAS("audio", "talk.mp3", time.Hour))
+	assert.NoError(err)
+	assert.Equal("r", query.Get("sp"))
+	assert.Equal("b", query.Get("sr"))
+	assert.Equal("2016-06-01T13:00:00Z", query.Get("se"))
+	assert.NotEmpty(query.Get("sig"))
+}
+
+func TestAzureBlobSASSignature(t *testing.T) {
+	assert := assert.New(t)
+	defer freezeTime(time.Date(2016, 6, 1, 12, 0, 0, 0, time.UTC))()
+
+	// The fields of a service SAS for versions 2018-11-09 to 2020-10-02, as
+	// listed in Azure's "Create a service SAS" documentation.
+	assert.Equal("r\n\n2016-06-01T13:00:00Z\n/blob/devstoreaccount1/audio/talk.mp3\n\n\nhttps\n2019-12-12\nb\n\n\n\n\n\n",
+		blobSASStringToSign("devstoreaccount1", "audio", "talk.mp3", "2016-06-01T13:00:00Z"))
+
+	account, _ := parseAzureConnectionString(emulatorConnectionString)
+	query, err := url.ParseQuery(account.blobSAS("audio", "talk.mp3", time.Hour))
+	assert.NoError(err)
+	assert.Equal("EuCZ4QSQuQ1s9cFJQbdA/yESCM2AWkSmBF5I4ZiMxw8=", query.Get("sig"))
+}
+
+func TestSharedKeyStringToSign(t *testing.T) {
+	assert := assert.New(t)
+
+	// The container listing example of Azure's "Authorize with Shared Key"
+	// documentation, whose query parameters are sorted and the values of the
+	// repeated one joined.
+	req, _ := http.NewRequest("GET", "https://myaccount.blob.core.windows.net/mycontainer?restype=container&comp=list&include=snapshots&include=metadata&include=uncommittedblobs", nil)
+	req.Header.Set("x-ms-date", "Fri, 26 Jun 2015 23:39:12 GMT")
+	req.Header.Set("x-ms-version", "2015-02-21")
+	stringToSign := sharedKeyStringToSign("myaccount", req)
+	assert.Equal("GET\n\n\n\n\n\n\n\n\n\n\n\n"+
+		"x-ms-date:Fri, 26 Jun 2015 23:39:12 GMT\nx-ms-version:2015-02-21\n"+
+		"/myaccount/mycontainer\ncomp:list\ninclude:metadata,snapshots,uncommittedblobs\nrestype:container", stringToSign)
+
+	account, _ := parseAzureConnectionString(emulatorConnectionString)
+	assert.Equal("qthaFu+XRMRab2FfKeut5XZl1/nvdAhqiaOupMDoYWg=", account.sign(stringToSign))
+}
+
+func TestSharedKeyStringToSignOmitsZeroContentLength(t *testing.T) {
+	assert := assert.New(t)
+
+	// Since version 2015-02-21, a Content-Length of zero is signed as empty.
+	req, _ := http.NewRequest("PUT", "https://myaccount.blob.core.windows.net/audio/talk%201.mp3", nil)
+	req.Header.Set("Content-Length", "0")
+	req.Header.Set("Content-Type", "audio/mpeg")
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	assert.Equal("PUT\n\n\n\n\naudio/mpeg\n\n\n\n\n\n\nx-ms-blob-type:BlockBlob\n/myaccount/audio/talk%201.mp3",
+		sharedKeyStringToSign("myaccount", req))
+
+	req.Header.Set("Content-Length", "11")
+	assert.Equal("PUT\n\n\n11\n\naudio/mpeg\n\n\n\n\n\n\nx-ms-blob-type:BlockBlob\n/myaccount/audio/talk%201.mp3",
+		sharedKeyStringToSign("myaccount", req))
+}
@@ -0,0 +1,373 @@
+package transcription
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// b2AuthorizeURL is where B2 sessions start. Tests point it at a fake server.
+var b2AuthorizeURL = "https://api.backblazeb2.com/b2api/v1/b2_authorize_account"
+
+const (
+	// defaultBackblazeLargeFileThreshold is the file size above which
+	// UploadFileToBackblaze uses a large-file upload.
+	defaultBackblazeLargeFileThreshold = 200 * 1000 * 1000
+	// b2MinimumPartSize is the smallest part B2 accepts, other than the last.
+	b2MinimumPartSize       = 5 * 1000 * 1000
+	backblazePartAttempts   = 5
+	backblazePartRetryDelay = time.Second
+)
+
+// b2Session is an authorized connection to the B2 API. Its requests go
+// through apiClient, so they trust config.Config.CACertFile.
+type b2Session struct {
+	AccountID           string `json:"accountId"`
+	APIURL              string `json:"apiUrl"`
+	AuthorizationToken  string `json:"authorizationToken"`
+	DownloadURL         string `json:"downloadUrl"`
+	RecommendedPartSize int64  `json:"recommendedPartSize"`
+}
+
+// b2Bucket is a bucket of the account.
+type b2Bucket struct {
+	ID   string `json:"bucketId"`
+	Name string `json:"bucketName"`
+}
+
+// b2Part is a byte range of a large file, numbered from 1.
+type b2Part struct {
+	Number int
+	Offset int64
+	Size   int64
+}
+
+// backblazeLargeFileThreshold returns the large-file threshold of cfg.
+func backblazeLargeFileThreshold(cfg *config.AppConfig) int64 {
+	if cfg.BackblazeLargeFileThreshold > 0 {
+		return cfg.BackblazeLargeFileThreshold
+	}
+	return defaultBackblazeLargeFileThreshold
+}
+
+// uploadLargeFile uploads file to the bucket in parts, retrying
+// each part on failure. If an unfinished upload of the same name is already
+// in the bucket, the parts it has are kept and only the rest are sent, so an
+// upload that was interrupted resumes where it stopped. The metadata is
+// stored as the file info of a new upload. If the upload fails anyway, it is
+// cancelled so that its parts are not left in the bucket.
+func (s *b2Session) uploadLargeFile(file *os.File, size int64, name, bucketID string, metadata map[string]string) error {
+	fileID, uploaded, err := s.findUnfinishedLargeFile(bucketID, name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if fileID == "" {
+		var started struct {
+			FileID string `json:"fileId"`
+		}
+		request := map[string]interface{}{
+			"bucketId":    bucketID,
+			"fileName":    name,
+			"contentType": "b2/x-auto",
+		}
+		if len(metadata) > 0 {
+			request["fileInfo"] = metadata
+		}
+		err = s.call("b2_start_large_file", request, &started)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		fileID = started.FileID
+	} else {
+		log.Infof("Resuming backblaze upload of %s with %d parts already uploaded", name, len(uploaded))
+	}
+
+	if err := s.uploadParts(file, size, name, fileID, uploaded); err != nil {
+		if cancelErr := s.call("b2_cancel_large_file", map[string]string{"fileId": fileID}, nil); cancelErr != nil {
+			log.Warnf("Could not cancel the backblaze upload of %s: %v", name, cancelErr)
+		}
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// uploadParts uploads the parts of file that are not among those already
+// uploaded, keyed by part number, and finishes the large file.
+func (s *b2Session) uploadParts(file *os.File, size int64, name, fileID string, uploaded map[int]string) error {
+	parts := planB2Parts(size, s.RecommendedPartSize)
+	sha1s := make([]string, len(parts))
+	for i, part := range parts {
+		data := make([]byte, part.Size)
+		if _, err := file.ReadAt(data, part.Offset); err != nil && err != io.EOF {
+			return errors.Trace(err)
+		}
+		sum := sha1.Sum(data)
+		sha1s[i] = hex.EncodeToString(sum[:])
+		if uploaded[part.Number] == sha1s[i] {
+			continue
+		}
+		if err := s.uploadPartWithRetry(fileID, part.Number, data, sha1s[i]); err != nil {
+			return errors.Annotatef(err, "could not upload part %d of %s", part.Number, name)
+		}
+	}
+
+	return errors.Trace(s.call("b2_finish_large_file", map[string]interface{}{
+		"fileId":        fileID,
+		"partSha1Array": sha1s,
+	}, nil))
+}
+
+// backblazeFileName returns the name file is stored under: the SHA-256 of its
+// content followed by the extension of filePath. Downloaded files are named
+// uniquely, so the name must not come from filePath for an interrupted
+// upload of the same audio to be found and resumed.
+func backblazeFileName(file *os.File, filePath string) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, 0, math.MaxInt64)); err != nil {
+		return "", errors.Trace(err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)) + strings.ToLower(filepath.Ext(filePath)), nil
+}
+
+// planB2Parts divides size bytes into parts of partSize, which is raised to
+// the B2 minimum if needed.
+func planB2Parts(size int64, partSize int64) []b2Part {
+	if partSize < b2MinimumPartSize {
+		partSize = b2MinimumPartSize
+	}
+	parts := []b2Part{}
+	for offset := int64(0); offset < size; offset += partSize {
+		partLength := partSize
+		if size-offset < partLength {
+			partLength = size - offset
+		}
+		parts = append(parts, b2Part{Number: len(parts) + 1, Offset: offset, Size: partLength})
+	}
+	return parts
+}
+
+// authorizeB2 starts a new B2 API session.
+func authorizeB2(accountID, applicationKey string) (*b2Session, error) {
+	req, err := http.NewRequest("GET", b2AuthorizeURL, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	req.SetBasicAuth(accountID, applicationKey)
+
+	session := &b2Session{}
+	if err := doB2Request(req, session); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return session, nil
+}
+
+// findOrCreateBucket looks up the named bucket, creating it if it is missing
+// and cfg.BackblazeCreateBucket is set.
+func (s *b2Session) findOrCreateBucket(cfg *config.AppConfig, name string) (*b2Bucket, error) {
+	var buckets struct {
+		Buckets []b2Bucket `json:"buckets"`
+	}
+	err := s.call("b2_list_buckets", map[string]string{"accountId": s.AccountID}, &buckets)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, bucket := range buckets.Buckets {
+		if bucket.Name == name {
+			return &bucket, nil
+		}
+	}
+	if !cfg.BackblazeCreateBucket {
+		return nil, errors.NotFoundf("backblaze bucket %s", name)
+	}
+
+	bucketType := "allPublic"
+	if cfg.BackblazePrivateBucket {
+		bucketType = "allPrivate"
+	}
+	bucket := &b2Bucket{}
+	err = s.call("b2_create_bucket", map[string]string{
+		"accountId":  s.AccountID,
+		"bucketName": name,
+		"bucketType": bucketType,
+	}, bucket)
+	if err != nil {
+		return nil, errors.Annotatef(err, "could not create backblaze bucket %s (does the application key have permission to create buckets?)", name)
+	}
+	log.Infof("Created %s backblaze bucket %s", bucketType, name)
+	return bucket, nil
+}
+
+// uploadFile uploads file to the bucket in a single request, storing
+// metadata as its file info.
+func (s *b2Session) uploadFile(file *os.File, size int64, name, bucketID string, metadata map[string]string) error {
+	hash := sha1.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, 0, size)); err != nil {
+		return errors.Trace(err)
+	}
+
+	var target struct {
+		UploadURL          string `json:"uploadUrl"`
+		AuthorizationToken string `json:"authorizationToken"`
+	}
+	if err := s.call("b2_get_upload_url", map[string]string{"bucketId": bucketID}, &target); err != nil {
+		return errors.Trace(err)
+	}
+
+	req, err := http.NewRequest("POST", target.UploadURL, io.NewSectionReader(file, 0, size))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Authorization", target.AuthorizationToken)
+	req.Header.Set("Content-Type", "b2/x-auto")
+	req.Header.Set("X-Bz-File-Name", url.QueryEscape(name))
+	req.Header.Set("X-Bz-Content-Sha1", hex.EncodeToString(hash.Sum(nil)))
+	for key, value := range metadata {
+		req.Header.Set("X-Bz-Info-"+url.QueryEscape(key), url.QueryEscape(value))
+	}
+	return errors.Trace(doB2Request(req, nil))
+}
+
+// fileURL returns the download URL of the named file in the bucket.
+func (s *b2Session) fileURL(bucketName, name string) string {
+	return s.DownloadURL + "/file/" + bucketName + "/" + name
+}
+
+// findUnfinishedLargeFile returns the ID of an unfinished large file with the
+// given name, along with the SHA1 of each part it has, keyed by part number.
+// The ID is empty if there is no such file.
+func (s *b2Session) findUnfinishedLargeFile(bucketID, name string) (string, map[int]string, error) {
+	var files struct {
+		Files []struct {
+			FileID   string `json:"fileId"`
+			FileName string `json:"fileName"`
+		} `json:"files"`
+	}
+	err := s.call("b2_list_unfinished_large_files", map[string]interface{}{
+		"bucketId":   bucketID,
+		"namePrefix": name,
+	}, &files)
+	if err != nil {
+		return "", nil, errors.Trace(err)
+	}
+
+	uploaded := make(map[int]string)
+	for _, file := range files.Files {
+		if file.FileName != name {
+			continue
+		}
+		var parts struct {
+			Parts []struct {
+				PartNumber  int    `json:"partNumber"`
+				ContentSha1 string `json:"contentSha1"`
+			} `json:"parts"`
+		}
+		err := s.call("b2_list_parts", map[string]interface{}{
+			"fileId":       file.FileID,
+			"maxPartCount": 1000,
+		}, &parts)
+		if err != nil {
+			return "", nil, errors.Trace(err)
+		}
+		for _, part := range parts.Parts {
+			uploaded[part.PartNumber] = part.ContentSha1
+		}
+		return file.FileID, uploaded, nil
+	}
+	return "", uploaded, nil
+}
+
+// uploadPartWithRetry uploads one part, backing off exponentially between
+// attempts. B2 asks for a new upload URL after every failure.
+func (s *b2Session) uploadPartWithRetry(fileID string, partNumber int, data []byte, sha1 string) error {
+	var err error
+	delay := backblazePartRetryDelay
+	for attempt := 1; attempt <= backblazePartAttempts; attempt++ {
+		if err = s.uploadPart(fileID, partNumber, data, sha1); err == nil {
+			return nil
+		}
+		if attempt == backblazePartAttempts {
+			break
+		}
+		log.Debugf("Backblaze part %d attempt %d failed, retrying in %v: %v", partNumber, attempt, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return errors.Trace(err)
+}
+
+func (s *b2Session) uploadPart(fileID string, partNumber int, data []byte, sha1 string) error {
+	var target struct {
+		UploadURL          string `json:"uploadUrl"`
+		AuthorizationToken string `json:"authorizationToken"`
+	}
+	if err := s.call("b2_get_upload_part_url", map[string]string{"fileId": fileID}, &target); err != nil {
+		return errors.Trace(err)
+	}
+
+	req, err := http.NewRequest("POST", target.UploadURL, bytes.NewReader(data))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Authorization", target.AuthorizationToken)
+	req.Header.Set("X-Bz-Part-Number", strconv.Itoa(partNumber))
+	req.Header.Set("X-Bz-Content-Sha1", sha1)
+	return errors.Trace(doB2Request(req, nil))
+}
+
+// call posts request as JSON to the named B2 API operation and decodes the
+// reply into response, if it is not nil.
+func (s *b2Session) call(operation string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req, err := http.NewRequest("POST", s.APIURL+"/b2api/v1/"+operation, bytes.NewReader(body))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Authorization", s.AuthorizationToken)
+	return errors.Annotate(doB2Request(req, response), operation)
+}
+
+func doB2Request(req *http.Request, response interface{}) error {
+	client, err := apiClient(0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var b2Err struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&b2Err)
+		return errors.Errorf("backblaze returned %s: %s %s", resp.Status, b2Err.Code, b2Err.Message)
+	}
+	if response == nil {
+		return nil
+	}
+	return errors.Trace(json.NewDecoder(resp.Body).Decode(response))
+}
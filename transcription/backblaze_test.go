@@ -0,0 +1,165 @@
+package transcription
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestPlanB2Parts(t *testing.T) {
+	assert := assert.New(t)
+
+	parts := planB2Parts(25*1000*1000, 10*1000*1000)
+	assert.Equal([]b2Part{
+		{1, 0, 10 * 1000 * 1000},
+		{2, 10 * 1000 * 1000, 10 * 1000 * 1000},
+		{3, 20 * 1000 * 1000, 5 * 1000 * 1000},
+	}, parts)
+}
+
+func TestPlanB2PartsRaisesSmallPartSize(t *testing.T) {
+	assert := assert.New(t)
+
+	parts := planB2Parts(12*1000*1000, 1000)
+	assert.Len(parts, 3)
+	assert.Equal(int64(b2MinimumPartSize), parts[0].Size)
+	assert.Equal(int64(2*1000*1000), parts[2].Size)
+}
+
+func TestBackblazeStorageSupportsMetadata(t *testing.T) {
+	var storage Storage = BackblazeStorage{}
+	_, ok := storage.(MetadataStorage)
+	assert.True(t, ok)
+}
+
+// riffName is the name a file containing RIFF is uploaded under.
+const riffName = "a40ff3d5900fb7698b8c865041347cb49eccedc8f93945f89629ad104aaecce4.wav"
+
+func TestUploadFileToBackblaze(t *testing.T) {
+	assert := assert.New(t)
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/b2api/v1/b2_authorize_account":
+			json.NewEncoder(w).Encode(map[string]string{
+				"accountId":          "account",
+				"apiUrl":             server.URL,
+				"authorizationToken": "token",
+				"downloadUrl":        server.URL,
+			})
+		case "/b2api/v1/b2_list_buckets":
+			json.NewEncoder(w).Encode(map[string][]b2Bucket{"buckets": {{"other", "other"}, {"id", "talks"}}})
+		case "/b2api/v1/b2_get_upload_url":
+			json.NewEncoder(w).Encode(map[string]string{"uploadUrl": server.URL + "/upload", "authorizationToken": "upload"})
+		case "/upload":
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Equal("RIFF", string(body))
+			assert.Equal("upload", r.Header.Get("Authorization"))
+			assert.Equal(riffName, r.Header.Get("X-Bz-File-Name"))
+			assert.Equal("6ca0a12c23f03719e0229fe85e34c98de7079397", r.Header.Get("X-Bz-Content-Sha1"))
+			assert.Equal("42", r.Header.Get("X-Bz-Info-Job"))
+			w.Write([]byte("{}"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(url string) { b2AuthorizeURL = url }(b2AuthorizeURL)
+	b2AuthorizeURL = server.URL + "/b2api/v1/b2_authorize_account"
+	caFile, err := ioutil.TempFile("", "ca")
+	assert.NoError(err)
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	caFile.Close()
+	defer func(file string) { config.Config.CACertFile = file }(config.Config.CACertFile)
+	config.Config.CACertFile = caFile.Name()
+
+	dir, err := ioutil.TempDir("", "b2")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	filePath := dir + "/talk.wav"
+	ioutil.WriteFile(filePath, []byte("RIFF"), 0600)
+
+	url, err := UploadFileToBackblazeWithMetadata(filePath, "account", "key", "talks", map[string]string{"Job": "42"})
+	assert.NoError(err)
+	assert.Equal(server.URL+"/file/talks/"+riffName, url)
+}
+
+func TestUploadFileToBackblazeMissingBucket(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/b2api/v1/b2_authorize_account":
+			json.NewEncoder(w).Encode(map[string]string{"accountId": "account", "apiUrl": server.URL})
+		case "/b2api/v1/b2_list_buckets":
+			w.Write([]byte(`{"buckets": []}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(url string) { b2AuthorizeURL = url }(b2AuthorizeURL)
+	b2AuthorizeURL = server.URL + "/b2api/v1/b2_authorize_account"
+	defer func(create bool) { config.Config.BackblazeCreateBucket = create }(config.Config.BackblazeCreateBucket)
+	config.Config.BackblazeCreateBucket = false
+
+	_, err := UploadFileToBackblaze("talk.wav", "account", "key", "talks")
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestUploadLargeFileToBackblazeCancelsFailedUpload(t *testing.T) {
+	assert := assert.New(t)
+	var server *httptest.Server
+	var cancelled string
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		switch r.URL.Path {
+		case "/b2api/v1/b2_authorize_account":
+			json.NewEncoder(w).Encode(map[string]string{"accountId": "account", "apiUrl": server.URL})
+		case "/b2api/v1/b2_list_buckets":
+			json.NewEncoder(w).Encode(map[string][]b2Bucket{"buckets": {{"id", "talks"}}})
+		case "/b2api/v1/b2_list_unfinished_large_files":
+			assert.Equal(riffName, request["namePrefix"])
+			w.Write([]byte(`{"files": []}`))
+		case "/b2api/v1/b2_start_large_file":
+			w.Write([]byte(`{"fileId": "large"}`))
+		case "/b2api/v1/b2_get_upload_part_url":
+			json.NewEncoder(w).Encode(map[string]string{"uploadUrl": server.URL + "/upload"})
+		case "/upload":
+			w.Write([]byte("{}"))
+		case "/b2api/v1/b2_finish_large_file":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code": "bad_request", "message": "no"}`))
+		case "/b2api/v1/b2_cancel_large_file":
+			cancelled, _ = request["fileId"].(string)
+			w.Write([]byte("{}"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(url string) { b2AuthorizeURL = url }(b2AuthorizeURL)
+	b2AuthorizeURL = server.URL + "/b2api/v1/b2_authorize_account"
+	defer func(threshold int64) { config.Config.BackblazeLargeFileThreshold = threshold }(config.Config.BackblazeLargeFileThreshold)
+	config.Config.BackblazeLargeFileThreshold = 1
+
+	dir, err := ioutil.TempDir("", "b2")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	filePath := dir + "/talk_1500000000.wav"
+	ioutil.WriteFile(filePath, []byte("RIFF"), 0600)
+
+	_, err = UploadFileToBackblaze(filePath, "account", "key", "talks")
+	assert.Error(err)
+	assert.Equal("large", cancelled)
+}
@@ -0,0 +1,227 @@
+package transcription
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// TranscriptionCache stores finished transcriptions by the content of their
+// audio, so that the same recording is only transcribed once.
+type TranscriptionCache interface {
+	// Get returns the transcription stored under key, or nil if there is none.
+	Get(key string) (*Transcription, error)
+	Put(key string, transcription *Transcription) error
+}
+
+// cacheKey returns the key of the transcription of the audio at filePath
+// searched for searchWords by engine with the settings of cfg. The key changes
+// with the search words, since the keywords IBM spots depend on them, and
+// with the settings that change the transcript; see cacheSettings.
+func cacheKey(cfg *config.AppConfig, engine Transcriber, filePath string, searchWords []string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", errors.Trace(err)
+	}
+	words := make([]string, len(searchWords))
+	for i, word := range searchWords {
+		words[i] = strings.ToLower(strings.TrimSpace(word))
+	}
+	sort.Strings(words)
+	for _, word := range words {
+		io.WriteString(hash, "\x00"+word)
+	}
+	settings, err := json.Marshal(newCacheSettings(cfg, engine))
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	hash.Write([]byte{0})
+	hash.Write(settings)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// cacheSettings are the settings that change the transcription of the same
+// audio, so that a cached transcription is not reused once they change. The
+// models are those ibmAudioSettings chooses between by sample rate.
+type cacheSettings struct {
+	Engine                   string
+	IBMModel                 string
+	IBMNarrowbandModel       string
+	IBMFallbackModel         string
+	IBMFallbackConfidence    float64
+	IBMParams                map[string]string
+	AudioChannels            string
+	Filters                  []string
+	MaxChunkBytes            int64
+	ChunkOverlapSeconds      int
+	ChunkPauseSeconds        float64
+	ChunkPauseSeparator      string
+	PadShortAudio            bool
+	SplitOnChapters          bool
+	RawTranscript            bool
+	InterpolateWordTimes     bool
+	KeywordMaxDistance       int
+	KeywordStemming          bool
+	MinWordConfidence        float64
+	LowConfidenceReplacement string
+	NormalizeTranscript      bool
+	HashTranscriptions       bool
+	DetectSilence            bool
+	RecordChunkBoundaries    bool
+}
+
+func newCacheSettings(cfg *config.AppConfig, engine Transcriber) cacheSettings {
+	narrowbandModel := cfg.IBMNarrowbandModel
+	if len(narrowbandModel) == 0 {
+		narrowbandModel = defaultIBMNarrowbandModel
+	}
+	return cacheSettings{
+		Engine:                   fmt.Sprintf("%T", engine),
+		IBMModel:                 ibmModel(cfg),
+		IBMNarrowbandModel:       narrowbandModel,
+		IBMFallbackModel:         cfg.IBMFallbackModel,
+		IBMFallbackConfidence:    cfg.IBMFallbackConfidence,
+		IBMParams:                cfg.IBMParams,
+		AudioChannels:            cfg.AudioChannels,
+		Filters:                  audioFilters(cfg),
+		MaxChunkBytes:            maxChunkBytes(cfg, engine),
+		ChunkOverlapSeconds:      chunkOverlap(cfg),
+		ChunkPauseSeconds:        cfg.ChunkPauseSeconds,
+		ChunkPauseSeparator:      cfg.ChunkPauseSeparator,
+		PadShortAudio:            cfg.PadShortAudio,
+		SplitOnChapters:          cfg.SplitOnChapters,
+		RawTranscript:            cfg.RawTranscript,
+		InterpolateWordTimes:     cfg.InterpolateWordTimes,
+		KeywordMaxDistance:       cfg.KeywordMaxDistance,
+		KeywordStemming:          cfg.KeywordStemming,
+		MinWordConfidence:        cfg.MinWordConfidence,
+		LowConfidenceReplacement: cfg.LowConfidenceReplacement,
+		NormalizeTranscript:      cfg.NormalizeTranscript,
+		HashTranscriptions:       cfg.HashTranscriptions,
+		DetectSilence:            cfg.DetectSilence,
+		RecordChunkBoundaries:    cfg.RecordChunkBoundaries,
+	}
+}
+
+// configuredCache returns the cache enabled by cfg.CacheTranscriptions: Mongo
+// if it is configured, otherwise files in cfg.CacheDir. It returns nil if
+// caching is disabled or there is nowhere to cache. There is no default
+// directory, since one shared in the temporary directory could be made by
+// another user beforehand.
+func configuredCache(cfg *config.AppConfig) TranscriptionCache {
+	if !cfg.CacheTranscriptions {
+		return nil
+	}
+	if len(cfg.MongoURL) > 0 {
+		return MongoCache{URL: cfg.MongoURL}
+	}
+	if len(cfg.CacheDir) == 0 {
+		return nil
+	}
+	return FileCache{Dir: cfg.CacheDir}
+}
+
+// MongoCache keeps cached transcriptions in the cache collection.
+type MongoCache struct {
+	URL string
+}
+
+type cachedTranscription struct {
+	Key           string `bson:"_id"`
+	Transcription *Transcription
+}
+
+// Get implements TranscriptionCache.
+func (c MongoCache) Get(key string) (*Transcription, error) {
+	var cached cachedTranscription
+	err := c.withCollection(func(collection *mgo.Collection) error {
+		return collection.FindId(key).One(&cached)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return cached.Transcription, nil
+}
+
+// Put implements TranscriptionCache.
+func (c MongoCache) Put(key string, transcription *Transcription) error {
+	return errors.Trace(c.withCollection(func(collection *mgo.Collection) error {
+		_, err := collection.UpsertId(key, cachedTranscription{Key: key, Transcription: transcription})
+		return err
+	}))
+}
+
+func (c MongoCache) withCollection(f func(*mgo.Collection) error) error {
+	return withMongoCollection(c.URL, "cache", f)
+}
+
+// FileCache keeps each cached transcription as a JSON file in Dir.
+type FileCache struct {
+	Dir string
+}
+
+// Get implements TranscriptionCache.
+func (c FileCache) Get(key string) (*Transcription, error) {
+	file, err := os.Open(c.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer file.Close()
+
+	transcription := &Transcription{}
+	if err := json.NewDecoder(file).Decode(transcription); err != nil {
+		return nil, errors.Annotatef(err, "could not read cached transcription %s", key)
+	}
+	return transcription, nil
+}
+
+// Put implements TranscriptionCache.
+func (c FileCache) Put(key string, transcription *Transcription) error {
+	if err := os.MkdirAll(c.Dir, jobDirMode); err != nil {
+		return errors.Trace(err)
+	}
+	// Write to a temporary file first so that a concurrent Get never sees a
+	// partial transcription.
+	tempPath := c.path(key) + ".tmp"
+	file, err := createTempFile(tempPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = json.NewEncoder(file).Encode(transcription)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(tempPath, c.path(key)))
+}
+
+func (c FileCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
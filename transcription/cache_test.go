@@ -0,0 +1,66 @@
+package transcription
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestCacheKey(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.wav")
+	b := filepath.Join(dir, "b.mp3")
+	assert.NoError(ioutil.WriteFile(a, []byte("same audio"), 0600))
+	assert.NoError(ioutil.WriteFile(b, []byte("same audio"), 0600))
+
+	keyA, err := cacheKey(&config.AppConfig{}, nil, a, []string{"Foo", "bar"})
+	assert.NoError(err)
+	keyB, err := cacheKey(&config.AppConfig{}, nil, b, []string{"bar", "foo"})
+	assert.NoError(err)
+	assert.Equal(keyA, keyB)
+
+	keyC, err := cacheKey(&config.AppConfig{}, nil, b, []string{"bar"})
+	assert.NoError(err)
+	assert.NotEqual(keyA, keyC)
+
+	keyD, err := cacheKey(&config.AppConfig{IBMModel: "en-GB_BroadbandModel"}, nil, b, []string{"bar", "foo"})
+	assert.NoError(err)
+	assert.NotEqual(keyB, keyD)
+	keyE, err := cacheKey(&config.AppConfig{IBMParams: map[string]string{"smart_formatting": "true"}}, nil, b, []string{"bar", "foo"})
+	assert.NoError(err)
+	assert.NotEqual(keyB, keyE)
+	keyF, err := cacheKey(&config.AppConfig{}, &FakeTranscriber{}, b, []string{"bar", "foo"})
+	assert.NoError(err)
+	assert.NotEqual(keyB, keyF)
+}
+
+func TestConfiguredCacheRequiresDir(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(configuredCache(&config.AppConfig{CacheTranscriptions: true}))
+	assert.Equal(FileCache{Dir: "cache"}, configuredCache(&config.AppConfig{CacheTranscriptions: true, CacheDir: "cache"}))
+}
+
+func TestFileCache(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	cache := FileCache{Dir: filepath.Join(dir, "nested")}
+
+	cached, err := cache.Get("key")
+	assert.NoError(err)
+	assert.Nil(cached)
+
+	assert.NoError(cache.Put("key", &Transcription{Transcript: "hello"}))
+	cached, err = cache.Get("key")
+	assert.NoError(err)
+	assert.Equal("hello", cached.Transcript)
+}
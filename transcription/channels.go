@@ -0,0 +1,221 @@
+package transcription
+
+import (
+	"bufio"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// allChannels is the channel pass that mixes every channel down to mono.
+const allChannels = -1
+
+// channelPasses returns the channels to transcribe for the given
+// config.Config.AudioChannels setting and number of channels in the audio:
+//
+//	"" or "mix": all channels mixed down to mono, which is the default
+//	"left", "right" or a channel index: only that channel
+//	"split": every channel separately, such as one speaker per channel
+func channelPasses(setting string, channels int) ([]int, error) {
+	switch strings.ToLower(setting) {
+	case "", "mix":
+		return []int{allChannels}, nil
+	case "split":
+		if channels <= 1 {
+			return []int{allChannels}, nil
+		}
+		passes := make([]int, channels)
+		for i := range passes {
+			passes[i] = i
+		}
+		return passes, nil
+	case "left":
+		setting = "0"
+	case "right":
+		setting = "1"
+	}
+
+	channel, err := strconv.Atoi(setting)
+	if err != nil {
+		return nil, errors.Errorf("invalid audio channel setting %q", setting)
+	}
+	if channel < 0 || channel >= channels {
+		return nil, errors.Errorf("audio channel %d does not exist in audio with %d channel(s)", channel, channels)
+	}
+	return []int{channel}, nil
+}
+
+// mergeChannels interleaves the words of transcriptions of separate channels
+// of the same audio by time. The transcriptions are kept as the Channels of
+// the result.
+func mergeChannels(cfg *config.AppConfig, channels []*Transcription) *Transcription {
+	type channelWord struct {
+		timestamp  timestamp
+		confidence *confidence
+	}
+	words := []channelWord{}
+	keywords := []ibmKeywordResult{}
+	for _, channel := range channels {
+		for i, ts := range channel.Timestamps {
+			word := channelWord{timestamp: ts}
+			if len(channel.Confidences) == len(channel.Timestamps) {
+				word.confidence = &channel.Confidences[i]
+			}
+			words = append(words, word)
+		}
+		keywords = append(keywords, channel.IBMKeywords...)
+	}
+	sort.SliceStable(words, func(i, j int) bool {
+		return words[i].timestamp.StartTime < words[j].timestamp.StartTime
+	})
+
+	texts := make([]string, len(words))
+	timestamps := make([]timestamp, len(words))
+	confidences := []confidence{}
+	for i, word := range words {
+		texts[i] = word.timestamp.Word
+		timestamps[i] = word.timestamp
+		if word.confidence != nil {
+			confidences = append(confidences, *word.confidence)
+		}
+	}
+	merged := &Transcription{
+		Transcript:  strings.Join(texts, " "),
+		CompletedAt: now(),
+		Timestamps:  timestamps,
+		Confidences: confidences,
+		IBMKeywords: keywords,
+		Empty:       len(words) == 0,
+		// The channels are split at the same points.
+		ChunkBoundaries: channels[0].ChunkBoundaries,
+		Channels:        channels,
+	}
+	for _, channel := range channels {
+		merged.ApproximateTimestamps = merged.ApproximateTimestamps || channel.ApproximateTimestamps
+	}
+	merged.setAverageConfidence()
+	merged.setHash(cfg)
+	return merged
+}
+
+// silentChannelDB is the peak level below which a channel counts as silent,
+// which leaves room for line noise on an unused telephone channel.
+const silentChannelDB = -50.0
+
+// ChannelActivity is how loud a channel of the source audio is.
+type ChannelActivity struct {
+	Channel int
+	// PeakDB and RMSDB are the peak and RMS levels of the channel in dBFS.
+	// Digital silence is -math.MaxFloat64, since -Inf cannot be marshaled.
+	PeakDB float64
+	RMSDB  float64
+	Silent bool
+}
+
+// DetectChannelActivity measures the level of every channel of the first
+// audio track of filePath with ffmpeg's astats filter.
+func DetectChannelActivity(filePath string) ([]ChannelActivity, error) {
+	cfg := config.GetConfig()
+	return detectChannelActivity(&cfg, filePath)
+}
+
+// detectChannelActivity is DetectChannelActivity with the ffmpeg input options
+// of cfg.
+func detectChannelActivity(cfg *config.AppConfig, filePath string) ([]ChannelActivity, error) {
+	args := append(ffmpegInputArgs(cfg, filePath), "-map", "a:0", "-af", "astats=metadata=0", "-f", "null", "-")
+	out, err := runFFmpegOutput(args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return parseAstats(out), nil
+}
+
+// parseAstats reads the per channel levels that astats logs at the end of a
+// run, which look like:
+//
+//	[Parsed_astats_0 @ 0x7f] Channel: 1
+//	[Parsed_astats_0 @ 0x7f] Peak level dB: -3.010300
+//	[Parsed_astats_0 @ 0x7f] RMS level dB: -20.500000
+//	[Parsed_astats_0 @ 0x7f] Overall
+func parseAstats(out string) []ChannelActivity {
+	activity := []ChannelActivity{}
+	var current *ChannelActivity
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "] "); i >= 0 {
+			line = line[i+2:]
+		}
+		switch {
+		case strings.HasPrefix(line, "Channel: "):
+			channel, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Channel: ")))
+			if err != nil {
+				current = nil
+				continue
+			}
+			// astats numbers channels from 1.
+			activity = append(activity, ChannelActivity{Channel: channel - 1})
+			current = &activity[len(activity)-1]
+		case strings.HasPrefix(line, "Overall"):
+			current = nil
+		case current != nil && strings.HasPrefix(line, "Peak level dB: "):
+			current.PeakDB = astatsLevel(strings.TrimPrefix(line, "Peak level dB: "))
+		case current != nil && strings.HasPrefix(line, "RMS level dB: "):
+			current.RMSDB = astatsLevel(strings.TrimPrefix(line, "RMS level dB: "))
+		}
+	}
+	for i := range activity {
+		activity[i].Silent = activity[i].PeakDB < silentChannelDB
+	}
+	return activity
+}
+
+// astatsLevel parses a level in dB. Digital silence, which astats reports as
+// -inf, becomes -math.MaxFloat64.
+func astatsLevel(s string) float64 {
+	level, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsInf(level, -1) {
+		return -math.MaxFloat64
+	}
+	return level
+}
+
+// skipSilentChannels drops the silent channels from passes. Mixing every
+// channel becomes transcribing the only active one, if only one is. Passes
+// are left alone if every channel is silent, since there is no better choice.
+func skipSilentChannels(passes []int, activity []ChannelActivity) []int {
+	active := []int{}
+	silent := make(map[int]bool)
+	for _, channel := range activity {
+		if channel.Silent {
+			silent[channel.Channel] = true
+		} else {
+			active = append(active, channel.Channel)
+		}
+	}
+	if len(active) == 0 {
+		return passes
+	}
+	if len(passes) == 1 && passes[0] == allChannels {
+		if len(active) == 1 {
+			return active
+		}
+		return passes
+	}
+
+	kept := []int{}
+	for _, channel := range passes {
+		if !silent[channel] {
+			kept = append(kept, channel)
+		}
+	}
+	if len(kept) == 0 {
+		return passes
+	}
+	return kept
+}
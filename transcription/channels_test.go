@@ -0,0 +1,88 @@
+package transcription
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestChannelPasses(t *testing.T) {
+	assert := assert.New(t)
+
+	passes, err := channelPasses("", 2)
+	assert.NoError(err)
+	assert.Equal([]int{allChannels}, passes)
+
+	passes, err = channelPasses("split", 2)
+	assert.NoError(err)
+	assert.Equal([]int{0, 1}, passes)
+
+	passes, err = channelPasses("split", 1)
+	assert.NoError(err)
+	assert.Equal([]int{allChannels}, passes)
+
+	passes, err = channelPasses("Right", 2)
+	assert.NoError(err)
+	assert.Equal([]int{1}, passes)
+
+	_, err = channelPasses("right", 1)
+	assert.Error(err)
+	_, err = channelPasses("center", 2)
+	assert.Error(err)
+}
+
+func TestMergeChannels(t *testing.T) {
+	assert := assert.New(t)
+
+	agent := &Transcription{
+		Timestamps:  []timestamp{{"hello", 0, 0.5}, {"goodbye", 3, 3.5}},
+		Confidences: []confidence{{"hello", 0.9}, {"goodbye", 0.8}},
+	}
+	customer := &Transcription{
+		Timestamps:  []timestamp{{"hi", 1, 1.5}},
+		Confidences: []confidence{{"hi", 0.7}},
+	}
+
+	merged := mergeChannels(&config.AppConfig{}, []*Transcription{agent, customer})
+	assert.Equal("hello hi goodbye", merged.Transcript)
+	assert.Equal([]confidence{{"hello", 0.9}, {"hi", 0.7}, {"goodbye", 0.8}}, merged.Confidences)
+	assert.Equal([]*Transcription{agent, customer}, merged.Channels)
+	assert.False(merged.Empty)
+}
+
+const astatsOutput = `[Parsed_astats_0 @ 0x7f] Channel: 1
+[Parsed_astats_0 @ 0x7f] DC offset: 0.000012
+[Parsed_astats_0 @ 0x7f] Peak level dB: -3.010300
+[Parsed_astats_0 @ 0x7f] RMS level dB: -20.500000
+[Parsed_astats_0 @ 0x7f] Channel: 2
+[Parsed_astats_0 @ 0x7f] DC offset: 0.000000
+[Parsed_astats_0 @ 0x7f] Peak level dB: -inf
+[Parsed_astats_0 @ 0x7f] RMS level dB: -inf
+[Parsed_astats_0 @ 0x7f] Overall
+[Parsed_astats_0 @ 0x7f] Peak level dB: -3.010300
+`
+
+func TestParseAstats(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]ChannelActivity{
+		{Channel: 0, PeakDB: -3.0103, RMSDB: -20.5, Silent: false},
+		{Channel: 1, PeakDB: -math.MaxFloat64, RMSDB: -math.MaxFloat64, Silent: true},
+	}, parseAstats(astatsOutput))
+}
+
+func TestSkipSilentChannels(t *testing.T) {
+	assert := assert.New(t)
+	leftOnly := []ChannelActivity{{Channel: 0}, {Channel: 1, Silent: true}}
+	both := []ChannelActivity{{Channel: 0}, {Channel: 1}}
+	neither := []ChannelActivity{{Channel: 0, Silent: true}, {Channel: 1, Silent: true}}
+
+	assert.Equal([]int{0}, skipSilentChannels([]int{allChannels}, leftOnly))
+	assert.Equal([]int{allChannels}, skipSilentChannels([]int{allChannels}, both))
+	assert.Equal([]int{allChannels}, skipSilentChannels([]int{allChannels}, neither))
+	assert.Equal([]int{0}, skipSilentChannels([]int{0, 1}, leftOnly))
+	assert.Equal([]int{0, 1}, skipSilentChannels([]int{0, 1}, neither))
+	assert.Equal([]int{1}, skipSilentChannels([]int{1}, leftOnly))
+}
@@ -0,0 +1,137 @@
+package transcription
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// Chapter is a chapter marked in a media file, such as an audiobook or a
+// podcast episode, in seconds from its start.
+type Chapter struct {
+	Title     string
+	StartTime float64
+	EndTime   float64
+}
+
+type ffprobeChapter struct {
+	StartTime string            `json:"start_time"`
+	EndTime   string            `json:"end_time"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// probeChapters returns the chapters ffprobe found, skipping empty ones. A
+// chapter without a title tag has an empty title.
+func probeChapters(probe *ffprobeOutput) []Chapter {
+	chapters := []Chapter{}
+	for _, c := range probe.Chapters {
+		start, err := strconv.ParseFloat(c.StartTime, 64)
+		if err != nil {
+			continue
+		}
+		end, err := strconv.ParseFloat(c.EndTime, 64)
+		if err != nil || end <= start {
+			continue
+		}
+		chapter := Chapter{StartTime: start, EndTime: end}
+		for key, value := range c.Tags {
+			if strings.ToLower(key) == "title" {
+				chapter.Title = value
+			}
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters
+}
+
+// SplitWavFileOnChapters splits a file into one chunk per chapter marked in
+// it, and returns the paths of the chunks and the titles of their chapters.
+// A file without chapters is returned whole, as one chunk without a title.
+// Chapters are lost when audio is converted to wav, so filePath is usually the
+// original file, such as an .m4b audiobook, and the chunks are in its format.
+func SplitWavFileOnChapters(filePath string) ([]string, []string, error) {
+	info, err := ProbeAudio(filePath)
+	if err != nil {
+		return []string{}, []string{}, errors.Trace(err)
+	}
+	if len(info.Chapters) == 0 {
+		return []string{filePath}, []string{""}, nil
+	}
+	cfg := config.GetConfig()
+	names, _, err := splitOnChapters(&cfg, filePath, info.Chapters)
+	if err != nil {
+		return []string{}, []string{}, errors.Trace(err)
+	}
+	titles := make([]string, len(info.Chapters))
+	for i, chapter := range info.Chapters {
+		titles[i] = chapter.Title
+	}
+	return names, titles, nil
+}
+
+// splitOnChapters writes each of chapters of filePath to a chunk of its own,
+// and returns their paths and the part of the file each covers.
+func splitOnChapters(cfg *config.AppConfig, filePath string, chapters []Chapter) ([]string, []chunkSpan, error) {
+	spans := make([]chunkSpan, len(chapters))
+	for i, chapter := range chapters {
+		spans[i] = chunkSpan{Start: chapter.StartTime, End: chapter.EndTime}
+	}
+	names, err := extractSpans(cfg, filePath, spans)
+	if err != nil {
+		return []string{}, nil, errors.Trace(err)
+	}
+	return names, spans, nil
+}
+
+// chapterGapSeconds is the longest gap around chapters that is added to the
+// chapter next to it rather than transcribed as a chunk of its own.
+const chapterGapSeconds = 1.0
+
+// chapterSpans returns the parts of audio of the given duration to split it
+// into so that each chapter is a chunk, with the audio before, between and
+// after the chapters in chunks of their own. It reports false if there are no
+// chapters, the duration is unknown, chapters overlap, or a chunk would not
+// fit in maxBytes of wav audio at sampleRate, in which case the audio is split
+// by size instead.
+func chapterSpans(chapters []Chapter, duration float64, maxBytes int64, sampleRate int) ([]chunkSpan, bool) {
+	if len(chapters) == 0 || duration <= 0 {
+		return nil, false
+	}
+	spans := []chunkSpan{}
+	addSpan := func(start, end float64) {
+		if end <= start {
+			return
+		}
+		if end-start <= chapterGapSeconds {
+			spans[len(spans)-1].End = end
+		} else {
+			spans = append(spans, chunkSpan{Start: start, End: end})
+		}
+	}
+	covered := 0.0
+	for _, chapter := range chapters {
+		if chapter.StartTime < covered {
+			return nil, false
+		}
+		start := chapter.StartTime
+		if len(spans) == 0 && start <= chapterGapSeconds {
+			// A short gap before the first chapter is added to it.
+			start = 0
+		}
+		addSpan(covered, start)
+		spans = append(spans, chunkSpan{Start: start, End: chapter.EndTime})
+		covered = chapter.EndTime
+	}
+	addSpan(covered, duration)
+
+	maxSeconds := float64(chunkLengthInSeconds(maxBytes, sampleRate))
+	for _, span := range spans {
+		if span.End-span.Start > maxSeconds {
+			return nil, false
+		}
+	}
+	return spans, true
+}
@@ -0,0 +1,58 @@
+package transcription
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeChapters(t *testing.T) {
+	assert := assert.New(t)
+
+	probe := new(ffprobeOutput)
+	assert.NoError(json.Unmarshal([]byte(`{
+		"chapters": [
+			{"start_time": "0.000000", "end_time": "95.500000", "tags": {"title": "Prologue"}},
+			{"start_time": "95.500000", "end_time": "95.500000", "tags": {"title": "Empty"}},
+			{"start_time": "95.500000", "end_time": "300.000000", "tags": {"TITLE": "Chapter 1"}},
+			{"start_time": "300.000000", "end_time": "420.000000"}
+		]
+	}`), probe))
+	assert.Equal([]Chapter{
+		{"Prologue", 0, 95.5},
+		{"Chapter 1", 95.5, 300},
+		{"", 300, 420},
+	}, probeChapters(probe))
+	assert.Equal([]Chapter{}, probeChapters(&ffprobeOutput{}))
+}
+
+func TestChapterSpans(t *testing.T) {
+	assert := assert.New(t)
+	// 1,600,000 bytes hold 50 seconds of 16khz wav audio.
+	maxBytes := int64(1600000)
+	spans, ok := chapterSpans([]Chapter{{"", 0, 50}, {"", 50, 90}}, 90, maxBytes, 16000)
+	assert.True(ok)
+	assert.Equal([]chunkSpan{{0, 50}, {50, 90}}, spans)
+
+	// The audio before, between and after the chapters is transcribed too.
+	spans, ok = chapterSpans([]Chapter{{"", 10, 50}, {"", 60, 90}}, 120, maxBytes, 16000)
+	assert.True(ok)
+	assert.Equal([]chunkSpan{{0, 10}, {10, 50}, {50, 60}, {60, 90}, {90, 120}}, spans)
+
+	// Short gaps are added to the chapter next to them.
+	spans, ok = chapterSpans([]Chapter{{"", 0.5, 49.5}, {"", 50, 90}}, 90.5, maxBytes, 16000)
+	assert.True(ok)
+	assert.Equal([]chunkSpan{{0, 50}, {50, 90.5}}, spans)
+
+	_, ok = chapterSpans([]Chapter{{"", 0, 50}, {"", 50, 101}}, 101, maxBytes, 16000)
+	assert.False(ok, "a chapter is too long")
+	_, ok = chapterSpans([]Chapter{{"", 0, 50}}, 120, maxBytes, 16000)
+	assert.False(ok, "the audio after the chapters is too long")
+	_, ok = chapterSpans([]Chapter{{"", 0, 50}, {"", 40, 90}}, 90, maxBytes, 16000)
+	assert.False(ok, "chapters overlap")
+	_, ok = chapterSpans([]Chapter{{"", 0, 50}}, 0, maxBytes, 16000)
+	assert.False(ok, "the duration is unknown")
+	_, ok = chapterSpans(nil, 90, maxBytes, 16000)
+	assert.False(ok)
+}
@@ -0,0 +1,87 @@
+package transcription
+
+import (
+	"strings"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// AverageConfidence returns the mean confidence of the words of t, skipping
+// words with no confidence score. ok is false if no word has a score.
+func (t *Transcription) AverageConfidence() (average float64, ok bool) {
+	total := 0.0
+	count := 0
+	for _, c := range t.Confidences {
+		if c.Score == 0 {
+			continue
+		}
+		total += c.Score
+		count++
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return total / float64(count), true
+}
+
+// defaultFallbackConfidence is the average confidence below which a chunk is
+// retried with config.Config.IBMFallbackModel when
+// config.Config.IBMFallbackConfidence is unset.
+const defaultFallbackConfidence = 0.5
+
+// resultConfidence returns the average confidence of the words in an IBM
+// result. It reports false if none has a score, such as when the chunk has
+// no speech.
+func resultConfidence(cfg *config.AppConfig, result *IBMResult) (float64, bool) {
+	return getTranscription(cfg, []*IBMResult{result}).AverageConfidence()
+}
+
+// setAverageConfidence stores the average confidence of t on it.
+func (t *Transcription) setAverageConfidence() {
+	t.OverallConfidence, _ = t.AverageConfidence()
+}
+
+// DropLowConfidenceWords removes the words of t whose confidence is below
+// threshold from the transcript and timestamps, for display. If replacement is
+// not empty, such as "[inaudible]", each run of removed words is replaced by
+// it instead, spanning their times. Words without a confidence score are kept.
+// The transcript is rebuilt from the timestamps, so nothing is dropped unless
+// every word has a timestamp and a confidence.
+func (t *Transcription) DropLowConfidenceWords(threshold float64, replacement string) {
+	if len(t.Timestamps) == 0 || len(t.Confidences) != len(t.Timestamps) ||
+		len(strings.Fields(t.Transcript)) != len(t.Timestamps) {
+		return
+	}
+
+	timestamps := []timestamp{}
+	confidences := []confidence{}
+	replaced := false
+	for i, word := range t.Timestamps {
+		score := t.Confidences[i].Score
+		if score == 0 || score >= threshold {
+			timestamps = append(timestamps, word)
+			confidences = append(confidences, t.Confidences[i])
+			replaced = false
+			continue
+		}
+		if len(replacement) == 0 {
+			continue
+		}
+		if replaced {
+			timestamps[len(timestamps)-1].EndTime = word.EndTime
+			continue
+		}
+		timestamps = append(timestamps, timestamp{replacement, word.StartTime, word.EndTime})
+		confidences = append(confidences, confidence{replacement, score})
+		replaced = true
+	}
+
+	words := make([]string, len(timestamps))
+	for i, word := range timestamps {
+		words[i] = word.Word
+	}
+	t.Transcript = strings.Join(words, " ")
+	t.Timestamps = timestamps
+	t.Confidences = confidences
+	t.CueStarts = nil
+}
@@ -0,0 +1,87 @@
+package transcription
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestAverageConfidence(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{Confidences: []confidence{
+		{"hello", 0.9},
+		{"there", 0},
+		{"world", 0.5},
+	}}
+	average, ok := transcription.AverageConfidence()
+	assert.True(ok)
+	assert.InDelta(0.7, average, 1e-9)
+
+	average, ok = (&Transcription{}).AverageConfidence()
+	assert.False(ok)
+	assert.Equal(0.0, average)
+}
+
+func TestGetTranscriptionSetsConfidence(t *testing.T) {
+	result := &IBMResult{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"results": [{"alternatives": [{
+		"transcript": "hello world",
+		"word_confidence": [["hello", 0.8], ["world", 0.6]]
+	}]}]}`), result))
+	assert.InDelta(t, 0.7, GetTranscription([]*IBMResult{result}).OverallConfidence, 1e-9)
+}
+
+func TestDropLowConfidenceWords(t *testing.T) {
+	assert := assert.New(t)
+	transcription := func() *Transcription {
+		return &Transcription{
+			Transcript:  "the uh um cat sat ",
+			Timestamps:  []timestamp{{"the", 0, 1}, {"uh", 1, 2}, {"um", 2, 3}, {"cat", 3, 4}, {"sat", 4, 5}},
+			Confidences: []confidence{{"the", 0.9}, {"uh", 0.2}, {"um", 0.3}, {"cat", 0}, {"sat", 0.8}},
+		}
+	}
+
+	dropped := transcription()
+	dropped.DropLowConfidenceWords(0.5, "")
+	assert.Equal("the cat sat", dropped.Transcript)
+	assert.Equal([]timestamp{{"the", 0, 1}, {"cat", 3, 4}, {"sat", 4, 5}}, dropped.Timestamps)
+	assert.Len(dropped.Confidences, 3)
+
+	replaced := transcription()
+	replaced.DropLowConfidenceWords(0.5, "[inaudible]")
+	assert.Equal("the [inaudible] cat sat", replaced.Transcript)
+	assert.Equal(timestamp{"[inaudible]", 1, 3}, replaced.Timestamps[1])
+	assert.NoError(replaced.Validate())
+}
+
+func TestResultConfidence(t *testing.T) {
+	assert := assert.New(t)
+	result := ibmResultFromTranscription(&Transcription{
+		Transcript:  "hola mundo ",
+		Timestamps:  []timestamp{{"hola", 0, 0.5}, {"mundo", 0.5, 1}},
+		Confidences: []confidence{{"hola", 0.2}, {"mundo", 0.4}},
+	})
+	average, ok := resultConfidence(&config.AppConfig{}, result)
+	assert.True(ok)
+	assert.InDelta(0.3, average, 1e-9)
+	_, ok = resultConfidence(&config.AppConfig{}, &IBMResult{})
+	assert.False(ok)
+}
+
+func TestFallbackSkippedForOtherEngines(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &config.AppConfig{ChunkRetries: -1, IBMFallbackModel: "es-ES_BroadbandModel"}
+	fake := &FakeTranscriber{Default: &Transcription{
+		Transcript:  "hello ",
+		Timestamps:  []timestamp{{"hello", 0, 0.5}},
+		Confidences: []confidence{{"hello", 0.1}},
+	}}
+
+	_, err := transcribeChunkWithFallback(context.Background(), cfg, fake, "id", "0_a.wav.flac", nil, defaultIBMModel)
+	assert.NoError(err)
+	assert.Equal([]string{"0_a.wav.flac"}, fake.Calls())
+}
@@ -0,0 +1,235 @@
+package transcription
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// consensusWord is one engine's vote for a word of the consensus transcript.
+type consensusWord struct {
+	timestamp  timestamp
+	confidence float64
+}
+
+// TranscribeWithConsensus transcribes the audio or video file at filePath
+// with every engine and merges their transcriptions by word-level voting; see
+// ConsensusTranscriber. The file goes through the same conversion and
+// splitting as any job, and the engines vote on each chunk. It has none of
+// the side effects of a job, such as storing or emailing the result.
+func TranscribeWithConsensus(engines []Transcriber, id string, filePath string, searchWords []string) (*Transcription, error) {
+	if len(engines) == 0 {
+		return nil, errors.New("no transcription engines given")
+	}
+	opts := Options{Source: filePath, ID: id, SearchWords: searchWords}
+	opts.Transcriber = ConsensusTranscriber{Engines: engines}
+	result, err := Transcribe(opts)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return result.Transcription, nil
+}
+
+// ConsensusTranscriber runs every one of Engines on each chunk at once and
+// merges their transcriptions by word-level voting. The words of every engine
+// are aligned against those of the first engine, as in DiffTranscriptions;
+// at each position the word most engines agree on wins, and ties go to the
+// word with the highest total confidence. Words that only some engines heard
+// are kept when a majority of engines heard them. It can be used as the
+// Transcriber of TaskOptions.
+type ConsensusTranscriber struct {
+	Engines []Transcriber
+}
+
+// MaxChunkBytes implements ChunkLimiter with the smallest limit of the
+// engines, so that every engine accepts the chunks.
+func (c ConsensusTranscriber) MaxChunkBytes() int64 {
+	var limit int64
+	for _, engine := range c.Engines {
+		if limiter, ok := engine.(ChunkLimiter); ok && limiter.MaxChunkBytes() > 0 {
+			if limit == 0 || limiter.MaxChunkBytes() < limit {
+				limit = limiter.MaxChunkBytes()
+			}
+		}
+	}
+	return limit
+}
+
+// Transcribe implements Transcriber.
+func (c ConsensusTranscriber) Transcribe(id string, filePath string, searchWords []string) (*Transcription, error) {
+	if len(c.Engines) == 0 {
+		return nil, errors.New("no transcription engines given")
+	}
+
+	transcriptions := make([]*Transcription, len(c.Engines))
+	errs := make([]error, len(c.Engines))
+	var wg sync.WaitGroup
+	for i, engine := range c.Engines {
+		wg.Add(1)
+		go func(i int, engine Transcriber) {
+			defer wg.Done()
+			transcriptions[i], errs[i] = engine.Transcribe(id, filePath, searchWords)
+		}(i, engine)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, errors.Annotatef(err, "engine %d", i+1)
+		}
+	}
+	cfg := config.GetConfig()
+	return mergeConsensus(&cfg, transcriptions), nil
+}
+
+// mergeConsensus votes on the words of several transcriptions of the same
+// audio. The first transcription is the one the others are aligned against.
+// The result has its average confidence and, if cfg asks for it, hash set
+// like any other transcription.
+func mergeConsensus(cfg *config.AppConfig, transcriptions []*Transcription) *Transcription {
+	primary := consensusWords(transcriptions[0])
+	// slots[i] holds the votes for the i-th word of the primary transcription,
+	// and inserted[i] the words other engines heard just before it.
+	slots := make([][]*consensusWord, len(primary))
+	inserted := make([][]consensusWord, len(primary)+1)
+	for i := range primary {
+		slots[i] = []*consensusWord{&primary[i]}
+	}
+
+	for _, other := range transcriptions[1:] {
+		words := consensusWords(other)
+		edits := alignWords(wordsOf(primary), wordsOf(words))
+		i, j := 0, 0
+		for _, edit := range edits {
+			switch edit.Op {
+			case EQUAL, SUBSTITUTE:
+				slots[i] = append(slots[i], &words[j])
+				i, j = i+1, j+1
+			case DELETE:
+				slots[i] = append(slots[i], nil)
+				i++
+			case INSERT:
+				inserted[i] = append(inserted[i], words[j])
+				j++
+			}
+		}
+	}
+
+	majority := len(transcriptions)/2 + 1
+	chosen := []consensusWord{}
+	for i := range inserted {
+		chosen = append(chosen, majorityInsertions(inserted[i], majority)...)
+		if i < len(primary) {
+			if word := voteWord(slots[i]); word != nil {
+				chosen = append(chosen, *word)
+			}
+		}
+	}
+
+	words := make([]string, len(chosen))
+	timestamps := make([]timestamp, len(chosen))
+	confidences := make([]confidence, len(chosen))
+	for i, word := range chosen {
+		words[i] = word.timestamp.Word
+		timestamps[i] = word.timestamp
+		confidences[i] = confidence{word.timestamp.Word, word.confidence}
+	}
+	transcription := &Transcription{
+		Transcript:  strings.Join(words, " "),
+		CompletedAt: now(),
+		Timestamps:  timestamps,
+		Confidences: confidences,
+		IBMKeywords: transcriptions[0].IBMKeywords,
+		Empty:       len(words) == 0,
+	}
+	transcription.setAverageConfidence()
+	transcription.setHash(cfg)
+	return transcription
+}
+
+// voteWord returns the word with the most votes, breaking ties by total
+// confidence. A nil vote is a vote for no word at all.
+func voteWord(votes []*consensusWord) *consensusWord {
+	type tally struct {
+		word       *consensusWord
+		votes      int
+		confidence float64
+	}
+	// A word that normalizes to nothing, such as "...", is still a word
+	// rather than a vote for no word.
+	type tallyKey struct {
+		deleted bool
+		word    string
+	}
+	tallies := []*tally{}
+	byWord := make(map[tallyKey]*tally)
+	for _, vote := range votes {
+		key := tallyKey{deleted: true}
+		if vote != nil {
+			key = tallyKey{word: normalizeKeywordWord(vote.timestamp.Word, false)}
+		}
+		t, ok := byWord[key]
+		if !ok {
+			t = &tally{word: vote}
+			byWord[key] = t
+			tallies = append(tallies, t)
+		}
+		t.votes++
+		if vote != nil {
+			t.confidence += vote.confidence
+			if vote.confidence > t.word.confidence {
+				t.word = vote
+			}
+		}
+	}
+
+	best := tallies[0]
+	for _, t := range tallies[1:] {
+		if t.votes > best.votes || (t.votes == best.votes && t.confidence > best.confidence) {
+			best = t
+		}
+	}
+	return best.word
+}
+
+// majorityInsertions returns the inserted words that at least majority
+// engines heard, counting the first engine, which did not.
+func majorityInsertions(words []consensusWord, majority int) []consensusWord {
+	counts := make(map[string]int)
+	for _, word := range words {
+		counts[normalizeKeywordWord(word.timestamp.Word, false)]++
+	}
+	kept := []consensusWord{}
+	for _, word := range words {
+		key := normalizeKeywordWord(word.timestamp.Word, false)
+		if counts[key] >= majority {
+			kept = append(kept, word)
+			// Only keep one copy of each word.
+			counts[key] = 0
+		}
+	}
+	return kept
+}
+
+// consensusWords pairs the timestamped words of t with their confidences.
+// Words without a confidence count as fully confident.
+func consensusWords(t *Transcription) []consensusWord {
+	words := make([]consensusWord, len(t.Timestamps))
+	for i, ts := range t.Timestamps {
+		words[i] = consensusWord{timestamp: ts, confidence: 1}
+		if len(t.Confidences) == len(t.Timestamps) {
+			words[i].confidence = t.Confidences[i].Score
+		}
+	}
+	return words
+}
+
+func wordsOf(words []consensusWord) []string {
+	strs := make([]string, len(words))
+	for i, word := range words {
+		strs[i] = word.timestamp.Word
+	}
+	return strs
+}
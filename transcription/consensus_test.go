@@ -0,0 +1,107 @@
+package transcription
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// stubTranscriber returns a transcription of the given words, all with the
+// same confidence.
+type stubTranscriber struct {
+	words      string
+	confidence float64
+	err        error
+}
+
+func (s stubTranscriber) Transcribe(id string, filePath string, searchWords []string) (*Transcription, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	t := &Transcription{Transcript: s.words}
+	for i, word := range strings.Fields(s.words) {
+		t.Timestamps = append(t.Timestamps, timestamp{word, float64(i), float64(i + 1)})
+		t.Confidences = append(t.Confidences, confidence{word, s.confidence})
+	}
+	return t, nil
+}
+
+func TestConsensusTranscriberMajority(t *testing.T) {
+	assert := assert.New(t)
+
+	transcription, err := ConsensusTranscriber{[]Transcriber{
+		stubTranscriber{"the quick frown fox", 0.9, nil},
+		stubTranscriber{"the quick brown fox jumps", 0.5, nil},
+		stubTranscriber{"a quick brown fox jumps", 0.5, nil},
+	}}.Transcribe("id", "chunk.flac", nil)
+	assert.NoError(err)
+	assert.Equal("the quick brown fox jumps", transcription.Transcript)
+	assert.Len(transcription.Timestamps, 5)
+	assert.False(transcription.Empty)
+}
+
+func TestConsensusTranscriberTieUsesConfidence(t *testing.T) {
+	assert := assert.New(t)
+
+	transcription, err := ConsensusTranscriber{[]Transcriber{
+		stubTranscriber{"recognize the speech", 0.4, nil},
+		stubTranscriber{"wreck the speech", 0.8, nil},
+	}}.Transcribe("id", "chunk.flac", nil)
+	assert.NoError(err)
+	assert.Equal("wreck the speech", transcription.Transcript)
+	assert.Equal(confidence{"wreck", 0.8}, transcription.Confidences[0])
+}
+
+func TestMergeConsensusSetsConfidenceAndHash(t *testing.T) {
+	assert := assert.New(t)
+	stub := stubTranscriber{"hello world", 0.9, nil}
+	first, _ := stub.Transcribe("id", "chunk.flac", nil)
+	second, _ := stub.Transcribe("id", "chunk.flac", nil)
+
+	transcription := mergeConsensus(&config.AppConfig{HashTranscriptions: true}, []*Transcription{first, second})
+	assert.InDelta(0.9, transcription.OverallConfidence, 1e-9)
+	assert.True(VerifyTranscriptionHash(transcription))
+	transcription = mergeConsensus(&config.AppConfig{}, []*Transcription{first, second})
+	assert.Empty(transcription.Hash)
+}
+
+func TestConsensusTranscriberFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ConsensusTranscriber{[]Transcriber{
+		stubTranscriber{"hello", 1, nil},
+		stubTranscriber{err: errors.New("boom")},
+	}}.Transcribe("id", "chunk.flac", nil)
+	assert.Error(err)
+}
+
+func TestConsensusTranscriberPunctuationAfterDeletion(t *testing.T) {
+	assert := assert.New(t)
+
+	// "..." normalizes to nothing, like the vote of the engine that heard
+	// no word at all, but is tallied apart from it.
+	transcription, err := ConsensusTranscriber{[]Transcriber{
+		stubTranscriber{"hello", 0.9, nil},
+		stubTranscriber{"", 0.9, nil},
+		stubTranscriber{"...", 0.5, nil},
+	}}.Transcribe("id", "chunk.flac", nil)
+	assert.NoError(err)
+	assert.Equal("hello", transcription.Transcript)
+}
+
+func TestConsensusTranscriberChunkLimit(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(0), ConsensusTranscriber{[]Transcriber{stubTranscriber{}}}.MaxChunkBytes())
+	consensus := ConsensusTranscriber{[]Transcriber{stubTranscriber{}, IBMTranscriber{}}}
+	assert.Equal(int64(defaultMaxChunkBytes), consensus.MaxChunkBytes())
+	assert.Equal(int64(defaultMaxChunkBytes), maxChunkBytes(&config.AppConfig{}, consensus))
+}
+
+func TestTranscribeWithConsensusWithoutEngines(t *testing.T) {
+	_, err := TranscribeWithConsensus(nil, "id", "talk.mp3", nil)
+	assert.Error(t, err)
+}
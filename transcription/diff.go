@@ -0,0 +1,117 @@
+package transcription
+
+import (
+	"strings"
+)
+
+// EditOp is the kind of a word-level edit between two transcriptions.
+type EditOp string
+
+// These are the edit operations of a TranscriptionDiff.
+// EQUAL: The word is the same in both transcriptions.
+// SUBSTITUTE: The hypothesis has a different word than the reference.
+// INSERT: The hypothesis has a word that the reference does not.
+// DELETE: The hypothesis is missing a word of the reference.
+const (
+	EQUAL      EditOp = "equal"
+	SUBSTITUTE EditOp = "substitute"
+	INSERT     EditOp = "insert"
+	DELETE     EditOp = "delete"
+)
+
+// WordEdit is a single step of a TranscriptionDiff. Reference or Hypothesis is
+// empty for insertions and deletions respectively.
+type WordEdit struct {
+	Op         EditOp `json:"op"`
+	Reference  string `json:"reference,omitempty"`
+	Hypothesis string `json:"hypothesis,omitempty"`
+}
+
+// TranscriptionDiff is the word-level alignment of two transcriptions.
+type TranscriptionDiff struct {
+	Edits         []WordEdit `json:"edits"`
+	Substitutions int        `json:"substitutions"`
+	Insertions    int        `json:"insertions"`
+	Deletions     int        `json:"deletions"`
+	// WER is the word error rate of the hypothesis, (S + D + I) / N where N is
+	// the number of words in the reference.
+	WER float64 `json:"wer"`
+}
+
+// DiffTranscriptions aligns the words of hypothesis b against the reference a
+// with the fewest edits. Words are compared case-insensitively and without
+// surrounding punctuation.
+func DiffTranscriptions(a, b *Transcription) *TranscriptionDiff {
+	ref := strings.Fields(a.Transcript)
+	hyp := strings.Fields(b.Transcript)
+	edits := alignWords(ref, hyp)
+
+	diff := &TranscriptionDiff{Edits: edits}
+	for _, edit := range edits {
+		switch edit.Op {
+		case SUBSTITUTE:
+			diff.Substitutions++
+		case INSERT:
+			diff.Insertions++
+		case DELETE:
+			diff.Deletions++
+		}
+	}
+	errorCount := diff.Substitutions + diff.Insertions + diff.Deletions
+	if len(ref) > 0 {
+		diff.WER = float64(errorCount) / float64(len(ref))
+	} else if errorCount > 0 {
+		diff.WER = 1
+	}
+	return diff
+}
+
+// alignWords returns the minimum edit alignment of hyp against ref.
+func alignWords(ref, hyp []string) []WordEdit {
+	// cost[i][j] is the edit distance between ref[:i] and hyp[:j].
+	cost := make([][]int, len(ref)+1)
+	for i := range cost {
+		cost[i] = make([]int, len(hyp)+1)
+		cost[i][0] = i
+	}
+	for j := range cost[0] {
+		cost[0][j] = j
+	}
+	for i := 1; i <= len(ref); i++ {
+		for j := 1; j <= len(hyp); j++ {
+			substitution := cost[i-1][j-1]
+			if !sameWord(ref[i-1], hyp[j-1]) {
+				substitution++
+			}
+			cost[i][j] = minInt(minInt(cost[i-1][j]+1, cost[i][j-1]+1), substitution)
+		}
+	}
+
+	// Walk back from the end to recover the edits.
+	edits := []WordEdit{}
+	i, j := len(ref), len(hyp)
+	for i > 0 || j > 0 {
+		switch {
+		case i > 0 && j > 0 && sameWord(ref[i-1], hyp[j-1]) && cost[i][j] == cost[i-1][j-1]:
+			edits = append(edits, WordEdit{EQUAL, ref[i-1], hyp[j-1]})
+			i, j = i-1, j-1
+		case i > 0 && j > 0 && cost[i][j] == cost[i-1][j-1]+1:
+			edits = append(edits, WordEdit{SUBSTITUTE, ref[i-1], hyp[j-1]})
+			i, j = i-1, j-1
+		case i > 0 && cost[i][j] == cost[i-1][j]+1:
+			edits = append(edits, WordEdit{DELETE, ref[i-1], ""})
+			i--
+		default:
+			edits = append(edits, WordEdit{INSERT, "", hyp[j-1]})
+			j--
+		}
+	}
+	for l, r := 0, len(edits)-1; l < r; l, r = l+1, r-1 {
+		edits[l], edits[r] = edits[r], edits[l]
+	}
+	return edits
+}
+
+func sameWord(a, b string) bool {
+	return normalizeKeywordWord(a, false) == normalizeKeywordWord(b, false)
+}
@@ -0,0 +1,38 @@
+package transcription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffTranscriptions(t *testing.T) {
+	assert := assert.New(t)
+	reference := &Transcription{Transcript: "the quick brown fox jumps"}
+	hypothesis := &Transcription{Transcript: "The quick frown fox really jumps"}
+
+	diff := DiffTranscriptions(reference, hypothesis)
+	assert.Equal([]WordEdit{
+		{EQUAL, "the", "The"},
+		{EQUAL, "quick", "quick"},
+		{SUBSTITUTE, "brown", "frown"},
+		{EQUAL, "fox", "fox"},
+		{INSERT, "", "really"},
+		{EQUAL, "jumps", "jumps"},
+	}, diff.Edits)
+	assert.Equal(1, diff.Substitutions)
+	assert.Equal(1, diff.Insertions)
+	assert.Equal(0, diff.Deletions)
+	assert.InDelta(0.4, diff.WER, 1e-9)
+}
+
+func TestDiffTranscriptionsDeletion(t *testing.T) {
+	assert := assert.New(t)
+	reference := &Transcription{Transcript: "one two three"}
+	hypothesis := &Transcription{Transcript: "one three"}
+
+	diff := DiffTranscriptions(reference, hypothesis)
+	assert.Equal(1, diff.Deletions)
+	assert.Equal(WordEdit{DELETE, "two", ""}, diff.Edits[1])
+	assert.InDelta(1.0/3, diff.WER, 1e-9)
+}
@@ -0,0 +1,187 @@
+package transcription
+
+import (
+	"bytes"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// These are the default notification templates. Each can be replaced with a
+// text/template string through config.Config.
+const (
+	defaultSuccessSubject = "IBM Transcription {{.ID}} Complete"
+	defaultSuccessBody    = "{{if .Transcription.Empty}}No speech was detected in the audio, so the transcript is empty." +
+		"{{else}}{{with .Transcription.Summary}}Summary: {{.}}\n\n{{end}}The transcript is below. It can also be found in the database.\n\n{{.Transcription.Transcript}}{{end}}" +
+		"{{with .AudioURLNote}}\n\n{{.}}{{end}}" +
+		"{{with .Timing}}\n\n{{.}}{{end}}"
+	defaultFailureSubject = "IBM Transcription {{.ID}} Failed"
+	defaultFailureBody    = "{{.Error}}" +
+		"{{with .Suppressed}}\n\n{{.}} more failure(s) with the same error were not emailed.{{end}}"
+)
+
+// EmailData is the data available to the email templates.
+type EmailData struct {
+	ID            string
+	Transcription *Transcription
+	AudioURLNote  string
+	// Timing summarizes how long each stage of the job took.
+	Timing string
+	Error  string
+	// Suppressed is the number of identical failure emails that were
+	// throttled since the last one was sent.
+	Suppressed int
+}
+
+// timingSummary describes how long the job that produced t took, such as
+// "Took 1m5s: download 2s, convert 3s, split 0s, transcribe 56s, upload 4s."
+// It is empty if the timings were not recorded.
+func timingSummary(t *Transcription) string {
+	if t == nil || t.Elapsed == 0 {
+		return ""
+	}
+	stages := []string{}
+	for _, stage := range []Stage{DOWNLOAD, CONVERT, SPLIT, TRANSCRIBE, UPLOAD} {
+		if d, ok := t.Durations[stage]; ok {
+			stages = append(stages, string(stage)+" "+roundDuration(d).String())
+		}
+	}
+	summary := "Took " + roundDuration(t.Elapsed).String()
+	if len(stages) > 0 {
+		summary += ": " + strings.Join(stages, ", ")
+	}
+	return summary + "."
+}
+
+// roundDuration rounds d to the second, or to the millisecond if it is
+// shorter than that. Halves round up.
+func roundDuration(d time.Duration) time.Duration {
+	unit := time.Second
+	if d < time.Second {
+		unit = time.Millisecond
+	}
+	return (d + unit/2) / unit * unit
+}
+
+// renderEmail executes the subject and body templates with data. Empty
+// templates fall back to the given defaults.
+func renderEmail(subjectTemplate, bodyTemplate, defaultSubject, defaultBody string, data EmailData) (string, string, error) {
+	if len(subjectTemplate) == 0 {
+		subjectTemplate = defaultSubject
+	}
+	if len(bodyTemplate) == 0 {
+		bodyTemplate = defaultBody
+	}
+
+	subject, err := executeTemplate("subject", subjectTemplate, data)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	body, err := executeTemplate("body", bodyTemplate, data)
+	if err != nil {
+		return "", "", errors.Trace(err)
+	}
+	return subject, body, nil
+}
+
+func executeTemplate(name, text string, data EmailData) (string, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", errors.Annotatef(err, "could not parse email %s template", name)
+	}
+	var buffer bytes.Buffer
+	if err := t.Execute(&buffer, data); err != nil {
+		return "", errors.Annotatef(err, "could not execute email %s template", name)
+	}
+	return buffer.String(), nil
+}
+
+// failureEmails tracks the failure emails sent recently, keyed by
+// failureEmailKey, so that a burst of jobs failing for the same reason sends
+// a single email.
+var failureEmails = struct {
+	sync.Mutex
+	m map[string]*throttledFailure
+}{m: make(map[string]*throttledFailure)}
+
+type throttledFailure struct {
+	sent       time.Time
+	suppressed int
+}
+
+// digits matches the numbers in error messages, such as timestamps in file
+// names, that differ between otherwise identical failures.
+var digits = regexp.MustCompile("[0-9]+")
+
+// failureEmailKey identifies failures with the same recipients and error.
+func failureEmailKey(recipients []string, errMessage string) string {
+	sorted := append([]string{}, recipients...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",") + "\x00" + digits.ReplaceAllString(errMessage, "#")
+}
+
+// throttleFailureEmail reports whether a failure email with the given key
+// should be sent, given that identical emails are only sent once per window.
+// When it returns true, it also returns the number of emails that were held
+// back since the last one.
+func throttleFailureEmail(key string, window time.Duration) (bool, int) {
+	if window <= 0 {
+		return true, 0
+	}
+	failureEmails.Lock()
+	defer failureEmails.Unlock()
+
+	for k, failure := range failureEmails.m {
+		if now().Sub(failure.sent) >= window && failure.suppressed == 0 {
+			delete(failureEmails.m, k)
+		}
+	}
+
+	failure, ok := failureEmails.m[key]
+	if ok && now().Sub(failure.sent) < window {
+		failure.suppressed++
+		return false, 0
+	}
+	suppressed := 0
+	if ok {
+		suppressed = failure.suppressed
+	}
+	failureEmails.m[key] = &throttledFailure{sent: now()}
+	return true, suppressed
+}
+
+// dedupeRecipients removes repeated addresses from to, cc and bcc, keeping the
+// first occurrence in that order. Addresses are compared case-insensitively,
+// ignoring any display name, so "Ann <ann@example.com>" and ANN@example.com
+// are the same recipient.
+func dedupeRecipients(to, cc, bcc []string) ([]string, []string, []string) {
+	seen := make(map[string]bool)
+	dedupe := func(addresses []string) []string {
+		if addresses == nil {
+			return nil
+		}
+		unique := []string{}
+		for _, address := range addresses {
+			key := strings.ToLower(strings.TrimSpace(address))
+			if parsed, err := mail.ParseAddress(address); err == nil {
+				key = strings.ToLower(parsed.Address)
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			unique = append(unique, address)
+		}
+		return unique
+	}
+	to = dedupe(to)
+	cc = dedupe(cc)
+	bcc = dedupe(bcc)
+	return to, cc, bcc
+}
@@ -0,0 +1,121 @@
+package transcription
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderDefaultSuccessEmail(t *testing.T) {
+	assert := assert.New(t)
+	data := EmailData{
+		ID:            "abc",
+		Transcription: &Transcription{Transcript: "hello world"},
+		AudioURLNote:  "The audio can be found at http://example.com/a.mp3",
+	}
+
+	subject, body, err := renderEmail("", "", defaultSuccessSubject, defaultSuccessBody, data)
+	assert.NoError(err)
+	assert.Equal("IBM Transcription abc Complete", subject)
+	assert.Equal("The transcript is below. It can also be found in the database.\n\nhello world\n\nThe audio can be found at http://example.com/a.mp3", body)
+}
+
+func TestTimingSummary(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("", timingSummary(&Transcription{}))
+	assert.Equal("Took 1m5s: download 2s, convert 3s, split 250ms, transcribe 56s, upload 4s.", timingSummary(&Transcription{
+		Elapsed: 65*time.Second + 100*time.Millisecond,
+		Durations: map[Stage]time.Duration{
+			DOWNLOAD:   2 * time.Second,
+			CONVERT:    3 * time.Second,
+			SPLIT:      250 * time.Millisecond,
+			TRANSCRIBE: 56 * time.Second,
+			UPLOAD:     4*time.Second + 400*time.Millisecond,
+		},
+	}))
+
+	subject, body, err := renderEmail("", "", defaultSuccessSubject, defaultSuccessBody, EmailData{
+		ID:            "abc",
+		Transcription: &Transcription{Transcript: "hello"},
+		Timing:        "Took 5s.",
+	})
+	assert.NoError(err)
+	assert.Equal("IBM Transcription abc Complete", subject)
+	assert.Equal("The transcript is below. It can also be found in the database.\n\nhello\n\nTook 5s.", body)
+}
+
+func TestRenderCustomEmail(t *testing.T) {
+	assert := assert.New(t)
+	data := EmailData{ID: "abc", Transcription: &Transcription{Empty: true}}
+
+	subject, body, err := renderEmail("[Acme] Job {{.ID}}", "{{if .Transcription.Empty}}silent{{end}}", defaultSuccessSubject, defaultSuccessBody, data)
+	assert.NoError(err)
+	assert.Equal("[Acme] Job abc", subject)
+	assert.Equal("silent", body)
+}
+
+func TestRenderEmailWithBadTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := renderEmail("{{.Missing", "", defaultFailureSubject, defaultFailureBody, EmailData{})
+	assert.Error(err)
+}
+
+// resetFailureEmails forgets the failure emails sent by other tests or runs.
+func resetFailureEmails() {
+	failureEmails.Lock()
+	failureEmails.m = make(map[string]*throttledFailure)
+	failureEmails.Unlock()
+}
+
+func TestThrottleFailureEmail(t *testing.T) {
+	assert := assert.New(t)
+	resetFailureEmails()
+	defer resetFailureEmails()
+	start := time.Unix(1000, 0)
+	defer freezeTime(start)()
+
+	key := failureEmailKey([]string{"b@example.com", "a@example.com"}, "could not open /tmp/audio.mp31234")
+	assert.Equal(key, failureEmailKey([]string{"a@example.com", "b@example.com"}, "could not open /tmp/audio.mp35678"))
+
+	send, _ := throttleFailureEmail(key, time.Minute)
+	assert.True(send)
+	send, _ = throttleFailureEmail(key, time.Minute)
+	assert.False(send)
+	send, _ = throttleFailureEmail(key, time.Minute)
+	assert.False(send)
+
+	freezeTime(start.Add(time.Minute))
+	send, suppressed := throttleFailureEmail(key, time.Minute)
+	assert.True(send)
+	assert.Equal(2, suppressed)
+
+	send, _ = throttleFailureEmail(key, 0)
+	assert.True(send)
+}
+
+func TestRenderFailureEmailWithSuppressed(t *testing.T) {
+	assert := assert.New(t)
+
+	_, body, err := renderEmail("", "", defaultFailureSubject, defaultFailureBody, EmailData{Error: "IBM is down", Suppressed: 3})
+	assert.NoError(err)
+	assert.Equal("IBM is down\n\n3 more failure(s) with the same error were not emailed.", body)
+}
+
+func TestDedupeRecipients(t *testing.T) {
+	assert := assert.New(t)
+	to, cc, bcc := dedupeRecipients(
+		[]string{"ann@example.com", "Bob <bob@example.com>", "ANN@example.com "},
+		[]string{"bob@EXAMPLE.com", "cat@example.com"},
+		[]string{"Cat <cat@example.com>", "archive@example.com"},
+	)
+	assert.Equal([]string{"ann@example.com", "Bob <bob@example.com>"}, to)
+	assert.Equal([]string{"cat@example.com"}, cc)
+	assert.Equal([]string{"archive@example.com"}, bcc)
+
+	to, cc, bcc = dedupeRecipients([]string{"ann@example.com"}, nil, nil)
+	assert.Equal([]string{"ann@example.com"}, to)
+	assert.Nil(cc)
+	assert.Nil(bcc)
+}
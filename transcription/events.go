@@ -0,0 +1,227 @@
+package transcription
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+)
+
+const (
+	// jobEventBuffer is how many events a slow subscriber can fall behind
+	// before further events are dropped for it. The completed and failed
+	// events are never dropped.
+	jobEventBuffer = 64
+	// sseKeepAlive is how often StreamJobEvents writes a comment while no
+	// events happen, which keeps proxies from closing the connection and
+	// notices when the client has gone.
+	sseKeepAlive = 15 * time.Second
+)
+
+// These are the names of the events sent by StreamJobEvents.
+const (
+	stageEvent     = "stage"
+	chunkEvent     = "chunk"
+	logEvent       = "log"
+	completedEvent = "completed"
+	failedEvent    = "failed"
+)
+
+// StageEvent is the data of a stage event.
+type StageEvent struct {
+	Stage Stage `json:"stage"`
+}
+
+// ChunkEvent is the data of a chunk event, the partial result of a job.
+type ChunkEvent struct {
+	Index      int         `json:"index"`
+	Transcript string      `json:"transcript"`
+	Timestamps []timestamp `json:"timestamps"`
+}
+
+// LogEvent is the data of a log event.
+type LogEvent struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// jobEvent is an event for the subscribers of a job.
+type jobEvent struct {
+	name string
+	data interface{}
+}
+
+// jobSubscriber receives the events of a job. The event that finishes the job
+// has a channel of its own, so that it is delivered however far behind the
+// subscriber is.
+type jobSubscriber struct {
+	events   chan jobEvent
+	finished chan jobEvent
+}
+
+// jobSubscribers maps the id of every job someone is streaming to its
+// subscribers.
+var jobSubscribers = struct {
+	sync.Mutex
+	m map[string][]*jobSubscriber
+}{m: make(map[string][]*jobSubscriber)}
+
+// addLogHook makes the log messages of jobs available to their subscribers
+// once the first one subscribes.
+var addLogHook sync.Once
+
+// subscribeJobEvents returns a subscriber receiving the events of job id, and
+// the function that stops them.
+func subscribeJobEvents(id string) (*jobSubscriber, func()) {
+	addLogHook.Do(func() {
+		log.AddHook(jobLogHook{})
+	})
+	subscriber := &jobSubscriber{
+		events:   make(chan jobEvent, jobEventBuffer),
+		finished: make(chan jobEvent, 1),
+	}
+	jobSubscribers.Lock()
+	jobSubscribers.m[id] = append(jobSubscribers.m[id], subscriber)
+	jobSubscribers.Unlock()
+
+	return subscriber, func() {
+		jobSubscribers.Lock()
+		defer jobSubscribers.Unlock()
+		subscribers := []*jobSubscriber{}
+		for _, other := range jobSubscribers.m[id] {
+			if other != subscriber {
+				subscribers = append(subscribers, other)
+			}
+		}
+		if len(subscribers) == 0 {
+			delete(jobSubscribers.m, id)
+		} else {
+			jobSubscribers.m[id] = subscribers
+		}
+	}
+}
+
+// publishJobEvent sends an event to every subscriber of job id. Subscribers
+// that are too far behind miss it rather than hold up the job, unless it is
+// the completed or failed event. It must not log, since it is called from
+// jobLogHook.
+func publishJobEvent(id string, name string, data interface{}) {
+	jobSubscribers.Lock()
+	defer jobSubscribers.Unlock()
+	for _, subscriber := range jobSubscribers.m[id] {
+		events := subscriber.events
+		if name == completedEvent || name == failedEvent {
+			events = subscriber.finished
+		}
+		select {
+		case events <- jobEvent{name, data}:
+		default:
+		}
+	}
+}
+
+// hasJobSubscribers reports whether anyone is streaming the events of job id,
+// so that events that are costly to build can be skipped otherwise.
+func hasJobSubscribers(id string) bool {
+	jobSubscribers.Lock()
+	defer jobSubscribers.Unlock()
+	return len(jobSubscribers.m[id]) > 0
+}
+
+// jobLogHook publishes every log entry with a task field as a log event of
+// that job.
+type jobLogHook struct{}
+
+func (jobLogHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel, log.InfoLevel, log.DebugLevel}
+}
+
+func (jobLogHook) Fire(entry *log.Entry) error {
+	if id, ok := entry.Data["task"].(string); ok {
+		publishJobEvent(id, logEvent, LogEvent{Level: entry.Level.String(), Message: entry.Message})
+	}
+	return nil
+}
+
+// StreamJobEvents writes the events of job id to w as server-sent events, so
+// that a browser can follow the job with an EventSource. The events are:
+//
+//	stage: a stage of the job started, with a StageEvent
+//	chunk: a chunk was transcribed, with a ChunkEvent
+//	log: the job logged a message, with a LogEvent
+//	completed or failed: the job finished, with a JobEvent
+//
+// It returns after the job finishes, or when a write fails because the client
+// has gone. Only the events after the call are sent, so a job that is not
+// running, whether it has not started or has already finished, is a
+// NotFound error and nothing is written.
+func StreamJobEvents(id string, w http.ResponseWriter) error {
+	return StreamJobEventsContext(context.Background(), id, w)
+}
+
+// StreamJobEventsContext is StreamJobEvents, but also returns once ctx is
+// done, such as the context of the request being streamed to.
+func StreamJobEventsContext(ctx context.Context, id string, w http.ResponseWriter) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming is not supported by the response writer")
+	}
+	// The job is checked after subscribing, so that it cannot finish in
+	// between unnoticed.
+	subscriber, unsubscribe := subscribeJobEvents(id)
+	defer unsubscribe()
+	if !isJobRunning(id) {
+		return errors.NotFoundf("running job %q", id)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-subscriber.events:
+			if err := writeJobEvent(w, event); err != nil {
+				return errors.Trace(err)
+			}
+			flusher.Flush()
+		case event := <-subscriber.finished:
+			// The events before it are sent first.
+			for len(subscriber.events) > 0 {
+				if err := writeJobEvent(w, <-subscriber.events); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			err := writeJobEvent(w, event)
+			flusher.Flush()
+			return errors.Trace(err)
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return errors.Trace(err)
+			}
+			flusher.Flush()
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		}
+	}
+}
+
+// writeJobEvent writes event to w in the text/event-stream format.
+func writeJobEvent(w io.Writer, event jobEvent) error {
+	data, err := json.Marshal(event.data)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data)
+	return errors.Trace(err)
+}
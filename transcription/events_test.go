@@ -0,0 +1,97 @@
+package transcription
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// streamJobEvents starts streaming the events of job id and waits until it
+// has subscribed. The returned channel receives the result of the stream.
+func streamJobEvents(ctx context.Context, id string, recorder *httptest.ResponseRecorder) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- StreamJobEventsContext(ctx, id, recorder)
+	}()
+	for !hasJobSubscribers(id) {
+		time.Sleep(time.Millisecond)
+	}
+	return done
+}
+
+func waitForStream(t *testing.T, done <-chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("StreamJobEvents did not return")
+		return nil
+	}
+}
+
+func TestStreamJobEvents(t *testing.T) {
+	assert := assert.New(t)
+	_, finish := RegisterJob("streamed")
+	defer finish()
+	recorder := httptest.NewRecorder()
+	done := streamJobEvents(context.Background(), "streamed", recorder)
+
+	publishJobEvent("streamed", stageEvent, StageEvent{TRANSCRIBE})
+	publishJobEvent("other", stageEvent, StageEvent{STORE})
+	publishJobEvent("streamed", chunkEvent, ChunkEvent{Index: 0, Transcript: "hello"})
+	log.WithField("task", "streamed").Info("Transcribed")
+	publishJobEvent("streamed", completedEvent, JobEvent{ID: "streamed", Status: COMPLETED})
+
+	assert.NoError(waitForStream(t, done))
+	assert.Equal("text/event-stream", recorder.Header().Get("Content-Type"))
+	body := recorder.Body.String()
+	assert.True(strings.HasPrefix(body, "event: stage\ndata: {\"stage\":\"transcribe\"}\n\n"), body)
+	assert.Contains(body, "event: chunk\ndata: {\"index\":0,\"transcript\":\"hello\",")
+	assert.Contains(body, "event: log\ndata: {\"level\":\"info\",\"message\":\"Transcribed\"}\n\n")
+	// The completed event is sent last.
+	assert.Equal(strings.LastIndex(body, "event: "), strings.Index(body, "event: completed\ndata: {\"id\":\"streamed\""), body)
+	assert.NotContains(body, "store")
+	assert.False(hasJobSubscribers("streamed"))
+}
+
+func TestPublishJobEventKeepsFailureWhenBehind(t *testing.T) {
+	assert := assert.New(t)
+	subscriber, unsubscribe := subscribeJobEvents("behind")
+	defer unsubscribe()
+
+	// Nothing reads the events, so the subscriber falls behind.
+	for i := 0; i < 2*jobEventBuffer; i++ {
+		publishJobEvent("behind", logEvent, LogEvent{Level: "debug", Message: "tick"})
+	}
+	publishJobEvent("behind", failedEvent, JobEvent{ID: "behind", Status: FAILED, Error: "boom"})
+	assert.Len(subscriber.events, jobEventBuffer)
+	if assert.Len(subscriber.finished, 1) {
+		event := <-subscriber.finished
+		assert.Equal(failedEvent, event.name)
+		assert.Equal("boom", event.data.(JobEvent).Error)
+	}
+}
+
+func TestStreamJobEventsStopsWithContext(t *testing.T) {
+	_, finish := RegisterJob("abandoned")
+	defer finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := streamJobEvents(ctx, "abandoned", httptest.NewRecorder())
+	cancel()
+	assert.Equal(t, context.Canceled, errors.Cause(waitForStream(t, done)))
+}
+
+func TestStreamJobEventsOfJobNotRunning(t *testing.T) {
+	assert := assert.New(t)
+	recorder := httptest.NewRecorder()
+	err := StreamJobEvents("unknown", recorder)
+	assert.True(errors.IsNotFound(err), "%v", err)
+	assert.Empty(recorder.Body.String())
+	assert.False(hasJobSubscribers("unknown"))
+}
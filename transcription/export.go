@@ -0,0 +1,125 @@
+package transcription
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// ExportTimestampsCSV writes one row per timestamped word of t to w, with the
+// columns word, start, end and confidence. The confidence column is left blank
+// for words beyond the end of the Confidences slice.
+func ExportTimestampsCSV(t *Transcription, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"word", "start", "end", "confidence"}); err != nil {
+		return errors.Trace(err)
+	}
+	for i, word := range t.Timestamps {
+		score := ""
+		if i < len(t.Confidences) {
+			score = formatFloat(t.Confidences[i].Score)
+		}
+		row := []string{word.Word, formatFloat(word.StartTime), formatFloat(word.EndTime), score}
+		if err := writer.Write(row); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	writer.Flush()
+	return errors.Trace(writer.Error())
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// rtfSpeaker is a run of consecutive words from one channel.
+type rtfSpeaker struct {
+	channel int
+	words   []string
+}
+
+// ExportRTF writes t to w as an RTF document, which Word and Google Docs open
+// natively. The document starts with a header giving the AudioURL and the
+// date of the transcription. When the channels were transcribed separately,
+// each turn is labelled with its speaker, one per channel.
+func ExportRTF(t *Transcription, w io.Writer) error {
+	var buffer bytes.Buffer
+	buffer.WriteString(`{\rtf1\ansi\deff0{\fonttbl{\f0 Calibri;}}\f0\fs24` + "\n")
+	buffer.WriteString(`{\pard\sa200\b\fs32 Transcription\par}` + "\n")
+	if len(t.AudioURL) > 0 {
+		fmt.Fprintf(&buffer, `{\pard\b Audio: \b0 %s\par}`+"\n", rtfEscape(t.AudioURL))
+	}
+	if !t.CompletedAt.IsZero() {
+		fmt.Fprintf(&buffer, `{\pard\b Date: \b0 %s\par}`+"\n", rtfEscape(t.CompletedAt.Format("January 2, 2006")))
+	}
+	buffer.WriteString(`{\pard\sa200\par}` + "\n")
+
+	if len(t.Channels) > 1 {
+		for _, turn := range speakerTurns(t.Channels) {
+			fmt.Fprintf(&buffer, `{\pard\sa200\b Speaker %d: \b0 %s\par}`+"\n", turn.channel+1, rtfEscape(strings.Join(turn.words, " ")))
+		}
+	} else {
+		fmt.Fprintf(&buffer, `{\pard\sa200 %s\par}`+"\n", rtfEscape(strings.TrimSpace(t.Transcript)))
+	}
+	buffer.WriteString("}\n")
+
+	_, err := buffer.WriteTo(w)
+	return errors.Trace(err)
+}
+
+// speakerTurns orders the words of every channel by time and groups them into
+// runs spoken on the same channel.
+func speakerTurns(channels []*Transcription) []rtfSpeaker {
+	type channelWord struct {
+		channel int
+		word    timestamp
+	}
+	words := []channelWord{}
+	for i, channel := range channels {
+		for _, word := range channel.Timestamps {
+			words = append(words, channelWord{i, word})
+		}
+	}
+	sort.SliceStable(words, func(i, j int) bool {
+		return words[i].word.StartTime < words[j].word.StartTime
+	})
+
+	turns := []rtfSpeaker{}
+	for _, word := range words {
+		if len(turns) == 0 || turns[len(turns)-1].channel != word.channel {
+			turns = append(turns, rtfSpeaker{channel: word.channel})
+		}
+		last := &turns[len(turns)-1]
+		last.words = append(last.words, word.word.Word)
+	}
+	return turns
+}
+
+// rtfEscape escapes the RTF control characters in s and writes characters
+// outside of ASCII as Unicode escapes, with surrogate pairs where needed.
+func rtfEscape(s string) string {
+	var buffer bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '{' || r == '}':
+			buffer.WriteRune('\\')
+			buffer.WriteRune(r)
+		case r == '\n':
+			buffer.WriteString(`\line `)
+		case r < 0x80:
+			buffer.WriteRune(r)
+		case r < 0x10000:
+			fmt.Fprintf(&buffer, `\u%d?`, int16(r))
+		default:
+			r -= 0x10000
+			fmt.Fprintf(&buffer, `\u%d?\u%d?`, int16(0xD800+(r>>10)), int16(0xDC00+(r&0x3FF)))
+		}
+	}
+	return buffer.String()
+}
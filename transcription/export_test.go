@@ -0,0 +1,65 @@
+package transcription
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportTimestampsCSV(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{
+		Timestamps: []timestamp{
+			{"hello", 0.5, 1.25},
+			{"world", 1.25, 2},
+		},
+		Confidences: []confidence{
+			{"hello", 0.9},
+		},
+	}
+
+	var buffer bytes.Buffer
+	assert.NoError(ExportTimestampsCSV(transcription, &buffer))
+	assert.Equal("word,start,end,confidence\nhello,0.5,1.25,0.9\nworld,1.25,2,\n", buffer.String())
+}
+
+func TestExportRTF(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{
+		Transcript:  "costs {5} \\ café ",
+		AudioURL:    "https://example.com/a.wav",
+		CompletedAt: time.Date(2016, time.July, 4, 12, 0, 0, 0, time.UTC),
+	}
+
+	var buffer bytes.Buffer
+	assert.NoError(ExportRTF(transcription, &buffer))
+	assert.Equal(`{\rtf1\ansi\deff0{\fonttbl{\f0 Calibri;}}\f0\fs24
+{\pard\sa200\b\fs32 Transcription\par}
+{\pard\b Audio: \b0 https://example.com/a.wav\par}
+{\pard\b Date: \b0 July 4, 2016\par}
+{\pard\sa200\par}
+{\pard\sa200 costs \{5\} \\ caf\u233?\par}
+}
+`, buffer.String())
+}
+
+func TestExportRTFSpeakers(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{Channels: []*Transcription{
+		{Timestamps: []timestamp{{"hi", 0, 0.5}, {"there", 0.5, 1}, {"bye", 3, 3.5}}},
+		{Timestamps: []timestamp{{"hello", 1.5, 2}}},
+	}}
+
+	var buffer bytes.Buffer
+	assert.NoError(ExportRTF(transcription, &buffer))
+	assert.Contains(buffer.String(), `{\pard\sa200\b Speaker 1: \b0 hi there\par}
+{\pard\sa200\b Speaker 2: \b0 hello\par}
+{\pard\sa200\b Speaker 1: \b0 bye\par}
+`)
+}
+
+func TestRTFEscape(t *testing.T) {
+	assert.Equal(t, `a\line b \u-10179?\u-8704?`, rtfEscape("a\nb \U0001F600"))
+}
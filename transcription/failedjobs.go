@@ -0,0 +1,212 @@
+package transcription
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// defaultFailedJobRetries is how many times RetryFailedJobs retries a job
+// when config.Config.FailedJobRetries is unset.
+const defaultFailedJobRetries = 3
+
+// failedJobLease is how long a failed job being retried is left alone by
+// RetryFailedJobs. It is longer than a job should take, so that a retry
+// lost with its process is run again once it runs out.
+const failedJobLease = 6 * time.Hour
+
+// FailedJob is the record of a job that failed, with everything needed to run
+// it again. Failed jobs are kept in the failedjobs collection, and moved to
+// the deadletters collection once they have been retried too often.
+type FailedJob struct {
+	// ID is the id of the first attempt at the job.
+	ID             string `bson:"_id"`
+	AudioURL       string
+	EmailAddresses []string
+	SearchWords    []string
+	Metadata       map[string]string `bson:",omitempty"`
+	// Priority is the priority the job was queued with; see
+	// TaskOptions.Priority.
+	Priority string `bson:",omitempty"`
+	// Error is the error of the last attempt.
+	Error string
+	// Attempts is the number of times the job has failed.
+	Attempts int
+	FailedAt time.Time
+	// RetryingUntil is when the lease of the retry running the job ends, or
+	// zero if it is not being retried.
+	RetryingUntil time.Time
+}
+
+// newFailedJob returns the record of the failed attempt id at the job with
+// the given parameters. A retry keeps the id of the job it retries.
+func newFailedJob(id string, audioURL string, emailAddresses []string, searchWords []string, opts TaskOptions, errMessage string) FailedJob {
+	job := FailedJob{
+		ID:             id,
+		AudioURL:       audioURL,
+		EmailAddresses: emailAddresses,
+		SearchWords:    searchWords,
+		Metadata:       opts.Metadata,
+		Priority:       opts.Priority,
+		Error:          errMessage,
+		Attempts:       1,
+		FailedAt:       now(),
+	}
+	if opts.retryOf != nil {
+		job.ID = opts.retryOf.ID
+		job.Attempts = opts.retryOf.Attempts + 1
+	}
+	return job
+}
+
+// recordFailedJob stores job in the failedjobs collection of cfg.MongoURL, if
+// it is set, replacing the record of an earlier attempt. Errors are logged,
+// since the job has already failed.
+func recordFailedJob(cfg *config.AppConfig, job FailedJob) {
+	if len(cfg.MongoURL) == 0 {
+		return
+	}
+	err := withMongoCollection(cfg.MongoURL, "failedjobs", func(c *mgo.Collection) error {
+		_, err := c.UpsertId(job.ID, job)
+		return err
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"task":  job.ID,
+			"error": errors.ErrorStack(err),
+		}).Error("Could not record the failed job")
+	}
+}
+
+// removeFailedJob removes the record of job id from the failedjobs
+// collection of cfg.MongoURL, if it is set, such as once a retry succeeded.
+// Errors are logged, since they do not change the outcome of the job.
+func removeFailedJob(cfg *config.AppConfig, id string) {
+	if len(cfg.MongoURL) == 0 {
+		return
+	}
+	if err := moveFailedJob(cfg.MongoURL, FailedJob{ID: id}, ""); err != nil {
+		log.WithFields(log.Fields{
+			"task":  id,
+			"error": errors.ErrorStack(err),
+		}).Error("Could not remove the record of the failed job")
+	}
+}
+
+// leased reports whether job is being retried at t.
+func (job FailedJob) leased(t time.Time) bool {
+	return t.Before(job.RetryingUntil)
+}
+
+// exhausted reports whether job has been retried maxRetries times.
+func (job FailedJob) exhausted(maxRetries int) bool {
+	return job.Attempts > maxRetries
+}
+
+// RetryFailedJobs passes every failed job in config.Config.MongoURL to queue,
+// such as the QueueTaskWithPriority of a task executer, to run it again with
+// the priority it was queued with. Jobs that have already been retried
+// config.Config.FailedJobRetries times (defaultFailedJobRetries if unset) are
+// moved to the deadletters collection instead. The record of a job is kept
+// while it is retried, leased for failedJobLease so that it is not queued
+// twice, and removed once the retry succeeds. A retry that fails replaces the
+// record with one more attempt. Retries use config.Config rather than the
+// Config of the original job, which is not stored. It returns the number of
+// jobs queued and dead-lettered.
+func RetryFailedJobs(queue func(task func(string) error, onFailure func(string, string), priority string) string) (retried int, deadLettered int, err error) {
+	cfg := config.GetConfig()
+	if len(cfg.MongoURL) == 0 {
+		return 0, 0, errors.New("failed jobs are only recorded when MongoURL is set")
+	}
+	maxRetries := cfg.FailedJobRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultFailedJobRetries
+	}
+
+	var jobs []FailedJob
+	err = withMongoCollection(cfg.MongoURL, "failedjobs", func(c *mgo.Collection) error {
+		return c.Find(nil).Sort("failedat").All(&jobs)
+	})
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+
+	for i := range jobs {
+		job := jobs[i]
+		if job.leased(now()) {
+			continue
+		}
+		if job.exhausted(maxRetries) {
+			if err := moveFailedJob(cfg.MongoURL, job, "deadletters"); err != nil {
+				return retried, deadLettered, errors.Trace(err)
+			}
+			log.WithField("task", job.ID).
+				Warnf("Gave up on the job after %d attempts: %s", job.Attempts, job.Error)
+			deadLettered++
+			continue
+		}
+
+		claimed, err := leaseFailedJob(cfg.MongoURL, job)
+		if err != nil {
+			return retried, deadLettered, errors.Trace(err)
+		}
+		if !claimed {
+			continue
+		}
+		opts := TaskOptions{Metadata: job.Metadata, Priority: job.Priority, retryOf: &job}
+		task, onFailure := MakeIBMTaskFunctionWithOptions(job.AudioURL, job.EmailAddresses, job.SearchWords, opts)
+		id := queue(task, onFailure, job.Priority)
+		log.WithField("task", job.ID).
+			Infof("Retrying the job as %s after %d attempt(s)", id, job.Attempts)
+		retried++
+	}
+	return retried, deadLettered, nil
+}
+
+// leaseFailedJob marks job as being retried for failedJobLease. It reports
+// false if another call to RetryFailedJobs leased it or recorded another
+// attempt since it was read.
+func leaseFailedJob(url string, job FailedJob) (bool, error) {
+	t := now()
+	err := withMongoCollection(url, "failedjobs", func(c *mgo.Collection) error {
+		return c.Update(bson.M{
+			"_id":      job.ID,
+			"attempts": job.Attempts,
+			"$or": []bson.M{
+				{"retryinguntil": bson.M{"$exists": false}},
+				{"retryinguntil": bson.M{"$lte": t}},
+			},
+		}, bson.M{"$set": bson.M{"retryinguntil": t.Add(failedJobLease)}})
+	})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, errors.Trace(err)
+}
+
+// moveFailedJob removes job from the failedjobs collection, after copying it
+// to the collection named to if it is not empty.
+func moveFailedJob(url string, job FailedJob, to string) error {
+	if len(to) > 0 {
+		err := withMongoCollection(url, to, func(c *mgo.Collection) error {
+			_, err := c.UpsertId(job.ID, job)
+			return err
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(withMongoCollection(url, "failedjobs", func(c *mgo.Collection) error {
+		err := c.RemoveId(job.ID)
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return err
+	}))
+}
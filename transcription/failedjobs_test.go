@@ -0,0 +1,62 @@
+package transcription
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFailedJob(t *testing.T) {
+	assert := assert.New(t)
+	defer freezeTime(time.Unix(1500000000, 0))()
+	opts := TaskOptions{Metadata: map[string]string{"customer": "c-42"}, Priority: "high"}
+
+	job := newFailedJob("first", "http://hack4impact.org/a.mp3", []string{"a@b.c"}, []string{"torch"}, opts, "boom")
+	assert.Equal(FailedJob{
+		ID:             "first",
+		AudioURL:       "http://hack4impact.org/a.mp3",
+		EmailAddresses: []string{"a@b.c"},
+		SearchWords:    []string{"torch"},
+		Metadata:       map[string]string{"customer": "c-42"},
+		Priority:       "high",
+		Error:          "boom",
+		Attempts:       1,
+		FailedAt:       time.Unix(1500000000, 0),
+	}, job)
+
+	// A failed retry keeps the id of the first attempt and counts it.
+	opts.retryOf = &job
+	retry := newFailedJob("second", job.AudioURL, job.EmailAddresses, job.SearchWords, opts, "boom again")
+	assert.Equal("first", retry.ID)
+	assert.Equal(2, retry.Attempts)
+	assert.Equal("boom again", retry.Error)
+	assert.Equal("high", retry.Priority)
+	assert.True(retry.RetryingUntil.IsZero(), "a failed retry releases its lease")
+}
+
+func TestFailedJobLeased(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Unix(1500000000, 0)
+	assert.False(FailedJob{}.leased(start))
+	job := FailedJob{RetryingUntil: start.Add(failedJobLease)}
+	assert.True(job.leased(start))
+	assert.False(job.leased(start.Add(failedJobLease)))
+}
+
+func TestFailedJobExhausted(t *testing.T) {
+	assert := assert.New(t)
+	assert.False(FailedJob{Attempts: 3}.exhausted(3))
+	assert.True(FailedJob{Attempts: 4}.exhausted(3))
+}
+
+func TestWasCancelled(t *testing.T) {
+	assert := assert.New(t)
+	_, done := RegisterJob("cancelled-job")
+	defer done()
+
+	assert.False(wasCancelled("cancelled-job"))
+	assert.True(CancelJob("cancelled-job"))
+	assert.True(wasCancelled("cancelled-job"))
+	assert.False(wasCancelled("cancelled-job"))
+}
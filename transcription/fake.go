@@ -0,0 +1,47 @@
+package transcription
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// FakeTranscriber is a Transcriber that returns canned results without
+// touching the network, so that the whole pipeline can be tested. Results and
+// Errors are keyed by the file name of the chunk, such as 0_audio.wav.flac.
+// Chunks with neither get Default, or an error if it is nil.
+type FakeTranscriber struct {
+	Results map[string]*Transcription
+	Errors  map[string]error
+	Default *Transcription
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// Transcribe implements Transcriber.
+func (f *FakeTranscriber) Transcribe(id string, filePath string, searchWords []string) (*Transcription, error) {
+	name := filepath.Base(filePath)
+	f.mu.Lock()
+	f.calls = append(f.calls, name)
+	f.mu.Unlock()
+
+	if err, ok := f.Errors[name]; ok {
+		return nil, err
+	}
+	if result, ok := f.Results[name]; ok {
+		return result, nil
+	}
+	if f.Default != nil {
+		return f.Default, nil
+	}
+	return nil, errors.NotFoundf("fake result for %s", name)
+}
+
+// Calls returns the file names of the chunks transcribed so far, in order.
+func (f *FakeTranscriber) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
@@ -0,0 +1,50 @@
+package transcription
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestFakeTranscriber(t *testing.T) {
+	assert := assert.New(t)
+	fake := &FakeTranscriber{
+		Results: map[string]*Transcription{"0_a.wav.flac": {Transcript: "first"}},
+		Errors:  map[string]error{"1_a.wav.flac": errors.New("boom")},
+	}
+
+	result, err := fake.Transcribe("id", "/tmp/job/0_a.wav.flac", nil)
+	assert.NoError(err)
+	assert.Equal("first", result.Transcript)
+	_, err = fake.Transcribe("id", "1_a.wav.flac", nil)
+	assert.EqualError(err, "boom")
+	_, err = fake.Transcribe("id", "2_a.wav.flac", nil)
+	assert.Error(err)
+	assert.Equal([]string{"0_a.wav.flac", "1_a.wav.flac", "2_a.wav.flac"}, fake.Calls())
+}
+
+func TestTranscribeChunkWithFake(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &config.AppConfig{ChunkRetries: -1}
+
+	fake := &FakeTranscriber{Default: &Transcription{
+		Transcript:  "hello world ",
+		Timestamps:  []timestamp{{"hello", 0, 0.5}, {"world", 0.5, 1}},
+		Confidences: []confidence{{"hello", 0.9}, {"world", 0.7}},
+		IBMKeywords: []ibmKeywordResult{{"world", 0.5, 1, 0.8}},
+	}}
+	first, err := transcribeChunk(context.Background(), cfg, fake, "id", "0_a.wav.flac", nil, "")
+	assert.NoError(err)
+	second, err := transcribeChunk(context.Background(), cfg, fake, "id", "1_a.wav.flac", nil, "")
+	assert.NoError(err)
+
+	transcription := GetTranscription([]*IBMResult{first, second})
+	assert.Equal("hello world hello world ", transcription.Transcript)
+	assert.Len(transcription.Timestamps, 4)
+	assert.Equal(confidence{"world", 0.7}, transcription.Confidences[3])
+	assert.Equal([]ibmKeywordResult{{"world", 0.5, 1, 0.8}, {"world", 0.5, 1, 0.8}}, transcription.IBMKeywords)
+}
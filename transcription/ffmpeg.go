@@ -0,0 +1,97 @@
+package transcription
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+const (
+	defaultFFmpegRetries = 2
+	ffmpegRetryDelay     = 500 * time.Millisecond
+)
+
+// transientFFmpegMessages are the errors ffmpeg prints when the system is
+// temporarily overloaded.
+var transientFFmpegMessages = []string{
+	"Resource temporarily unavailable",
+	"Cannot allocate memory",
+	"Too many open files",
+}
+
+// ErrFFmpegNotInstalled is the cause of the error returned when the ffmpeg or
+// ffprobe executables cannot be found.
+var ErrFFmpegNotInstalled = errors.New("ffmpeg is not installed: install ffmpeg (which includes ffprobe) and make sure it is in your $PATH")
+
+// CheckFFmpeg returns ErrFFmpegNotInstalled if ffmpeg or ffprobe is missing.
+func CheckFFmpeg() error {
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(name); err != nil {
+			return ErrFFmpegNotInstalled
+		}
+	}
+	return nil
+}
+
+// runFFmpeg runs ffmpeg with args, returning its output in the error if it
+// fails.
+func runFFmpeg(args ...string) error {
+	_, err := runFFmpegOutput(args...)
+	return err
+}
+
+// runFFmpegOutput runs ffmpeg with args and returns its combined output, which
+// is where filters such as silencedetect report their results. Transient
+// failures are retried up to config.Config.FFmpegRetries times
+// (defaultFFmpegRetries if unset, none if negative).
+func runFFmpegOutput(args ...string) (string, error) {
+	retries := config.GetConfig().FFmpegRetries
+	if retries == 0 {
+		retries = defaultFFmpegRetries
+	} else if retries < 0 {
+		retries = 0
+	}
+
+	delay := ffmpegRetryDelay
+	for attempt := 0; ; attempt++ {
+		cmd := exec.Command("ffmpeg", args...)
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			return string(out), nil
+		}
+		if isNotInstalled(err) {
+			return "", ErrFFmpegNotInstalled
+		}
+		if attempt == retries || !isTransientFFmpegFailure(string(out)) {
+			return "", errors.New(err.Error() + "\nCommand Output:" + string(out))
+		}
+		log.Debugf("ffmpeg failed transiently, retrying in %v: %v", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransientFFmpegFailure reports whether the output of a failed ffmpeg run
+// shows that it ran out of system resources, rather than that the input is
+// bad, so that it may succeed if run again.
+func isTransientFFmpegFailure(out string) bool {
+	for _, message := range transientFFmpegMessages {
+		if strings.Contains(out, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotInstalled reports whether err means that the executable was not found.
+func isNotInstalled(err error) bool {
+	if execErr, ok := err.(*exec.Error); ok {
+		return execErr.Err == exec.ErrNotFound
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package transcription
+
+import (
+	"os"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingFFmpeg(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", "")
+
+	assert.Equal(ErrFFmpegNotInstalled, CheckFFmpeg())
+	assert.Equal(ErrFFmpegNotInstalled, runFFmpeg("-version"))
+	_, err := ProbeAudio("file.mp3")
+	assert.Equal(ErrFFmpegNotInstalled, errors.Cause(err))
+}
+
+func TestIsTransientFFmpegFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isTransientFFmpegFailure("[pipe @ 0x1] pipe:: Resource temporarily unavailable"))
+	assert.False(isTransientFFmpegFailure("in.mp3: Invalid data found when processing input"))
+}
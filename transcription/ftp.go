@@ -0,0 +1,241 @@
+package transcription
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/textproto"
+	neturl "net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+const ftpTimeout = 30 * time.Second
+
+// ErrCurlNotInstalled is the cause of the error returned when an sftp:// URL
+// is downloaded without curl, which does the SFTP transfer.
+var ErrCurlNotInstalled = errors.New("curl is not installed: install curl with SFTP support to download sftp:// URLs")
+
+// remoteCredentials returns the username and password in u, or those in
+// config.Config if u has none and is on config.Config.FTPHost. FTP falls back
+// to an anonymous login.
+func remoteCredentials(u *neturl.URL) (string, string) {
+	if u.User != nil {
+		password, _ := u.User.Password()
+		return u.User.Username(), password
+	}
+	// The username and password are read together, since they may be
+	// replaced at any time.
+	if cfg := config.GetConfig(); len(cfg.FTPUsername) > 0 && isConfiguredFTPHost(&cfg, u) {
+		return cfg.FTPUsername, cfg.FTPPassword
+	}
+	if u.Scheme == "ftp" {
+		return "anonymous", "anonymous"
+	}
+	return "", ""
+}
+
+// isConfiguredFTPHost reports whether u is on cfg.FTPHost, the only host the
+// configured credentials are sent to, so that a job cannot leak them to a
+// host of its choosing.
+func isConfiguredFTPHost(cfg *config.AppConfig, u *neturl.URL) bool {
+	return len(cfg.FTPHost) > 0 && strings.EqualFold(u.Hostname(), cfg.FTPHost)
+}
+
+// downloadFTPToDir downloads the file at the ftp:// url into dir, enforcing
+// config.Config.MaxDownloadBytes.
+func downloadFTPToDir(url string, dir string) (string, error) {
+	filePath := filepath.Join(dir, filePathFromURL(url))
+	file, err := createTempFile(filePath)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer file.Close()
+
+	maxBytes := config.GetConfig().MaxDownloadBytes
+	var limit int64
+	if maxBytes > 0 {
+		limit = maxBytes + 1
+	}
+	written, err := downloadFTP(url, file, limit)
+	if err != nil {
+		os.Remove(filePath)
+		return "", errors.Trace(err)
+	}
+	if maxBytes > 0 && written > maxBytes {
+		os.Remove(filePath)
+		return "", errors.Annotatef(ErrFileTooLarge, "%s is larger than %d bytes", url, maxBytes)
+	}
+	return filePath, nil
+}
+
+// downloadSFTPToDir downloads the file at the sftp:// url into dir.
+func downloadSFTPToDir(url string, dir string) (string, error) {
+	filePath := filepath.Join(dir, filePathFromURL(url))
+	if err := downloadSFTP(url, filePath); err != nil {
+		return "", errors.Trace(err)
+	}
+	return filePath, nil
+}
+
+// downloadFTP writes the file at the ftp:// url to w, stopping after limit
+// bytes if limit is positive, and returns the number of bytes written.
+func downloadFTP(url string, w io.Writer, limit int64) (int64, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	host := u.Host
+	if len(u.Port()) == 0 {
+		host = net.JoinHostPort(u.Hostname(), "21")
+	}
+
+	conn, err := net.DialTimeout("tcp", host, ftpTimeout)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer conn.Close()
+	control := textproto.NewConn(conn)
+	if _, _, err := control.ReadResponse(220); err != nil {
+		return 0, errors.Annotate(err, "FTP server did not greet")
+	}
+
+	username, password := remoteCredentials(u)
+	code, _, err := ftpCommand(control, "USER "+username)
+	if err == nil && code == 331 {
+		code, _, err = ftpCommand(control, "PASS "+password)
+	}
+	if err != nil || code != 230 {
+		return 0, errors.Annotatef(ftpError(code, err), "could not log in to %s as %s", u.Host, username)
+	}
+	if code, _, err := ftpCommand(control, "TYPE I"); err != nil || code != 200 {
+		return 0, errors.Annotate(ftpError(code, err), "could not switch to binary mode")
+	}
+
+	dataAddr, err := ftpPassive(control, u.Hostname())
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	data, err := net.DialTimeout("tcp", dataAddr, ftpTimeout)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer data.Close()
+
+	if code, message, err := ftpCommand(control, "RETR "+u.Path); err != nil || (code != 125 && code != 150) {
+		return 0, errors.Annotatef(ftpError(code, err), "could not retrieve %s: %s", u.Path, message)
+	}
+	var body io.Reader = data
+	if limit > 0 {
+		body = io.LimitReader(data, limit)
+	}
+	written, err := io.Copy(w, body)
+	data.Close()
+	if err != nil {
+		return written, errors.Trace(err)
+	}
+	if limit > 0 && written >= limit {
+		// The transfer was cut short, so its completion is not waited for.
+		return written, nil
+	}
+	if _, _, err := control.ReadResponse(226); err != nil {
+		return written, errors.Annotatef(err, "transfer of %s did not complete", u.Path)
+	}
+	ftpCommand(control, "QUIT")
+	return written, nil
+}
+
+// ftpCommand sends a command and reads the reply, whatever its code.
+func ftpCommand(control *textproto.Conn, command string) (int, string, error) {
+	if err := control.PrintfLine("%s", command); err != nil {
+		return 0, "", errors.Trace(err)
+	}
+	code, message, err := control.ReadResponse(0)
+	if _, ok := err.(*textproto.Error); ok {
+		err = nil
+	}
+	return code, message, errors.Trace(err)
+}
+
+func ftpError(code int, err error) error {
+	if err != nil {
+		return err
+	}
+	return errors.Errorf("FTP server replied %d", code)
+}
+
+var pasvPattern = regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+
+// ftpPassive asks the server for a data connection and returns its address.
+// The address the server reports in PASV replies is ignored in favor of the
+// control host, since servers behind NAT often report a private address.
+func ftpPassive(control *textproto.Conn, host string) (string, error) {
+	code, message, err := ftpCommand(control, "EPSV")
+	if err == nil && code == 229 {
+		// 229 Entering Extended Passive Mode (|||6446|)
+		fields := strings.Split(message[strings.Index(message, "(")+1:], "|")
+		if len(fields) >= 4 {
+			if _, err := strconv.Atoi(fields[3]); err == nil {
+				return net.JoinHostPort(host, fields[3]), nil
+			}
+		}
+	}
+
+	code, message, err = ftpCommand(control, "PASV")
+	if err != nil || code != 227 {
+		return "", errors.Annotate(ftpError(code, err), "could not enter passive mode")
+	}
+	match := pasvPattern.FindStringSubmatch(message)
+	if match == nil {
+		return "", errors.Errorf("could not parse passive mode reply %q", message)
+	}
+	high, _ := strconv.Atoi(match[5])
+	low, _ := strconv.Atoi(match[6])
+	return net.JoinHostPort(host, strconv.Itoa(high*256+low)), nil
+}
+
+// downloadSFTP downloads the file at the sftp:// url to filePath with curl.
+// Credentials are passed to curl on its standard input rather than its
+// command line, where other users could see them.
+func downloadSFTP(url string, filePath string) error {
+	cfg := config.GetConfig()
+	if _, err := exec.LookPath("curl"); err != nil {
+		return ErrCurlNotInstalled
+	}
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	username, password := remoteCredentials(u)
+	u.User = nil
+
+	var curlConfig bytes.Buffer
+	curlConfig.WriteString("url = " + strconv.Quote(u.String()) + "\n")
+	curlConfig.WriteString("output = " + strconv.Quote(filePath) + "\n")
+	if len(username) > 0 {
+		curlConfig.WriteString("user = " + strconv.Quote(username+":"+password) + "\n")
+	}
+	if len(cfg.SFTPKeyFile) > 0 && isConfiguredFTPHost(&cfg, u) {
+		curlConfig.WriteString("key = " + strconv.Quote(cfg.SFTPKeyFile) + "\n")
+	}
+	if cfg.MaxDownloadBytes > 0 {
+		curlConfig.WriteString("max-filesize = " + strconv.FormatInt(cfg.MaxDownloadBytes, 10) + "\n")
+	}
+
+	cmd := exec.Command("curl", "--silent", "--show-error", "--config", "-")
+	cmd.Stdin = &curlConfig
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(filePath)
+		return errors.Annotatef(err, "could not download %s: %s", u.String(), strings.TrimSpace(string(out)))
+	}
+	return errors.Trace(restrictTempFile(filePath))
+}
@@ -0,0 +1,135 @@
+package transcription
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	neturl "net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// serveFTP runs a minimal passive-mode FTP server on a local port that serves
+// content at any path to the given user, and returns its address.
+func serveFTP(t *testing.T, user, pass, content string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 ready\r\n")
+		var data net.Listener
+		loggedIn := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+			arg := ""
+			if len(fields) > 1 {
+				arg = fields[1]
+			}
+			switch fields[0] {
+			case "USER":
+				loggedIn = arg == user
+				fmt.Fprint(conn, "331 password please\r\n")
+			case "PASS":
+				if !loggedIn || arg != pass {
+					fmt.Fprint(conn, "530 login incorrect\r\n")
+					return
+				}
+				fmt.Fprint(conn, "230 logged in\r\n")
+			case "TYPE":
+				fmt.Fprint(conn, "200 ok\r\n")
+			case "EPSV":
+				data, _ = net.Listen("tcp", "127.0.0.1:0")
+				fmt.Fprintf(conn, "229 Entering Extended Passive Mode (|||%d|)\r\n", data.Addr().(*net.TCPAddr).Port)
+			case "RETR":
+				fmt.Fprint(conn, "150 sending\r\n")
+				dataConn, err := data.Accept()
+				if err != nil {
+					return
+				}
+				fmt.Fprint(dataConn, content)
+				dataConn.Close()
+				data.Close()
+				fmt.Fprint(conn, "226 done\r\n")
+			case "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "502 not implemented\r\n")
+			}
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDownloadFTP(t *testing.T) {
+	assert := assert.New(t)
+	addr := serveFTP(t, "alice", "secret", "RIFF audio")
+	dir, err := ioutil.TempDir("", "ftp-test")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	filePath, err := downloadFileToDir("ftp://alice:secret@"+addr+"/recordings/a.wav", dir)
+	if assert.NoError(err) {
+		assert.True(strings.HasSuffix(filePath, ".wav"))
+		content, _ := ioutil.ReadFile(filePath)
+		assert.Equal("RIFF audio", string(content))
+	}
+}
+
+func TestDownloadFTPBadLogin(t *testing.T) {
+	assert := assert.New(t)
+	addr := serveFTP(t, "alice", "secret", "RIFF audio")
+	dir, err := ioutil.TempDir("", "ftp-test")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	_, err = downloadFileToDir("ftp://alice:wrong@"+addr+"/a.wav", dir)
+	assert.Error(err)
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(files)
+}
+
+func TestRemoteCredentialsOnlyGoToFTPHost(t *testing.T) {
+	assert := assert.New(t)
+	defer func(cfg config.AppConfig) { config.Config = cfg }(config.Config)
+	config.Config.FTPHost = "ftp.partner.com"
+	config.Config.FTPUsername = "partner"
+	config.Config.FTPPassword = "secret"
+
+	u, _ := neturl.Parse("ftp://FTP.partner.com/a.wav")
+	username, password := remoteCredentials(u)
+	assert.Equal("partner", username)
+	assert.Equal("secret", password)
+
+	u, _ = neturl.Parse("ftp://attacker.example/a.wav")
+	username, password = remoteCredentials(u)
+	assert.Equal("anonymous", username)
+	assert.Equal("anonymous", password)
+
+	u, _ = neturl.Parse("sftp://attacker.example/a.wav")
+	username, _ = remoteCredentials(u)
+	assert.Empty(username)
+
+	u, _ = neturl.Parse("ftp://bob:pw@attacker.example/a.wav")
+	username, password = remoteCredentials(u)
+	assert.Equal("bob", username)
+	assert.Equal("pw", password)
+}
@@ -0,0 +1,48 @@
+package transcription
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// hashedContent is the canonical serialization of the parts of a
+// Transcription covered by its Hash. Its fields must never change, or stored
+// hashes would no longer verify.
+type hashedContent struct {
+	Transcript string
+	Timestamps []timestamp
+}
+
+// transcriptionHash returns the hex SHA-256 of the canonical serialization of
+// the transcript and timestamps of t.
+func transcriptionHash(t *Transcription) string {
+	timestamps := t.Timestamps
+	if timestamps == nil {
+		timestamps = []timestamp{}
+	}
+	// Marshaling a struct always gives the same bytes for the same values.
+	data, _ := json.Marshal(hashedContent{t.Transcript, timestamps})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// setHash sets the Hash of t if cfg.HashTranscriptions is set.
+func (t *Transcription) setHash(cfg *config.AppConfig) {
+	if cfg.HashTranscriptions {
+		t.Hash = transcriptionHash(t)
+	}
+}
+
+// VerifyTranscriptionHash reports whether the transcript and timestamps of t
+// are unchanged since its Hash was computed. It is false if t has no Hash.
+// Anything that changes them afterwards, such as Anonymize, invalidates it.
+func VerifyTranscriptionHash(t *Transcription) bool {
+	if len(t.Hash) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(t.Hash), []byte(transcriptionHash(t))) == 1
+}
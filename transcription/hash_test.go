@@ -0,0 +1,38 @@
+package transcription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestTranscriptionHash(t *testing.T) {
+	assert := assert.New(t)
+	defer func(enabled bool) { config.Config.HashTranscriptions = enabled }(config.Config.HashTranscriptions)
+	config.Config.HashTranscriptions = true
+
+	transcription := GetTranscription([]*IBMResult{ibmResultFromTranscription(&Transcription{
+		Transcript: "hello world ",
+		Timestamps: []timestamp{{"hello", 0, 0.5}, {"world", 0.5, 1}},
+	})})
+	assert.Len(transcription.Hash, 64)
+	assert.True(VerifyTranscriptionHash(transcription))
+
+	// Fields outside the transcript and timestamps are not covered.
+	transcription.Summary = "A greeting."
+	assert.True(VerifyTranscriptionHash(transcription))
+
+	transcription.Timestamps[1].EndTime = 2
+	assert.False(VerifyTranscriptionHash(transcription))
+	transcription.Timestamps[1].EndTime = 1
+	transcription.Transcript = "hello word "
+	assert.False(VerifyTranscriptionHash(transcription))
+}
+
+func TestTranscriptionHashIsOptional(t *testing.T) {
+	transcription := GetTranscription([]*IBMResult{ibmResultFromTranscription(&Transcription{Transcript: "hello "})})
+	assert.Empty(t, transcription.Hash)
+	assert.False(t, VerifyTranscriptionHash(transcription))
+}
@@ -0,0 +1,136 @@
+package transcription
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+type transportKey struct {
+	caCertFile string
+	httpProxy  string
+}
+
+// transports holds the transports built for each CACertFile and HTTPProxy,
+// so that clients share their connections and the CA file is read once.
+var transports = struct {
+	sync.Mutex
+	byKey      map[transportKey]*http.Transport
+	tlsConfigs map[string]*tls.Config
+}{byKey: make(map[transportKey]*http.Transport), tlsConfigs: make(map[string]*tls.Config)}
+
+// downloadClient returns the client that fetches audio, which goes through
+// config.Config.HTTPProxy if it is set instead of the proxy in the
+// environment. A timeout of zero means none.
+func downloadClient(timeout time.Duration) (*http.Client, error) {
+	transport, err := downloadTransport()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+func downloadTransport() (*http.Transport, error) {
+	cfg := config.GetConfig()
+	return cachedTransport(transportKey{caCertFile: cfg.CACertFile, httpProxy: cfg.HTTPProxy})
+}
+
+// apiClient returns the client for IBM and the storage services, which
+// trusts the CAs in config.Config.CACertFile as well as the system's. A
+// timeout of zero means none.
+func apiClient(timeout time.Duration) (*http.Client, error) {
+	transport, err := apiTransport()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+func apiTransport() (*http.Transport, error) {
+	cfg := config.GetConfig()
+	return cachedTransport(transportKey{caCertFile: cfg.CACertFile})
+}
+
+// cachedTransport returns the transport for key, building it the first time.
+// Errors are not cached, so a fixed configuration is picked up.
+func cachedTransport(key transportKey) (*http.Transport, error) {
+	transports.Lock()
+	defer transports.Unlock()
+	if transport, ok := transports.byKey[key]; ok {
+		return transport, nil
+	}
+	transport := newTransport()
+	tlsConfig, err := cachedTLSConfig(key.caCertFile)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	transport.TLSClientConfig = tlsConfig
+	if len(key.httpProxy) > 0 {
+		proxy, err := neturl.Parse(key.httpProxy)
+		if err != nil || len(proxy.Host) == 0 {
+			return nil, errors.NotValidf("HTTPProxy %q", key.httpProxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	transports.byKey[key] = transport
+	return transport, nil
+}
+
+// newTransport returns a transport with the settings of
+// http.DefaultTransport.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// clientTLSConfig returns the TLS config that trusts the PEM certificates in
+// config.Config.CACertFile in addition to the system's, or nil if it is unset.
+func clientTLSConfig() (*tls.Config, error) {
+	cfg := config.GetConfig()
+	transports.Lock()
+	defer transports.Unlock()
+	return cachedTLSConfig(cfg.CACertFile)
+}
+
+// cachedTLSConfig is clientTLSConfig for caCertFile. transports must be
+// locked.
+func cachedTLSConfig(caCertFile string) (*tls.Config, error) {
+	if len(caCertFile) == 0 {
+		return nil, nil
+	}
+	if tlsConfig, ok := transports.tlsConfigs[caCertFile]; ok {
+		return tlsConfig, nil
+	}
+	pem, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return nil, errors.Annotate(err, "could not read CACertFile")
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("CACertFile %s contains no PEM certificates", caCertFile)
+	}
+	tlsConfig := &tls.Config{RootCAs: pool}
+	transports.tlsConfigs[caCertFile] = tlsConfig
+	return tlsConfig, nil
+}
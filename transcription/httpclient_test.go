@@ -0,0 +1,87 @@
+package transcription
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestDownloadThroughProxy(t *testing.T) {
+	assert := assert.New(t)
+	defer freezeTime(time.Unix(0, 9))()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxy is sent the absolute URL.
+		assert.Equal("http://audio.invalid/talk.wav", r.URL.String())
+		w.Write([]byte("RIFF"))
+	}))
+	defer proxy.Close()
+	defer func(proxy string) { config.Config.HTTPProxy = proxy }(config.Config.HTTPProxy)
+	config.Config.HTTPProxy = proxy.URL
+
+	filePath, err := DownloadFileFromURL("http://audio.invalid/talk.wav")
+	assert.NoError(err)
+	defer os.Remove(filePath)
+	contents, _ := ioutil.ReadFile(filePath)
+	assert.Equal("RIFF", string(contents))
+}
+
+func TestDownloadClientRejectsInvalidProxy(t *testing.T) {
+	defer func(proxy string) { config.Config.HTTPProxy = proxy }(config.Config.HTTPProxy)
+	config.Config.HTTPProxy = "not a url"
+
+	_, err := downloadClient(0)
+	assert.Error(t, err)
+}
+
+func TestAPIClientTrustsCACertFile(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := apiClient(0)
+	assert.NoError(err)
+	_, err = client.Get(server.URL)
+	assert.Error(err, "the test server's certificate is self-signed")
+
+	caFile, err := ioutil.TempFile("", "ca")
+	assert.NoError(err)
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	caFile.Close()
+	defer func(file string) { config.Config.CACertFile = file }(config.Config.CACertFile)
+	config.Config.CACertFile = caFile.Name()
+
+	client, err = apiClient(0)
+	assert.NoError(err)
+	resp, err := client.Get(server.URL)
+	if assert.NoError(err) {
+		resp.Body.Close()
+	}
+
+	config.Config.CACertFile = os.DevNull
+	_, err = apiClient(0)
+	assert.Error(err)
+}
+
+func TestClientsShareTransports(t *testing.T) {
+	assert := assert.New(t)
+	first, err := apiClient(0)
+	assert.NoError(err)
+	second, err := apiClient(time.Second)
+	assert.NoError(err)
+	assert.True(first.Transport == second.Transport)
+
+	defer func(proxy string) { config.Config.HTTPProxy = proxy }(config.Config.HTTPProxy)
+	config.Config.HTTPProxy = "http://proxy.invalid:3128"
+	download, err := downloadClient(0)
+	assert.NoError(err)
+	assert.False(first.Transport == download.Transport)
+}
@@ -3,15 +3,28 @@ package transcription
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"io"
+	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/websocket"
 	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
 )
 
 // IBMResult is the result of an IBM transcription. See
@@ -31,6 +44,9 @@ type ibmAlternativesField struct {
 	OverallConfidence float64             `json:"confidence"`
 	Transcript        string              `json:"transcript"`
 	Timestamps        []ibmWordTimestamp  `json:"timestamps"`
+	// Approximate is set when the timestamps were interpolated by
+	// interpolateResultTimes rather than given by the engine.
+	Approximate bool `json:"approximate,omitempty"`
 }
 type ibmWordConfidence [2]interface{}
 type ibmWordTimestamp [3]interface{}
@@ -42,48 +58,260 @@ type ibmKeywordResult struct {
 	Confidence float64 `json:"confidence"`
 }
 
+// ibmMessage is any message IBM sends over the websocket. Besides results, IBM
+// sends a "listening" state once it is ready for audio and again once it has
+// finished with the audio.
+type ibmMessage struct {
+	IBMResult
+	State string `json:"state"`
+	Error string `json:"error"`
+}
+
+const ibmAPIURL = "https://stream.watsonplatform.net/speech-to-text/api/v1"
+
+const (
+	// wideSampleRate is the sample rate audio is converted to for IBM's
+	// broadband models.
+	wideSampleRate = 16000
+	// narrowSampleRate is the sample rate of IBM's narrowband models, which
+	// are meant for telephone audio.
+	narrowSampleRate          = 8000
+	defaultIBMModel           = "en-US_BroadbandModel"
+	defaultIBMNarrowbandModel = "en-US_NarrowbandModel"
+)
+
+// ibmModel returns cfg.IBMModel, or defaultIBMModel if it is unset.
+func ibmModel(cfg *config.AppConfig) string {
+	if len(cfg.IBMModel) > 0 {
+		return cfg.IBMModel
+	}
+	return defaultIBMModel
+}
+
+// ibmInactivityTimeout returns the seconds of silence after which IBM ends a
+// recognition, which is config.Config.IBMInactivityTimeout rounded up, or -1
+// so that long silences never end it if that is not set.
+func ibmInactivityTimeout(cfg *config.AppConfig) int {
+	if cfg.IBMInactivityTimeout.Duration <= 0 {
+		return -1
+	}
+	return int(math.Ceil(cfg.IBMInactivityTimeout.Seconds()))
+}
+
+// withIBMCredentials returns a copy of config.Config that uses the given IBM
+// account, for the functions that take the credentials explicitly.
+func withIBMCredentials(IBMUsername string, IBMPassword string) *config.AppConfig {
+	cfg := config.GetConfig()
+	cfg.IBMUsername = IBMUsername
+	cfg.IBMPassword = IBMPassword
+	return &cfg
+}
+
+// ibmAudioSettings returns the sample rate to convert the audio described by
+// info to and the IBM model to transcribe it with. Audio sampled below
+// wideSampleRate would gain nothing from upsampling, so it is converted to
+// narrowSampleRate for the narrowband model instead.
+func ibmAudioSettings(cfg *config.AppConfig, info *AudioInfo) (int, string) {
+	if info.SampleRate > 0 && info.SampleRate < wideSampleRate {
+		model := cfg.IBMNarrowbandModel
+		if len(model) == 0 {
+			model = defaultIBMNarrowbandModel
+		}
+		return narrowSampleRate, model
+	}
+	return wideSampleRate, ibmModel(cfg)
+}
+
+// ibmQueryParams are the recognize parameters IBM takes in the websocket URL
+// rather than in the start message.
+var ibmQueryParams = map[string]bool{
+	"customization_id":          true,
+	"acoustic_customization_id": true,
+	"base_model_version":        true,
+	"customization_weight":      true,
+	"version":                   true,
+	"x-watson-learning-opt-out": true,
+	"x-watson-metadata":         true,
+	"language_customization_id": true,
+}
+
+// ibmRecognizeParams sorts extra recognize parameters, such as those in
+// config.Config.IBMParams, into the ones sent in the URL and the ones added to
+// the start message. Values in the start message are sent as booleans or
+// numbers when they look like one, since IBM rejects "true" for a boolean.
+// The parameters are only checked loosely, so that ones IBM adds later can be
+// used without a code change.
+func ibmRecognizeParams(params map[string]string) (neturl.Values, map[string]interface{}, error) {
+	query := neturl.Values{}
+	args := make(map[string]interface{})
+	for key, value := range params {
+		switch {
+		case !ibmParamPattern.MatchString(key):
+			return nil, nil, errors.NotValidf("IBM parameter %q", key)
+		case key == "action" || key == "content-type" || key == "model":
+			return nil, nil, errors.Errorf("IBM parameter %q cannot be overridden", key)
+		case ibmQueryParams[key]:
+			query.Set(key, value)
+		default:
+			args[key] = ibmParamValue(value)
+		}
+	}
+	return query, args, nil
+}
+
+var ibmParamPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+func ibmParamValue(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	return value
+}
+
+// ErrBadIBMCredentials is returned when IBM rejects the configured username
+// and password.
+var ErrBadIBMCredentials = errors.New("bad IBM credentials")
+
+// Model is a speech recognition model offered by IBM.
+type Model struct {
+	Name        string `json:"name"`
+	Language    string `json:"language"`
+	Rate        int    `json:"rate"`
+	Description string `json:"description"`
+}
+
+// VerifyIBMCredentials checks that IBM accepts the given username and password
+// by listing the available models, which is much cheaper than a transcription.
+func VerifyIBMCredentials(username, password string) error {
+	_, err := ListIBMModels(username, password)
+	return err
+}
+
+// ListIBMModels returns the models IBM can transcribe with, such as
+// en-US_BroadbandModel.
+func ListIBMModels(username, password string) ([]Model, error) {
+	req, err := http.NewRequest("GET", ibmAPIURL+"/models", nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	req.SetBasicAuth(username, password)
+
+	client, err := apiClient(30 * time.Second)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, ErrBadIBMCredentials
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.Errorf("unexpected response from IBM: %s", resp.Status)
+	}
+
+	var models struct {
+		Models []Model `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		return nil, errors.Annotate(err, "could not decode IBM models")
+	}
+	return models.Models, nil
+}
+
 // TranscribeWithIBM transcribes a given audio file using the IBM Watson
-// Speech To Text API
+// Speech To Text API. It is TranscribeWithIBMID with a new job id.
 func TranscribeWithIBM(filePath string, searchWords []string, IBMUsername string, IBMPassword string) (*IBMResult, error) {
-	result := new(IBMResult)
+	return TranscribeWithIBMID(GenerateJobID(), filePath, searchWords, IBMUsername, IBMPassword)
+}
 
-	url := "wss://stream.watsonplatform.net/speech-to-text/api/v1/recognize?model=en-US_BroadbandModel"
-	header := http.Header{}
-	header.Set("Authorization", "Basic "+basicAuth(IBMUsername, IBMPassword))
+// TranscribeWithIBMID is like TranscribeWithIBM for the task id. The id is
+// sent to IBM as the X-Request-ID header, and the transaction id IBM returns
+// is logged and attached to any error so that it can be given to IBM support.
+func TranscribeWithIBMID(id string, filePath string, searchWords []string, IBMUsername string, IBMPassword string) (*IBMResult, error) {
+	return TranscribeWithIBMContext(context.Background(), id, filePath, searchWords, IBMUsername, IBMPassword)
+}
 
-	dialer := websocket.DefaultDialer
-	ws, _, err := dialer.Dial(url, header)
+// TranscribeWithIBMContext is like TranscribeWithIBMID, but gives up when ctx
+// is done or, if config.Config.IBMTimeout is set, when the transcription
+// takes longer than that.
+func TranscribeWithIBMContext(ctx context.Context, id string, filePath string, searchWords []string, IBMUsername string, IBMPassword string) (*IBMResult, error) {
+	cfg := withIBMCredentials(IBMUsername, IBMPassword)
+	return transcribeFileWithIBM(ctx, cfg, id, filePath, searchWords, ibmModel(cfg))
+}
+
+// transcribeFileWithIBM is TranscribeWithIBMContext with the IBM account and
+// settings in cfg and the given model.
+func transcribeFileWithIBM(ctx context.Context, cfg *config.AppConfig, id string, filePath string, searchWords []string, model string) (*IBMResult, error) {
+	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	defer ws.Close()
+	defer f.Close()
 
-	requestArgs := map[string]interface{}{
-		"action":             "start",
-		"content-type":       "audio/flac",
-		"continuous":         true,
-		"word_confidence":    true,
-		"timestamps":         true,
-		"profanity_filter":   false,
-		"interim_results":    false,
-		"inactivity_timeout": -1,
-		"keywords":           searchWords,
-		"keywords_threshold": 0.5,
+	contentType := "audio/flac"
+	if strings.ToLower(filepath.Ext(filePath)) == ".wav" {
+		contentType = "audio/wav"
 	}
+	return transcribeReaderWithIBM(ctx, cfg, id, filepath.Base(filePath), f, contentType, searchWords, model)
+}
 
-	if err = ws.WriteJSON(requestArgs); err != nil {
+// TranscribeReaderWithIBM is like TranscribeWithIBMContext, but streams audio
+// that is already in a format IBM accepts from r instead of reading a file.
+// The contentType is the MIME type of the audio, such as audio/flac or
+// audio/wav.
+func TranscribeReaderWithIBM(ctx context.Context, id string, r io.Reader, contentType string, searchWords []string, IBMUsername string, IBMPassword string) (*IBMResult, error) {
+	name := "stream" + strconv.Itoa(int(now().UnixNano()))
+	cfg := withIBMCredentials(IBMUsername, IBMPassword)
+	return transcribeReaderWithIBM(ctx, cfg, id, name, r, contentType, searchWords, ibmModel(cfg))
+}
+
+// transcribeReaderWithIBM transcribes the audio in r with the IBM model, using
+// the IBM account and settings in cfg. The name identifies the audio in logs
+// and raw response files.
+func transcribeReaderWithIBM(ctx context.Context, cfg *config.AppConfig, id string, name string, r io.Reader, contentType string, searchWords []string, model string) (*IBMResult, error) {
+	// Waiting for the limiter does not count towards the IBM timeout.
+	release, err := acquireIBM(ctx)
+	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	log.Debug("Starting transcription using IBM")
+	defer release()
 
-	if err = uploadFileWithWebsocket(ws, filePath); err != nil {
-		return nil, errors.Trace(err)
+	// The context is always cancelled on return, which stops the goroutine
+	// that closes the websocket.
+	var cancel context.CancelFunc
+	if cfg.IBMTimeout.Duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cfg.IBMTimeout.Duration)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
 	}
-	log.Debugf("Successfully uploaded %s to IBM", filePath)
+	defer cancel()
+	result := new(IBMResult)
+
+	ws, logger, transactionID, err := startIBMRecognition(ctx, cfg, id, contentType, searchWords, model)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Close()
+	logger.Debug("Starting transcription using IBM")
+
+	if err = uploadWithWebsocket(ws, r); err != nil {
+		return nil, annotateIBMError(contextError(ctx, err), transactionID)
+	}
+	logger.Debugf("Successfully uploaded %s to IBM", name)
 
 	// write empty message to indicate end of uploading file
 	if err = ws.WriteMessage(websocket.BinaryMessage, []byte{}); err != nil {
-		return nil, errors.Trace(err)
+		return nil, annotateIBMError(contextError(ctx, err), transactionID)
 	}
 
 	// IBM must receive a message every 30 seconds or it will close the websocket.
@@ -93,30 +321,163 @@ func TranscribeWithIBM(filePath string, searchWords []string, IBMUsername string
 	go keepConnectionOpen(ws, ticker, quit)
 	defer close(quit)
 
+	var raw io.Writer = ioutil.Discard
+	if cfg.SaveRawIBMResponses {
+		rawFile, err := createRawIBMResponseFile(cfg, id, name)
+		if err != nil {
+			logger.Warnf("Could not save raw IBM responses: %v", err)
+		} else {
+			logger.Debugf("Saving raw IBM responses to %s", rawFile.Name())
+			defer rawFile.Close()
+			raw = rawFile
+		}
+	}
+
+	listening := 0
 	for {
-		err := ws.ReadJSON(&result)
+		message := new(ibmMessage)
+		_, data, err := ws.ReadMessage()
+		if err == nil {
+			raw.Write(append(data, '\n'))
+			err = json.Unmarshal(data, message)
+		}
 		if err != nil {
-			return nil, errors.Trace(err)
+			logger.Error("Could not read results from IBM")
+			return nil, annotateIBMError(contextError(ctx, err), transactionID)
 		}
-		if len(result.Results) > 0 {
-			log.Debugf("IBM has returned results")
+		if len(message.Error) > 0 {
+			return nil, annotateIBMError(errors.New(message.Error), transactionID)
+		}
+		if len(message.Results) > 0 {
+			logger.Debugf("IBM has returned results")
+			*result = message.IBMResult
+			return result, nil
+		}
+		if message.State == "listening" {
+			listening++
+		}
+		// A second "listening" state without any results means that IBM did
+		// not detect any speech in the audio.
+		if listening > 1 {
+			logger.Debugf("IBM did not detect any speech")
 			return result, nil
 		}
 	}
 }
 
-func basicAuth(username, password string) string {
-	auth := username + ":" + password
-	return base64.StdEncoding.EncodeToString([]byte(auth))
-}
+// startIBMRecognition connects to IBM and sends the start message of a
+// recognition with the model, using the IBM account and settings in cfg. The
+// websocket is closed once ctx is done, which interrupts any read or write in
+// progress, so ctx must be cancelled when the recognition is over. Errors are
+// already annotated with the IBM transaction id.
+func startIBMRecognition(ctx context.Context, cfg *config.AppConfig, id string, contentType string, searchWords []string, model string) (*websocket.Conn, *log.Entry, string, error) {
+	query, extraArgs, err := ibmRecognizeParams(cfg.IBMParams)
+	if err != nil {
+		return nil, nil, "", errors.Trace(err)
+	}
+	query.Set("model", model)
+	url := "wss://stream.watsonplatform.net/speech-to-text/api/v1/recognize?" + query.Encode()
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+basicAuth(cfg.IBMUsername, cfg.IBMPassword))
+	header.Set("X-Request-ID", id)
 
-func uploadFileWithWebsocket(ws *websocket.Conn, filePath string) error {
-	f, err := os.Open(filePath)
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig, err = clientTLSConfig()
+	if err != nil {
+		return nil, nil, "", errors.Trace(err)
+	}
+	dialer.NetDial = func(network, addr string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.HandshakeTimeout = deadline.Sub(time.Now())
+	}
+	ws, resp, err := dialer.Dial(url, header)
+	transactionID := ibmTransactionID(resp)
+	logger := log.WithFields(log.Fields{
+		"task":               id,
+		"ibm_transaction_id": transactionID,
+	})
 	if err != nil {
+		logger.Error("Could not connect to IBM")
+		return nil, logger, transactionID, annotateIBMError(contextError(ctx, err), transactionID)
+	}
+
+	go func() {
+		<-ctx.Done()
+		ws.Close()
+	}()
+
+	requestArgs := map[string]interface{}{
+		"action":             "start",
+		"content-type":       contentType,
+		"continuous":         true,
+		"word_confidence":    true,
+		"timestamps":         true,
+		"profanity_filter":   false,
+		"interim_results":    false,
+		"inactivity_timeout": ibmInactivityTimeout(cfg),
+		"keywords":           searchWords,
+		"keywords_threshold": 0.5,
+	}
+	for key, value := range extraArgs {
+		requestArgs[key] = value
+	}
+
+	if err = ws.WriteJSON(requestArgs); err != nil {
+		ws.Close()
+		return nil, logger, transactionID, annotateIBMError(contextError(ctx, err), transactionID)
+	}
+	return ws, logger, transactionID, nil
+}
+
+// createRawIBMResponseFile creates the file that the raw IBM messages for the
+// named chunk are written to, one JSON message per line. A missing directory
+// is created readable only by this user, since the messages hold transcripts.
+func createRawIBMResponseFile(cfg *config.AppConfig, id string, name string) (*os.File, error) {
+	dir := cfg.RawIBMResponseDir
+	if len(dir) == 0 {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Trace(err)
+	}
+	file, err := createTempFile(filepath.Join(dir, id+"_"+name+".json"))
+	return file, errors.Trace(err)
+}
+
+// contextError returns the error of ctx if it is done, since that is why
+// the operation that returned err failed.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// ibmTransactionID returns the transaction id IBM sent in the handshake
+// response, if any.
+func ibmTransactionID(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	return resp.Header.Get("X-Global-Transaction-ID")
+}
+
+func annotateIBMError(err error, transactionID string) error {
+	if len(transactionID) == 0 {
 		return errors.Trace(err)
 	}
+	return errors.Annotatef(err, "IBM transaction id %s", transactionID)
+}
 
-	r := bufio.NewReader(f)
+func basicAuth(username, password string) string {
+	auth := username + ":" + password
+	return base64.StdEncoding.EncodeToString([]byte(auth))
+}
+
+func uploadWithWebsocket(ws *websocket.Conn, audio io.Reader) error {
+	r := bufio.NewReader(audio)
 	buffer := make([]byte, 2048)
 
 	for {
@@ -127,14 +488,14 @@ func uploadFileWithWebsocket(ws *websocket.Conn, filePath string) error {
 		if err != nil && err != io.EOF {
 			return errors.Trace(err)
 		}
-		if err := ws.WriteMessage(websocket.BinaryMessage, buffer); err != nil {
+		if err := ws.WriteMessage(websocket.BinaryMessage, buffer[:n]); err != nil {
 			return errors.Trace(err)
 		}
 	}
 	return nil
 }
 
-func keepConnectionOpen(ws *websocket.Conn, ticker *time.Ticker, quit chan struct{}) {
+func keepConnectionOpen(ws *websocket.Conn, ticker *time.Ticker, quit <-chan struct{}) {
 	for {
 		select {
 		case <-ticker.C:
@@ -153,40 +514,156 @@ func keepConnectionOpen(ws *websocket.Conn, ticker *time.Ticker, quit chan struc
 
 // GetTranscription gets the full transcript from an IBMResult.
 func GetTranscription(results []*IBMResult) *Transcription {
-	timestamps := []timestamp{}
-	confidences := []confidence{}
-	keywords := []ibmKeywordResult{}
+	cfg := config.GetConfig()
+	return getTranscription(&cfg, results)
+}
 
-	var transcriptBuffer bytes.Buffer
+// getTranscription is GetTranscription with the settings of cfg.
+func getTranscription(cfg *config.AppConfig, results []*IBMResult) *Transcription {
+	builder := newTranscriptionBuilder(cfg)
 	for _, result := range results {
-		for _, subResult := range result.Results {
-			bestHypothesis := subResult.Alternatives[0]
-			transcriptBuffer.WriteString(bestHypothesis.Transcript)
-			for _, ibmTimestamp := range bestHypothesis.Timestamps {
-				timestamps = append(timestamps, timestamp{
-					Word:      ibmTimestamp[0].(string),
-					StartTime: ibmTimestamp[1].(float64),
-					EndTime:   ibmTimestamp[2].(float64),
-				})
-			}
-			for _, ibmConfidence := range bestHypothesis.WordConfidence {
-				confidences = append(confidences, confidence{
-					Word:  ibmConfidence[0].(string),
-					Score: ibmConfidence[1].(float64),
-				})
+		builder.addChunk(result)
+	}
+	return builder.build()
+}
+
+// transcriptionBuilder assembles a Transcription from IBMResults one at a time,
+// so that the results do not all have to be held in memory.
+type transcriptionBuilder struct {
+	cfg              *config.AppConfig
+	transcriptBuffer bytes.Buffer
+	timestamps       []timestamp
+	confidences      []confidence
+	keywords         []ibmKeywordResult
+	approximate      bool
+}
+
+func newTranscriptionBuilder(cfg *config.AppConfig) *transcriptionBuilder {
+	return &transcriptionBuilder{
+		cfg:         cfg,
+		timestamps:  []timestamp{},
+		confidences: []confidence{},
+		keywords:    []ibmKeywordResult{},
+	}
+}
+
+// add appends the best hypothesis of every result field to the transcription.
+func (b *transcriptionBuilder) add(result *IBMResult) {
+	for _, subResult := range result.Results {
+		if len(subResult.Alternatives) == 0 {
+			continue
+		}
+		bestHypothesis := subResult.Alternatives[0]
+		b.approximate = b.approximate || bestHypothesis.Approximate
+		b.transcriptBuffer.WriteString(b.sanitize(bestHypothesis.Transcript))
+		for _, ibmTimestamp := range bestHypothesis.Timestamps {
+			b.timestamps = append(b.timestamps, timestamp{
+				Word:      b.sanitize(ibmTimestamp[0].(string)),
+				StartTime: ibmTimestamp[1].(float64),
+				EndTime:   ibmTimestamp[2].(float64),
+			})
+		}
+		for _, ibmConfidence := range bestHypothesis.WordConfidence {
+			b.confidences = append(b.confidences, confidence{
+				Word:  b.sanitize(ibmConfidence[0].(string)),
+				Score: ibmConfidence[1].(float64),
+			})
+		}
+		for _, ibmKeywordSlice := range subResult.KeywordMap {
+			for _, keyword := range ibmKeywordSlice {
+				keyword.Word = b.sanitize(keyword.Word)
+				b.keywords = append(b.keywords, keyword)
 			}
-			for _, ibmKeywordSlice := range subResult.KeywordMap {
-				keywords = append(keywords, ibmKeywordSlice...)
+		}
+	}
+}
+
+const (
+	// defaultChunkPauseSeconds is the pause at a chunk boundary at which
+	// addChunk starts a new line when config.Config.ChunkPauseSeconds is unset.
+	defaultChunkPauseSeconds = 2.0
+	// defaultChunkPauseSeparator is what addChunk puts between chunks
+	// separated by a pause when config.Config.ChunkPauseSeparator is unset.
+	defaultChunkPauseSeparator = "\n"
+)
+
+// addChunk adds the result of one chunk of a split file. The transcripts of
+// consecutive chunks are always separated by a space, and by
+// config.Config.ChunkPauseSeparator instead if the words either side of the
+// boundary are at least config.Config.ChunkPauseSeconds apart, so that the
+// transcript reads naturally across the seams. The results of a single
+// stream, whose pauses IBM already splits into results, are added with add.
+func (b *transcriptionBuilder) addChunk(result *IBMResult) {
+	cfg := b.cfg
+	text := ""
+	firstStart := -1.0
+	for _, subResult := range result.Results {
+		if len(subResult.Alternatives) == 0 {
+			continue
+		}
+		best := subResult.Alternatives[0]
+		text += best.Transcript
+		if firstStart < 0 && len(best.Timestamps) > 0 {
+			firstStart = best.Timestamps[0][1].(float64)
+		}
+	}
+
+	if b.transcriptBuffer.Len() > 0 && len(strings.TrimSpace(text)) > 0 {
+		pause := cfg.ChunkPauseSeconds
+		if pause <= 0 {
+			pause = defaultChunkPauseSeconds
+		}
+		separator := " "
+		if len(b.timestamps) > 0 && firstStart >= 0 &&
+			firstStart-b.timestamps[len(b.timestamps)-1].EndTime >= pause {
+			separator = cfg.ChunkPauseSeparator
+			if len(separator) == 0 {
+				separator = defaultChunkPauseSeparator
 			}
 		}
+		trimmed := bytes.TrimRight(b.transcriptBuffer.Bytes(), " \t\n")
+		b.transcriptBuffer.Truncate(len(trimmed))
+		b.transcriptBuffer.WriteString(separator)
+	}
+	b.add(result)
+}
+
+// sanitize returns s as sanitizeText makes it, or as is if the builder's
+// RawTranscript is set.
+func (b *transcriptionBuilder) sanitize(s string) string {
+	if b.cfg.RawTranscript {
+		return s
+	}
+	return sanitizeText(s)
+}
+
+// sanitizeText makes s safe to marshal by replacing invalid UTF-8 with the
+// Unicode replacement character and removing control characters other than
+// tabs and newlines. Ranging over s already yields the replacement character
+// for each invalid byte.
+func sanitizeText(s string) string {
+	var buffer bytes.Buffer
+	for _, r := range s {
+		if unicode.IsControl(r) && r != '\t' && r != '\n' {
+			continue
+		}
+		buffer.WriteRune(r)
 	}
+	return buffer.String()
+}
 
+func (b *transcriptionBuilder) build() *Transcription {
 	transcription := &Transcription{
-		Transcript:  transcriptBuffer.String(),
-		CompletedAt: time.Now(),
-		Timestamps:  timestamps,
-		Confidences: confidences,
-		Keywords:    keywords,
+		Transcript:  b.transcriptBuffer.String(),
+		CompletedAt: now(),
+		Timestamps:  b.timestamps,
+		Confidences: b.confidences,
+		IBMKeywords: b.keywords,
+		// Only some of the timestamps may be interpolated.
+		ApproximateTimestamps: b.approximate,
 	}
+	transcription.Empty = len(strings.TrimSpace(transcription.Transcript)) == 0
+	transcription.setAverageConfidence()
+	transcription.setHash(b.cfg)
 	return transcription
 }
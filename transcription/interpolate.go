@@ -0,0 +1,95 @@
+package transcription
+
+import (
+	"strings"
+)
+
+// interpolateResultTimes times the words of every field of result whose best
+// alternative has a transcript but no word timestamps, as some engines only
+// time whole phrases. A run of such fields is spread over the gap between the
+// last timed word before it and the first after it, or the start and the end
+// of the chunk, which lasts duration seconds. Each word gets a share of the
+// gap in proportion to its length, and the alternative is marked Approximate.
+// The result is returned as is if every field is timed.
+func interpolateResultTimes(result *IBMResult, duration float64) *IBMResult {
+	needed := false
+	for _, field := range result.Results {
+		needed = needed || untimedField(field)
+	}
+	if !needed {
+		return result
+	}
+
+	interpolated := &IBMResult{ResultIndex: result.ResultIndex}
+	interpolated.Results = make([]ibmResultField, len(result.Results))
+	copy(interpolated.Results, result.Results)
+	fields := interpolated.Results
+
+	start := 0.0
+	for i := 0; i < len(fields); i++ {
+		if !untimedField(fields[i]) {
+			if timestamps := bestTimestamps(fields[i]); len(timestamps) > 0 {
+				start = timestamps[len(timestamps)-1][2].(float64)
+			}
+			continue
+		}
+
+		// The run ends at the next timed word, or the end of the chunk.
+		end := duration
+		j := i
+		for ; j < len(fields); j++ {
+			if timestamps := bestTimestamps(fields[j]); len(timestamps) > 0 {
+				end = timestamps[0][1].(float64)
+				break
+			}
+		}
+		if end > start {
+			interpolateRun(fields[i:j], start, end)
+		}
+		i = j - 1
+	}
+	return interpolated
+}
+
+// untimedField reports whether the best alternative of field has words but no
+// timestamps.
+func untimedField(field ibmResultField) bool {
+	return len(field.Alternatives) > 0 && len(field.Alternatives[0].Timestamps) == 0 &&
+		len(strings.Fields(field.Alternatives[0].Transcript)) > 0
+}
+
+// bestTimestamps returns the word timestamps of the best alternative of field.
+func bestTimestamps(field ibmResultField) []ibmWordTimestamp {
+	if len(field.Alternatives) == 0 {
+		return nil
+	}
+	return field.Alternatives[0].Timestamps
+}
+
+// interpolateRun times the words of the untimed fields, in order, between
+// start and end. The alternatives are copied before they are changed.
+func interpolateRun(fields []ibmResultField, start, end float64) {
+	words := []string{}
+	for _, field := range fields {
+		if untimedField(field) {
+			words = append(words, strings.Fields(field.Alternatives[0].Transcript)...)
+		}
+	}
+	timestamps := interpolateWordTimes(words, start, end)
+	for i := range fields {
+		if !untimedField(fields[i]) {
+			continue
+		}
+		alternatives := make([]ibmAlternativesField, len(fields[i].Alternatives))
+		copy(alternatives, fields[i].Alternatives)
+		best := &alternatives[0]
+		count := len(strings.Fields(best.Transcript))
+		best.Timestamps = make([]ibmWordTimestamp, count)
+		for k, ts := range timestamps[:count] {
+			best.Timestamps[k] = ibmWordTimestamp{ts.Word, ts.StartTime, ts.EndTime}
+		}
+		best.Approximate = true
+		timestamps = timestamps[count:]
+		fields[i].Alternatives = alternatives
+	}
+}
@@ -0,0 +1,40 @@
+package transcription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpolateResultTimes(t *testing.T) {
+	assert := assert.New(t)
+	result := &IBMResult{Results: []ibmResultField{
+		{Alternatives: []ibmAlternativesField{{Transcript: "ab abcd "}}},
+		{Alternatives: []ibmAlternativesField{{
+			Transcript: "hi ",
+			Timestamps: []ibmWordTimestamp{{"hi", 6.0, 7.0}},
+		}}},
+		{Alternatives: []ibmAlternativesField{{Transcript: "abc "}}},
+	}}
+
+	interpolated := interpolateResultTimes(result, 10)
+	transcription := GetTranscription([]*IBMResult{interpolated})
+	assert.Equal([]timestamp{
+		{"ab", 0, 2}, {"abcd", 2, 6}, {"hi", 6, 7}, {"abc", 7, 10},
+	}, transcription.Timestamps)
+	assert.True(transcription.ApproximateTimestamps)
+
+	// The original result is unchanged.
+	assert.Empty(result.Results[0].Alternatives[0].Timestamps)
+	assert.False(GetTranscription([]*IBMResult{result}).ApproximateTimestamps)
+}
+
+func TestInterpolateResultTimesLeavesTimedResults(t *testing.T) {
+	result := &IBMResult{Results: []ibmResultField{
+		{Alternatives: []ibmAlternativesField{{
+			Transcript: "hi ",
+			Timestamps: []ibmWordTimestamp{{"hi", 1.0, 2.0}},
+		}}},
+	}}
+	assert.True(t, result == interpolateResultTimes(result, 10))
+}
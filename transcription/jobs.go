@@ -0,0 +1,125 @@
+package transcription
+
+import (
+	"context"
+	"sync"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/jobid"
+)
+
+// ErrShuttingDown is returned for jobs started after Shutdown.
+var ErrShuttingDown = errors.New("the server is shutting down")
+
+// jobs maps the id of every running job to the function that cancels it.
+var jobs = struct {
+	sync.Mutex
+	m            map[string]context.CancelFunc
+	running      sync.WaitGroup
+	shuttingDown bool
+	// cancelled holds the ids of the jobs cancelled by CancelJob until
+	// wasCancelled is called for them.
+	cancelled map[string]bool
+}{m: make(map[string]context.CancelFunc), cancelled: make(map[string]bool)}
+
+// GenerateJobID returns a new unique job id; see jobid.New. The time in it
+// comes from the package clock.
+func GenerateJobID() string {
+	return jobid.At(now())
+}
+
+// RegisterJob registers a running job and returns the context it should run
+// under. The context is cancelled by CancelJob(id). The returned function must
+// be called when the job finishes to release it. After Shutdown, the context
+// is already cancelled.
+func RegisterJob(id string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs.Lock()
+	if jobs.shuttingDown {
+		jobs.Unlock()
+		cancel()
+		return ctx, func() {}
+	}
+	jobs.m[id] = cancel
+	jobs.running.Add(1)
+	jobs.Unlock()
+
+	return ctx, func() {
+		jobs.Lock()
+		delete(jobs.m, id)
+		jobs.Unlock()
+		cancel()
+		jobs.running.Done()
+	}
+}
+
+// isJobRunning reports whether the job with id is registered and has not
+// finished.
+func isJobRunning(id string) bool {
+	jobs.Lock()
+	defer jobs.Unlock()
+	_, ok := jobs.m[id]
+	return ok
+}
+
+// Shutdown stops new jobs from starting and waits for the running ones to
+// finish. If ctx is done first, the running jobs are cancelled and Shutdown
+// returns the error of ctx once they have stopped.
+func Shutdown(ctx context.Context) error {
+	jobs.Lock()
+	jobs.shuttingDown = true
+	jobs.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		jobs.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	jobs.Lock()
+	for _, cancel := range jobs.m {
+		cancel()
+	}
+	jobs.Unlock()
+	<-finished
+	return ctx.Err()
+}
+
+// ShuttingDown reports whether Shutdown has been called.
+func ShuttingDown() bool {
+	jobs.Lock()
+	defer jobs.Unlock()
+	return jobs.shuttingDown
+}
+
+// CancelJob cancels the running job with the given id. It returns false if no
+// such job is running.
+func CancelJob(id string) bool {
+	jobs.Lock()
+	cancel, ok := jobs.m[id]
+	if ok {
+		jobs.cancelled[id] = true
+	}
+	jobs.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// wasCancelled reports whether the job with the given id was cancelled by
+// CancelJob, and forgets it.
+func wasCancelled(id string) bool {
+	jobs.Lock()
+	defer jobs.Unlock()
+	cancelled := jobs.cancelled[id]
+	delete(jobs.cancelled, id)
+	return cancelled
+}
@@ -0,0 +1,55 @@
+package transcription
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelJob(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, done := RegisterJob("job")
+	defer done()
+	assert.NoError(ctx.Err())
+
+	assert.True(CancelJob("job"))
+	assert.Error(ctx.Err())
+}
+
+func TestCancelUnknownJob(t *testing.T) {
+	assert := assert.New(t)
+
+	_, done := RegisterJob("finished")
+	done()
+	assert.False(CancelJob("finished"))
+	assert.False(CancelJob("missing"))
+}
+
+func TestShutdown(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { jobs.shuttingDown = false }()
+
+	ctx, done := RegisterJob("draining")
+	go func() {
+		<-ctx.Done()
+		done()
+	}()
+
+	deadline, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, Shutdown(deadline))
+	assert.Error(ctx.Err())
+	assert.True(ShuttingDown())
+
+	late, _ := RegisterJob("late")
+	assert.Error(late.Err())
+	assert.NoError(Shutdown(context.Background()))
+}
+
+func TestGenerateJobIDUsesClock(t *testing.T) {
+	defer freezeTime(time.Unix(1500000000, 0))()
+	assert.Equal(t, "01BMZFF600", GenerateJobID()[:10])
+}
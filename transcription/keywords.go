@@ -0,0 +1,174 @@
+package transcription
+
+import (
+	"strings"
+	"unicode"
+)
+
+// KeywordMatchOptions configures SearchKeywords. Matching is always case
+// insensitive.
+type KeywordMatchOptions struct {
+	// Stem compares words after stripping common English suffixes, so that
+	// "transcribing" matches "transcribed".
+	Stem bool
+	// MaxDistance is the largest Levenshtein distance between two words that
+	// still counts as a match. Zero only allows exact matches.
+	MaxDistance int
+}
+
+// KeywordMatch is an occurrence of a keyword in a transcript.
+type KeywordMatch struct {
+	Keyword   string
+	Text      string
+	Position  int // index of the first matched word
+	StartTime float64
+	EndTime   float64
+	Distance  int
+}
+
+// KeywordResult is an occurrence of a keyword spotted by IBM.
+type KeywordResult struct {
+	// Keyword is the text IBM heard, which may differ slightly from the
+	// keyword that was searched for.
+	Keyword    string
+	StartTime  float64
+	EndTime    float64
+	Confidence float64
+}
+
+// Keywords returns the keywords IBM spotted in the audio.
+func (t *Transcription) Keywords() []KeywordResult {
+	keywords := make([]KeywordResult, len(t.IBMKeywords))
+	for i, keyword := range t.IBMKeywords {
+		keywords[i] = KeywordResult{
+			Keyword:    keyword.Word,
+			StartTime:  keyword.StartTime,
+			EndTime:    keyword.EndTime,
+			Confidence: keyword.Confidence,
+		}
+	}
+	return keywords
+}
+
+// SearchKeywords searches the words of t for each of the keywords. Unlike the
+// keyword spotting done by IBM, this also finds words that IBM transcribed
+// with a slightly different spelling or form. A keyword may contain several
+// words, which must then appear consecutively.
+func SearchKeywords(t *Transcription, keywords []string, opts KeywordMatchOptions) []KeywordMatch {
+	words := transcriptionWords(t)
+	matches := []KeywordMatch{}
+
+	for _, keyword := range keywords {
+		keywordWords := strings.Fields(keyword)
+		if len(keywordWords) == 0 {
+			continue
+		}
+		for i := 0; i+len(keywordWords) <= len(words); i++ {
+			distance, ok := matchWords(words[i:i+len(keywordWords)], keywordWords, opts)
+			if !ok {
+				continue
+			}
+			last := words[i+len(keywordWords)-1]
+			texts := make([]string, len(keywordWords))
+			for j := range keywordWords {
+				texts[j] = words[i+j].Word
+			}
+			matches = append(matches, KeywordMatch{
+				Keyword:   keyword,
+				Text:      strings.Join(texts, " "),
+				Position:  i,
+				StartTime: words[i].StartTime,
+				EndTime:   last.EndTime,
+				Distance:  distance,
+			})
+		}
+	}
+	return matches
+}
+
+// transcriptionWords returns the timestamped words of t, falling back to the
+// untimed words of the transcript when there are no timestamps.
+func transcriptionWords(t *Transcription) []timestamp {
+	if len(t.Timestamps) > 0 {
+		return t.Timestamps
+	}
+	words := []timestamp{}
+	for _, word := range strings.Fields(t.Transcript) {
+		words = append(words, timestamp{Word: word})
+	}
+	return words
+}
+
+// matchWords compares the words of a transcript against the words of a keyword
+// and returns their total distance.
+func matchWords(words []timestamp, keywordWords []string, opts KeywordMatchOptions) (int, bool) {
+	total := 0
+	for i, keywordWord := range keywordWords {
+		a := normalizeKeywordWord(words[i].Word, opts.Stem)
+		b := normalizeKeywordWord(keywordWord, opts.Stem)
+		if a == b {
+			continue
+		}
+		if opts.MaxDistance <= 0 {
+			return 0, false
+		}
+		distance := levenshtein(a, b)
+		if distance > opts.MaxDistance {
+			return 0, false
+		}
+		total += distance
+	}
+	return total, true
+}
+
+// normalizeKeywordWord lower-cases word, trims punctuation and optionally
+// stems it.
+func normalizeKeywordWord(word string, stem bool) string {
+	word = strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}))
+	if stem {
+		word = stemWord(word)
+	}
+	return word
+}
+
+// stemWord strips a common English suffix from word. It is much cruder than a
+// real stemmer but good enough to relate the forms of a keyword.
+func stemWord(word string) string {
+	for _, suffix := range []string{"ingly", "edly", "ing", "ies", "ied", "ed", "es", "ly", "s"} {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= 3 {
+			return strings.TrimSuffix(word, suffix)
+		}
+	}
+	return word
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,61 @@
+package transcription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var keywordTranscription = &Transcription{
+	Transcript: "the Credit cards were transcribed by the credet card company ",
+	Timestamps: []timestamp{
+		{"the", 0.0, 0.1},
+		{"Credit", 0.1, 0.4},
+		{"cards", 0.4, 0.8},
+		{"were", 0.8, 1.0},
+		{"transcribed", 1.0, 1.6},
+		{"by", 1.6, 1.7},
+		{"the", 1.7, 1.8},
+		{"credet", 1.8, 2.1},
+		{"card", 2.1, 2.4},
+		{"company", 2.4, 2.9},
+	},
+}
+
+func TestSearchKeywordsIsCaseInsensitive(t *testing.T) {
+	assert := assert.New(t)
+
+	matches := SearchKeywords(keywordTranscription, []string{"credit"}, KeywordMatchOptions{})
+	assert.Len(matches, 1)
+	assert.Equal("Credit", matches[0].Text)
+	assert.Equal(1, matches[0].Position)
+	assert.Equal(0.1, matches[0].StartTime)
+}
+
+func TestSearchKeywordsWithStemming(t *testing.T) {
+	assert := assert.New(t)
+
+	matches := SearchKeywords(keywordTranscription, []string{"transcribing"}, KeywordMatchOptions{Stem: true})
+	assert.Len(matches, 1)
+	assert.Equal("transcribed", matches[0].Text)
+}
+
+func TestSearchKeywordsWithFuzzyPhrase(t *testing.T) {
+	assert := assert.New(t)
+
+	matches := SearchKeywords(keywordTranscription, []string{"credit card"}, KeywordMatchOptions{Stem: true, MaxDistance: 1})
+	assert.Len(matches, 2)
+	assert.Equal("Credit cards", matches[0].Text)
+	assert.Equal(0, matches[0].Distance)
+	assert.Equal("credet card", matches[1].Text)
+	assert.Equal(1, matches[1].Distance)
+	assert.Equal(2.4, matches[1].EndTime)
+}
+
+func TestKeywords(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{IBMKeywords: []ibmKeywordResult{{"budget", 1.5, 2, 0.9}}}
+
+	assert.Equal([]KeywordResult{{"budget", 1.5, 2, 0.9}}, transcription.Keywords())
+	assert.Empty((&Transcription{}).Keywords())
+}
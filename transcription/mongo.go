@@ -0,0 +1,291 @@
+package transcription
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+const (
+	defaultMongoRetries        = 3
+	mongoRetryDelay            = time.Second
+	defaultMongoConnectTimeout = 10 * time.Second
+	defaultMongoSocketTimeout  = time.Minute
+)
+
+// These are the statuses of a document written chunk by chunk. The full
+// transcription that replaces it has none.
+// partialStatus: The job is still transcribing.
+// failedStatus: The job failed, and the document holds only the chunks
+// transcribed before it did.
+const (
+	partialStatus = "partial"
+	failedStatus  = "failed"
+)
+
+type mgoLogger struct{}
+
+func (mgoLogger) Output(_ int, s string) error {
+	log.Debug(s)
+	return nil
+}
+
+// WriteToMongo takes a string and writes it to the database. Transient errors
+// are retried with exponential backoff. If every attempt fails, the
+// transcription is written to a local fallback file so that it is not lost.
+func WriteToMongo(data *Transcription, url string) error {
+	err := retryMongo(func() error {
+		return writeToMongoOnce(data, url)
+	})
+	if err == nil {
+		return nil
+	}
+
+	fallbackPath, fallbackErr := writeFallbackFile(data)
+	if fallbackErr != nil {
+		return errors.Wrap(err, fallbackErr)
+	}
+	return errors.Annotatef(err, "wrote transcription to %s instead", fallbackPath)
+}
+
+func writeToMongoOnce(data *Transcription, url string) error {
+	mgo.SetLogger(mgoLogger{})
+	session, err := dialMongo(url)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.SetMode(mgo.Monotonic, true)
+
+	c := session.DB("database").C("transcriptions")
+
+	// A document written chunk by chunk is replaced by the full transcription.
+	if len(data.ID) > 0 {
+		_, err = c.UpsertId(data.ID, data)
+		return err
+	}
+
+	// Insert data
+	err = c.Insert(&data)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateTranscriptionChunk appends the transcript text and timestamps of the
+// chunkIndex-th chunk of job id to its document in config.Config.MongoURL,
+// creating the document if it does not exist yet, so that partial results can
+// be read while the job runs. Its status is partialStatus until it is replaced
+// by the full transcription when the job writes it with its ID set, or marked
+// failedStatus by markTranscriptionFailed.
+func UpdateTranscriptionChunk(id string, chunkIndex int, text string, timestamps []timestamp) error {
+	return updateTranscriptionChunk(config.GetConfig().MongoURL, id, chunkIndex, text, timestamps)
+}
+
+func updateTranscriptionChunk(url string, id string, chunkIndex int, text string, timestamps []timestamp) error {
+	mgo.SetLogger(mgoLogger{})
+	// Only connecting is retried, since the update appends to the document
+	// and may have been applied when it fails.
+	var session *mgo.Session
+	err := retryMongo(func() error {
+		var err error
+		session, err = dialMongo(url)
+		return err
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer session.Close()
+
+	session.SetMode(mgo.Monotonic, true)
+
+	c := session.DB("database").C("transcriptions")
+	_, err = c.UpsertId(id, chunkUpdate(chunkIndex, text, timestamps))
+	return errors.Annotatef(err, "could not update chunk %d of %s", chunkIndex, id)
+}
+
+// chunkUpdate returns the mongo update that appends a chunk to the chunks
+// and timestamps of a document and records when it happened.
+func chunkUpdate(chunkIndex int, text string, timestamps []timestamp) bson.M {
+	if timestamps == nil {
+		timestamps = []timestamp{}
+	}
+	return bson.M{
+		"$push": bson.M{
+			"chunks":     bson.M{"index": chunkIndex, "transcript": text},
+			"timestamps": bson.M{"$each": timestamps},
+		},
+		"$set": bson.M{"updatedat": now(), "status": partialStatus},
+	}
+}
+
+// markTranscriptionFailed marks the partial document of job id in url as
+// failedStatus with errMessage, so that clients polling mongo do not wait for
+// the rest of it. There is nothing to mark if no chunk was written.
+func markTranscriptionFailed(url string, id string, errMessage string) error {
+	err := withMongoCollection(url, "transcriptions", func(c *mgo.Collection) error {
+		return c.Update(bson.M{"_id": id, "status": partialStatus}, failedUpdate(errMessage))
+	})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return errors.Annotatef(err, "could not mark %s failed", id)
+}
+
+// failedUpdate returns the mongo update that marks a partial document failed.
+func failedUpdate(errMessage string) bson.M {
+	return bson.M{"$set": bson.M{"updatedat": now(), "status": failedStatus, "error": errMessage}}
+}
+
+// WriteManyToMongo inserts all of docs in a single bulk write, which is much
+// faster than calling WriteToMongo for each. Connecting is retried like
+// WriteToMongo, but the insert is not, since some documents may already have
+// been written when it fails.
+func WriteManyToMongo(docs []*Transcription, url string) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	mgo.SetLogger(mgoLogger{})
+	var session *mgo.Session
+	err := retryMongo(func() error {
+		var err error
+		session, err = dialMongo(url)
+		return err
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer session.Close()
+
+	session.SetMode(mgo.Monotonic, true)
+
+	bulk := session.DB("database").C("transcriptions").Bulk()
+	// Keep inserting the remaining documents if one fails.
+	bulk.Unordered()
+	for _, doc := range docs {
+		bulk.Insert(doc)
+	}
+	if _, err := bulk.Run(); err != nil {
+		return errors.Annotatef(err, "could not insert %d transcriptions", len(docs))
+	}
+	return nil
+}
+
+// withMongoCollection calls f with the named collection of the database at
+// url, retrying transient errors like WriteToMongo, so f must be safe to
+// repeat.
+func withMongoCollection(url string, name string, f func(*mgo.Collection) error) error {
+	mgo.SetLogger(mgoLogger{})
+	return retryMongo(func() error {
+		session, err := dialMongo(url)
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+		session.SetMode(mgo.Monotonic, true)
+		return f(session.DB("database").C(name))
+	})
+}
+
+// retryMongo calls f until it succeeds, retrying transient errors up to
+// config.Config.MongoRetries times with exponential backoff.
+func retryMongo(f func() error) error {
+	retries := config.GetConfig().MongoRetries
+	if retries <= 0 {
+		retries = defaultMongoRetries
+	}
+
+	var err error
+	delay := mongoRetryDelay
+	for attempt := 1; attempt <= retries; attempt++ {
+		if err = f(); err == nil {
+			return nil
+		}
+		if !isTransientMongoError(err) || attempt == retries {
+			break
+		}
+		log.Debugf("Mongo attempt %d failed, retrying in %v: %v", attempt, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return err
+}
+
+// dialMongo connects to url with the timeouts and pool limit from
+// config.Config, so that an unresponsive server cannot block a job forever.
+func dialMongo(url string) (*mgo.Session, error) {
+	cfg := config.GetConfig()
+	info, err := mgo.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	info.Timeout = cfg.MongoConnectTimeout.Duration
+	if info.Timeout <= 0 {
+		info.Timeout = defaultMongoConnectTimeout
+	}
+	if cfg.MongoPoolLimit > 0 {
+		info.PoolLimit = cfg.MongoPoolLimit
+	}
+
+	session, err := mgo.DialWithInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	socketTimeout := cfg.MongoSocketTimeout.Duration
+	if socketTimeout <= 0 {
+		socketTimeout = defaultMongoSocketTimeout
+	}
+	session.SetSocketTimeout(socketTimeout)
+	session.SetSyncTimeout(info.Timeout)
+	return session, nil
+}
+
+// isTransientMongoError reports whether err is a network error that may
+// succeed if retried.
+func isTransientMongoError(err error) bool {
+	if err == io.EOF {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return strings.Contains(err.Error(), "no reachable servers") ||
+		strings.Contains(err.Error(), "connection reset")
+}
+
+// writeFallbackFile writes data as JSON to config.Config.MongoFallbackDir
+// (the working directory by default) and returns the path of the file. Like
+// the other files of a job, it is only readable with config.Config.TempFileMode.
+func writeFallbackFile(data *Transcription) (string, error) {
+	name := "transcription_" + strconv.Itoa(int(now().UnixNano())) + ".json"
+	path := filepath.Join(config.GetConfig().MongoFallbackDir, name)
+
+	file, err := createTempFile(path)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	err = json.NewEncoder(file).Encode(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return path, nil
+}
@@ -0,0 +1,89 @@
+package transcription
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestChunkUpdate(t *testing.T) {
+	assert := assert.New(t)
+	defer freezeTime(time.Unix(1500000000, 0))()
+
+	timestamps := []timestamp{{"hello", 95, 95.5}}
+	update := chunkUpdate(1, "hello", timestamps)
+	assert.Equal(bson.M{
+		"$push": bson.M{
+			"chunks":     bson.M{"index": 1, "transcript": "hello"},
+			"timestamps": bson.M{"$each": timestamps},
+		},
+		"$set": bson.M{"updatedat": now(), "status": partialStatus},
+	}, update)
+
+	// Empty chunks still push an empty list rather than null.
+	update = chunkUpdate(2, "", nil)
+	assert.Equal(bson.M{"$each": []timestamp{}}, update["$push"].(bson.M)["timestamps"])
+}
+
+func TestFailedUpdate(t *testing.T) {
+	defer freezeTime(time.Unix(1500000000, 0))()
+	assert.Equal(t, bson.M{
+		"$set": bson.M{"updatedat": now(), "status": failedStatus, "error": "boom"},
+	}, failedUpdate("boom"))
+}
+
+func TestTranscriptionIDIsOmittedWhenEmpty(t *testing.T) {
+	assert := assert.New(t)
+	data, err := bson.Marshal(&Transcription{Transcript: "hello"})
+	assert.NoError(err)
+	doc := bson.M{}
+	assert.NoError(bson.Unmarshal(data, doc))
+	_, ok := doc["_id"]
+	assert.False(ok)
+
+	data, err = bson.Marshal(&Transcription{ID: "job"})
+	assert.NoError(err)
+	doc = bson.M{}
+	assert.NoError(bson.Unmarshal(data, doc))
+	assert.Equal("job", doc["_id"])
+}
+
+func TestUserMetadataRoundTrips(t *testing.T) {
+	assert := assert.New(t)
+	metadata := map[string]string{"customer": "c-42", "case": "2017-118", "source": "intake"}
+	data, err := bson.Marshal(&Transcription{UserMetadata: metadata})
+	assert.NoError(err)
+
+	var transcription Transcription
+	assert.NoError(bson.Unmarshal(data, &transcription))
+	assert.Equal(metadata, transcription.UserMetadata)
+
+	// Transcriptions without any are stored without the field.
+	data, err = bson.Marshal(&Transcription{})
+	assert.NoError(err)
+	doc := bson.M{}
+	assert.NoError(bson.Unmarshal(data, doc))
+	_, ok := doc["usermetadata"]
+	assert.False(ok)
+}
+
+func TestWriteFallbackFileIsPrivate(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "fallback")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	defer func(dir string) { config.Config.MongoFallbackDir = dir }(config.Config.MongoFallbackDir)
+	config.Config.MongoFallbackDir = dir
+
+	path, err := writeFallbackFile(&Transcription{Transcript: "hello"})
+	assert.NoError(err)
+	info, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+}
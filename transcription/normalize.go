@@ -0,0 +1,85 @@
+package transcription
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NormalizeOptions toggles the transforms applied by NormalizeTranscript.
+type NormalizeOptions struct {
+	// CapitalizeSentences capitalizes the first word of every sentence.
+	CapitalizeSentences bool
+	// CapitalizeI capitalizes the pronoun "i" and its contractions.
+	CapitalizeI bool
+	// AddPeriods ends a sentence with a period at every long pause.
+	AddPeriods bool
+	// PauseSeconds is the gap between two words that ends a sentence.
+	PauseSeconds float64
+}
+
+// DefaultNormalizeOptions enables every transform with a one second pause.
+var DefaultNormalizeOptions = NormalizeOptions{
+	CapitalizeSentences: true,
+	CapitalizeI:         true,
+	AddPeriods:          true,
+	PauseSeconds:        1.0,
+}
+
+// NormalizeTranscript rewrites the transcript of t into a more readable form.
+// Sentence boundaries are detected from pauses between timestamps, so they are
+// only found when every word of the transcript has a timestamp.
+func NormalizeTranscript(t *Transcription, opts NormalizeOptions) {
+	words := strings.Fields(t.Transcript)
+	if len(words) == 0 {
+		return
+	}
+	hasTimes := len(words) == len(t.Timestamps)
+
+	sentenceStart := true
+	for i, word := range words {
+		if opts.CapitalizeSentences && sentenceStart {
+			word = capitalize(word)
+		}
+		if opts.CapitalizeI && isPronounI(word) {
+			word = capitalize(word)
+		}
+
+		sentenceStart = endsSentence(word)
+		if hasTimes && i+1 < len(words) {
+			gap := t.Timestamps[i+1].StartTime - t.Timestamps[i].EndTime
+			if gap >= opts.PauseSeconds {
+				if opts.AddPeriods && !endsSentence(word) {
+					word += "."
+				}
+				sentenceStart = true
+			}
+		}
+		words[i] = word
+	}
+
+	if opts.AddPeriods && !endsSentence(words[len(words)-1]) {
+		words[len(words)-1] += "."
+	}
+	t.Transcript = strings.Join(words, " ")
+}
+
+// capitalize upper-cases the first letter of word.
+func capitalize(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
+
+// isPronounI reports whether word is "i" or a contraction such as "i'm".
+func isPronounI(word string) bool {
+	switch word {
+	case "i", "i'm", "i'll", "i've", "i'd":
+		return true
+	}
+	return false
+}
+
+// endsSentence reports whether word ends with sentence punctuation.
+func endsSentence(word string) bool {
+	return strings.HasSuffix(word, ".") || strings.HasSuffix(word, "?") || strings.HasSuffix(word, "!")
+}
@@ -0,0 +1,37 @@
+package transcription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTranscript(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{
+		Transcript: "so i think it works then i'm done ",
+		Timestamps: []timestamp{
+			{"so", 0.0, 0.2},
+			{"i", 0.3, 0.4},
+			{"think", 0.4, 0.7},
+			{"it", 0.7, 0.8},
+			{"works", 0.8, 1.2},
+			{"then", 3.0, 3.2},
+			{"i'm", 3.3, 3.5},
+			{"done", 3.5, 3.9},
+		},
+	}
+
+	NormalizeTranscript(transcription, DefaultNormalizeOptions)
+	assert.Equal("So I think it works. Then I'm done.", transcription.Transcript)
+}
+
+func TestNormalizeTranscriptWithoutPeriods(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{Transcript: "hello there i said "}
+
+	opts := DefaultNormalizeOptions
+	opts.AddPeriods = false
+	NormalizeTranscript(transcription, opts)
+	assert.Equal("Hello there I said", transcription.Transcript)
+}
@@ -0,0 +1,311 @@
+package transcription
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// JobStatus is the outcome of a job reported in a JobEvent.
+type JobStatus string
+
+// These are the statuses of a JobEvent.
+// COMPLETED: The job finished and the Transcription is set.
+// FAILED: The job failed and the Error is set.
+// ALERTED: An alert word was heard in a stream and the Alert is set.
+const (
+	COMPLETED JobStatus = "completed"
+	FAILED    JobStatus = "failed"
+	ALERTED   JobStatus = "alerted"
+)
+
+// JobEvent describes a job that has finished.
+type JobEvent struct {
+	ID            string         `json:"id"`
+	Status        JobStatus      `json:"status"`
+	Transcription *Transcription `json:"transcription,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	Alert         *Alert         `json:"alert,omitempty"`
+}
+
+// Notifier tells someone that a job has finished, or that something needs
+// their attention in a stream.
+type Notifier interface {
+	Notify(event JobEvent) error
+}
+
+// EmailNotifier emails the job's recipients using the templates in
+// config.Config.
+type EmailNotifier struct {
+	Username   string
+	Password   string
+	SMTPServer string
+	Port       int
+	To         []string
+	CC         []string
+	BCC        []string
+	// cfg holds the templates and settings of the job, or is nil for
+	// config.Config.
+	cfg *config.AppConfig
+}
+
+// config returns the settings the notifier sends emails with.
+func (n EmailNotifier) config() config.AppConfig {
+	if n.cfg != nil {
+		return *n.cfg
+	}
+	return config.GetConfig()
+}
+
+// Notify implements Notifier. Identical failure emails are throttled by
+// config.Config.EmailFailureThrottle. Nothing is sent if there are no
+// recipients: failure emails only go to To, and success emails also go to CC
+// and BCC.
+func (n EmailNotifier) Notify(event JobEvent) error {
+	cfg := n.config()
+	if event.Status == ALERTED {
+		if len(n.To) == 0 {
+			log.WithField("task", event.ID).
+				Debug("Not sending alert email because there are no recipients")
+			return nil
+		}
+		subject, body := alertEmail(event)
+		return errors.Trace(SendEmail(n.Username, n.Password, n.SMTPServer, n.Port, n.To, subject, body))
+	}
+	if event.Status == FAILED {
+		if len(n.To) == 0 {
+			log.WithField("task", event.ID).
+				Debug("Not sending error email because there are no recipients")
+			return nil
+		}
+		send, suppressed := throttleFailureEmail(failureEmailKey(n.To, event.Error), cfg.EmailFailureThrottle.Duration)
+		if !send {
+			log.WithField("task", event.ID).
+				Debugf("Not sending error email to %v because an identical one was sent recently", n.To)
+			return nil
+		}
+		subject, body, err := renderEmail(cfg.EmailFailureSubject, cfg.EmailFailureBody, defaultFailureSubject, defaultFailureBody, EmailData{ID: event.ID, Error: event.Error, Suppressed: suppressed})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Trace(SendEmail(n.Username, n.Password, n.SMTPServer, n.Port, n.To, subject, body))
+	}
+
+	if len(n.To)+len(n.CC)+len(n.BCC) == 0 {
+		log.WithField("task", event.ID).
+			Debug("Not sending email because there are no recipients")
+		return nil
+	}
+	data := EmailData{ID: event.ID, Transcription: event.Transcription, Timing: timingSummary(event.Transcription)}
+	if len(event.Transcription.AudioURL) > 0 {
+		data.AudioURLNote = audioURLNote(&cfg, event.Transcription.AudioURL)
+	}
+	subject, body, err := renderEmail(cfg.EmailSuccessSubject, cfg.EmailSuccessBody, defaultSuccessSubject, defaultSuccessBody, data)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(SendEmailFull(n.Username, n.Password, n.SMTPServer, n.Port, n.To, n.CC, n.BCC, subject, body))
+}
+
+// alertEmail returns the subject and body of the email for an alert event.
+func alertEmail(event JobEvent) (string, string) {
+	alert := event.Alert
+	subject := fmt.Sprintf("Alert: %q heard in %s", alert.Word, event.ID)
+	body := fmt.Sprintf("%q was heard at %s in %s:\n\n%s\n", alert.Word, formatSRTTime(alert.StartTime), event.ID, strings.TrimSpace(alert.Transcript))
+	return subject, body
+}
+
+// slackPreviewLength is the most characters of a transcript posted to Slack.
+const slackPreviewLength = 300
+
+// SlackNotifier posts a short message to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string
+}
+
+// Notify implements Notifier.
+func (n SlackNotifier) Notify(event JobEvent) error {
+	body, err := json.Marshal(map[string]string{"text": slackMessage(event)})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(postJSON(n.WebhookURL, body, nil))
+}
+
+// slackMessage summarizes event in a line or two.
+func slackMessage(event JobEvent) string {
+	if event.Status == ALERTED {
+		return fmt.Sprintf("Alert: %q heard at %s in %s\n> %s", event.Alert.Word, formatSRTTime(event.Alert.StartTime), event.ID, strings.TrimSpace(event.Alert.Transcript))
+	}
+	if event.Status == FAILED {
+		message := strings.TrimSpace(event.Error)
+		if i := strings.Index(message, "\n"); i >= 0 {
+			message = message[:i]
+		}
+		return fmt.Sprintf("Transcription %s failed: %s", event.ID, message)
+	}
+
+	t := event.Transcription
+	message := fmt.Sprintf("Transcription %s is complete.", event.ID)
+	if t.Empty {
+		message += " No speech was detected."
+	} else {
+		preview := t.Transcript
+		// The preview is cut on a rune boundary, so it stays valid UTF-8.
+		if runes := []rune(preview); len(runes) > slackPreviewLength {
+			preview = strings.TrimSpace(string(runes[:slackPreviewLength])) + "…"
+		}
+		message += "\n> " + preview
+	}
+	if len(t.AudioURL) > 0 {
+		message += "\n" + t.AudioURL
+	}
+	return message
+}
+
+const (
+	// defaultWebhookRetries is how many times a webhook is retried when
+	// config.Config.WebhookRetries is unset.
+	defaultWebhookRetries = 3
+	// webhookSignatureHeader holds the HMAC-SHA256 of the body, hex encoded
+	// and prefixed with "sha256=", when the webhook has a secret.
+	webhookSignatureHeader = "X-Transcribe-Signature"
+)
+
+// webhookRetryDelay is how long WebhookNotifier waits before its first retry.
+// It is a variable so that tests can shorten it.
+var webhookRetryDelay = time.Second
+
+// WebhookNotifier posts the JobEvent as JSON to a URL. If Secret is set, the
+// body is signed with it so the receiver can check where it came from.
+// Failed posts are retried Retries times with exponential backoff.
+type WebhookNotifier struct {
+	URL     string
+	Secret  string
+	Retries int
+}
+
+// Notify implements Notifier.
+func (n WebhookNotifier) Notify(event JobEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	header := http.Header{}
+	if len(n.Secret) > 0 {
+		header.Set(webhookSignatureHeader, signWebhook(n.Secret, body))
+	}
+
+	delay := webhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		err = postJSON(n.URL, body, header)
+		if err == nil || attempt >= n.Retries {
+			return errors.Trace(err)
+		}
+		log.WithField("task", event.ID).
+			Debugf("Webhook attempt %d failed, retrying in %v: %v", attempt+1, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// signWebhook returns the signature header value of body.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetries returns cfg.WebhookRetries, defaultWebhookRetries if it is
+// unset, or none if it is negative.
+func webhookRetries(cfg *config.AppConfig) int {
+	retries := cfg.WebhookRetries
+	if retries == 0 {
+		return defaultWebhookRetries
+	} else if retries < 0 {
+		return 0
+	}
+	return retries
+}
+
+// postJSON posts body to url with the given extra headers and fails unless
+// the response status is 2xx.
+func postJSON(url string, body []byte, header http.Header) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// configuredNotifiers returns a Notifier for every notification mechanism
+// enabled in cfg. Emails go to emailAddresses.
+func configuredNotifiers(cfg *config.AppConfig, emailAddresses []string) []Notifier {
+	notifiers := []Notifier{}
+	if len(cfg.EmailUsername) == 0 {
+		log.Debug("Not sending emails because EmailUsername is not configured")
+	} else {
+		notifiers = append(notifiers, EmailNotifier{
+			Username:   cfg.EmailUsername,
+			Password:   cfg.EmailPassword,
+			SMTPServer: cfg.EmailSMTPServer,
+			Port:       cfg.EmailPort,
+			To:         emailAddresses,
+			CC:         cfg.EmailCC,
+			BCC:        archiveBCC(cfg),
+			cfg:        cfg,
+		})
+	}
+	if len(cfg.SlackWebhookURL) > 0 {
+		notifiers = append(notifiers, SlackNotifier{WebhookURL: cfg.SlackWebhookURL})
+	}
+	if len(cfg.WebhookURL) > 0 {
+		notifiers = append(notifiers, WebhookNotifier{
+			URL:     cfg.WebhookURL,
+			Secret:  cfg.WebhookSecret,
+			Retries: webhookRetries(cfg),
+		})
+	}
+	return notifiers
+}
+
+// notifyAll sends event to every notifier. A notifier that fails is logged and
+// does not stop the others.
+func notifyAll(notifiers []Notifier, event JobEvent) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(event); err != nil {
+			log.WithFields(log.Fields{
+				"task":  event.ID,
+				"error": errors.ErrorStack(err),
+			}).Errorf("Could not notify with %T", notifier)
+			continue
+		}
+		log.WithField("task", event.ID).
+			Debugf("Notified with %T", notifier)
+	}
+}
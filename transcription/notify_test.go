@@ -0,0 +1,119 @@
+package transcription
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestSlackMessage(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("Transcription abc failed: could not download",
+		slackMessage(JobEvent{ID: "abc", Status: FAILED, Error: "could not download\nstack"}))
+	assert.Equal("Transcription abc is complete.\n> hello world\nhttps://example.com/a.wav",
+		slackMessage(JobEvent{ID: "abc", Status: COMPLETED, Transcription: &Transcription{
+			Transcript: "hello world",
+			AudioURL:   "https://example.com/a.wav",
+		}}))
+	assert.Equal("Transcription abc is complete. No speech was detected.",
+		slackMessage(JobEvent{ID: "abc", Status: COMPLETED, Transcription: &Transcription{Empty: true}}))
+
+	// Every character takes two bytes, so a byte count would cut one in half.
+	message := slackMessage(JobEvent{ID: "abc", Status: COMPLETED, Transcription: &Transcription{
+		Transcript: strings.Repeat("é", slackPreviewLength+1),
+	}})
+	assert.True(utf8.ValidString(message))
+	assert.True(strings.HasSuffix(message, strings.Repeat("é", slackPreviewLength)+"…"), message)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	assert := assert.New(t)
+	var received JobEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+		assert.NoError(json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	event := JobEvent{ID: "abc", Status: FAILED, Error: "oops"}
+	assert.NoError(WebhookNotifier{URL: server.URL}.Notify(event))
+	assert.Equal(event, received)
+}
+
+func TestWebhookNotifierRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	assert.Error(t, WebhookNotifier{URL: server.URL}.Notify(JobEvent{ID: "abc", Status: FAILED}))
+}
+
+func TestWebhookNotifierSignsAndRetries(t *testing.T) {
+	assert := assert.New(t)
+	defer func(delay time.Duration) { webhookRetryDelay = delay }(webhookRetryDelay)
+	webhookRetryDelay = time.Millisecond
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(signWebhook("secret", body), r.Header.Get(webhookSignatureHeader))
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	notifier := WebhookNotifier{URL: server.URL, Secret: "secret", Retries: 2}
+	assert.NoError(notifier.Notify(JobEvent{ID: "abc", Status: COMPLETED, Transcription: &Transcription{Transcript: "hi"}}))
+	assert.Equal(3, attempts)
+}
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '{"id":"abc"}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=4a735a43e7ae6518589db067fa7af9c75fcda827a52e0dc5e455f7031695ef70", signWebhook("secret", []byte(`{"id":"abc"}`)))
+}
+
+func TestEmailNotifierWithoutRecipients(t *testing.T) {
+	assert := assert.New(t)
+	// With no recipients nothing is sent, so the unreachable server is never
+	// contacted.
+	notifier := EmailNotifier{SMTPServer: "localhost", Port: 1}
+	assert.NoError(notifier.Notify(JobEvent{ID: "abc", Status: FAILED, Error: "oops"}))
+	assert.NoError(notifier.Notify(JobEvent{ID: "abc", Status: COMPLETED, Transcription: &Transcription{}}))
+
+	notifier.CC = []string{"cc@example.com"}
+	assert.NoError(notifier.Notify(JobEvent{ID: "abc", Status: FAILED, Error: "oops"}))
+	assert.Error(notifier.Notify(JobEvent{ID: "abc", Status: COMPLETED, Transcription: &Transcription{}}))
+}
+
+func TestConfiguredNotifiersUseGivenConfig(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &config.AppConfig{
+		EmailUsername:   "tenant@example.com",
+		EmailPassword:   "secret",
+		EmailArchiveBCC: "archive@example.com",
+		WebhookURL:      "https://tenant.example.com/hook",
+		WebhookRetries:  -1,
+	}
+
+	notifiers := configuredNotifiers(cfg, []string{"user@example.com"})
+	if assert.Len(notifiers, 2) {
+		assert.Equal("tenant@example.com", notifiers[0].(EmailNotifier).Username)
+		assert.Equal([]string{"archive@example.com"}, notifiers[0].(EmailNotifier).BCC)
+		assert.Equal(WebhookNotifier{URL: "https://tenant.example.com/hook"}, notifiers[1])
+	}
+	assert.Equal(AzureStorage{Container: "audio", ConnectionString: "AccountName=a"},
+		configuredStorage(&config.AppConfig{AzureContainer: "audio", AzureConnectionString: "AccountName=a"}))
+	assert.Nil(configuredStorage(&config.AppConfig{}))
+}
@@ -0,0 +1,98 @@
+package transcription
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// WriteTranscriptFile writes the plain transcript of t to the file at path,
+// replacing it if it exists.
+func WriteTranscriptFile(t *Transcription, path string) error {
+	return writeOutputFile(path, func(w io.Writer) error {
+		return exportText(t, w)
+	})
+}
+
+// WriteOutputFiles writes the transcript of t to dir as <name>.txt and, if
+// config.Config.OutputSRT or OutputVTT is set, the subtitles as <name>.srt or
+// <name>.vtt. It returns the paths of the files written.
+func WriteOutputFiles(t *Transcription, dir string, name string) ([]string, error) {
+	cfg := config.GetConfig()
+	return writeOutputFiles(t, dir, name, cfg.OutputSRT, cfg.OutputVTT)
+}
+
+// outputName returns the name of the output files of job id, which
+// transcribed source. The id keeps jobs with the same source file name from
+// replacing each other's files.
+func outputName(source string, id string) string {
+	base, _ := fileNameFromURL(source)
+	return base + "_" + id
+}
+
+// writeOutputFiles is WriteOutputFiles with the subtitle formats given
+// explicitly. The WebVTT subtitles are written by ExportRichVTT if
+// config.Config.RichVTT is set. A missing dir is created readable only by
+// this user, like the files.
+func writeOutputFiles(t *Transcription, dir string, name string, srt bool, vtt bool) ([]string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Trace(err)
+	}
+	paths := []string{}
+
+	txtPath := filepath.Join(dir, name+".txt")
+	if err := WriteTranscriptFile(t, txtPath); err != nil {
+		return paths, errors.Trace(err)
+	}
+	paths = append(paths, txtPath)
+
+	exportVTT := ExportVTT
+	if config.GetConfig().RichVTT {
+		exportVTT = ExportRichVTT
+	}
+	subtitles := []struct {
+		enabled bool
+		ext     string
+		export  func(*Transcription, io.Writer) error
+	}{
+		{srt, ".srt", ExportSRT},
+		{vtt, ".vtt", exportVTT},
+	}
+	for _, format := range subtitles {
+		if !format.enabled {
+			continue
+		}
+		path := filepath.Join(dir, name+format.ext)
+		err := writeOutputFile(path, func(w io.Writer) error {
+			return format.export(t, w)
+		})
+		if err != nil {
+			return paths, errors.Trace(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// writeOutputFile creates the file at path with the same restricted mode as
+// the intermediate files, since it holds the same content, and fills it with
+// write.
+func writeOutputFile(path string, write func(io.Writer) error) error {
+	file, err := createTempFile(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return errors.Trace(err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package transcription
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestWriteOutputFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "output")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	defer func(srt bool) { config.Config.OutputSRT = srt }(config.Config.OutputSRT)
+	config.Config.OutputSRT = true
+
+	transcription := &Transcription{
+		Transcript: "hello world ",
+		Timestamps: []timestamp{{"hello", 0, 0.5}, {"world", 0.5, 1}},
+	}
+	paths, err := WriteOutputFiles(transcription, filepath.Join(dir, "out"), "meeting")
+	assert.NoError(err)
+	assert.Equal([]string{filepath.Join(dir, "out", "meeting.txt"), filepath.Join(dir, "out", "meeting.srt")}, paths)
+
+	contents, err := ioutil.ReadFile(paths[0])
+	assert.NoError(err)
+	assert.Equal("hello world\n", string(contents))
+	contents, err = ioutil.ReadFile(paths[1])
+	assert.NoError(err)
+	assert.Contains(string(contents), "00:00:00,000 --> 00:00:01,000")
+	info, err := os.Stat(filepath.Join(dir, "out"))
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0700), info.Mode().Perm())
+}
+
+func TestOutputName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("Keynote_job-1", outputName("https://example.com/talks/Keynote.MP3?token=abc", "job-1"))
+	assert.Equal("Keynote_job-2", outputName("/recordings/Keynote.mp3", "job-2"))
+}
+
+func TestFileNameFromURL(t *testing.T) {
+	assert := assert.New(t)
+	base, ext := fileNameFromURL("https://example.com/talks/Keynote.MP3?token=abc")
+	assert.Equal("Keynote", base)
+	assert.Equal(".MP3", ext)
+	base, _ = fileNameFromURL("data:audio/wav;base64,UklGRg==")
+	assert.Equal("inline", base)
+}
+
+func TestWriteOutputFilesWithVTT(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "output")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	transcription := &Transcription{
+		Transcript: "hello world ",
+		Timestamps: []timestamp{{"hello", 0, 0.5}, {"world", 0.5, 1}},
+	}
+	paths, err := writeOutputFiles(transcription, dir, "meeting", false, true)
+	assert.NoError(err)
+	assert.Equal([]string{filepath.Join(dir, "meeting.txt"), filepath.Join(dir, "meeting.vtt")}, paths)
+}
+
+func TestTranscribeRequiresSource(t *testing.T) {
+	_, err := Transcribe(Options{})
+	assert.Error(t, err)
+}
+
+func TestIsLocalSource(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(isLocalSource("/home/me/talk.mp3"))
+	assert.True(isLocalSource("talk.mp3"))
+	assert.False(isLocalSource("https://example.com/talk.mp3"))
+	assert.False(isLocalSource("sftp://example.com/talk.mp3"))
+	assert.False(isLocalSource("data:audio/wav;base64,UklGRg=="))
+}
+
+func TestJobFunctionRejectsLocalSource(t *testing.T) {
+	job, _ := MakeIBMJobFunction("/etc/passwd", nil, nil, TaskOptions{})
+	_, err := job("local")
+	assert.True(t, errors.IsNotValid(err), "%v", err)
+}
@@ -0,0 +1,120 @@
+package transcription
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// AudioInfo describes the streams of a media file as reported by ffprobe.
+type AudioInfo struct {
+	HasAudio   bool
+	HasVideo   bool
+	Codec      string
+	SampleRate int
+	Channels   int
+	Duration   float64
+	Chapters   []Chapter
+}
+
+type ffprobeOutput struct {
+	Streams  []ffprobeStream  `json:"streams"`
+	Format   ffprobeFormat    `json:"format"`
+	Chapters []ffprobeChapter `json:"chapters"`
+}
+
+type ffprobeStream struct {
+	CodecType   string            `json:"codec_type"`
+	CodecName   string            `json:"codec_name"`
+	SampleRate  string            `json:"sample_rate"`
+	Channels    int               `json:"channels"`
+	Disposition map[string]int    `json:"disposition"`
+	Tags        map[string]string `json:"tags"`
+}
+
+type ffprobeFormat struct {
+	Duration string            `json:"duration"`
+	Tags     map[string]string `json:"tags"`
+}
+
+// ProbeAudio uses ffprobe to describe the audio and video streams of a file.
+func ProbeAudio(filePath string) (*AudioInfo, error) {
+	probe, err := runFFprobe(filePath)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	info := new(AudioInfo)
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "audio":
+			if info.HasAudio {
+				continue
+			}
+			info.HasAudio = true
+			info.Codec = stream.CodecName
+			info.Channels = stream.Channels
+			info.SampleRate, _ = strconv.Atoi(stream.SampleRate)
+		case "video":
+			// Embedded cover art is reported as a video stream.
+			if stream.Disposition["attached_pic"] == 0 {
+				info.HasVideo = true
+			}
+		}
+	}
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	info.Chapters = probeChapters(probe)
+	return info, nil
+}
+
+// ExtractMetadata returns the tags of a media file, such as the ID3 title and
+// artist of an MP3, with lowercased keys. Tags of the container take
+// precedence over those of the audio stream, which is where some formats
+// such as Ogg keep them. A file without tags has empty metadata.
+func ExtractMetadata(filePath string) (map[string]string, error) {
+	probe, err := runFFprobe(filePath)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return probeMetadata(probe), nil
+}
+
+func probeMetadata(probe *ffprobeOutput) map[string]string {
+	metadata := make(map[string]string)
+	for key, value := range probe.Format.Tags {
+		metadata[strings.ToLower(key)] = value
+	}
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "audio" {
+			continue
+		}
+		for key, value := range stream.Tags {
+			if _, ok := metadata[strings.ToLower(key)]; !ok {
+				metadata[strings.ToLower(key)] = value
+			}
+		}
+		break
+	}
+	return metadata
+}
+
+// runFFprobe runs ffprobe on filePath and decodes its JSON description.
+func runFFprobe(filePath string) (*ffprobeOutput, error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", "-show_format", "-show_chapters", filePath)
+	out, err := cmd.Output()
+	if err != nil {
+		if isNotInstalled(err) {
+			return nil, ErrFFmpegNotInstalled
+		}
+		return nil, errors.Annotatef(err, "could not probe %s", filePath)
+	}
+
+	probe := new(ffprobeOutput)
+	if err := json.Unmarshal(out, probe); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return probe, nil
+}
@@ -0,0 +1,31 @@
+package transcription
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	probe := new(ffprobeOutput)
+	assert.NoError(json.Unmarshal([]byte(`{
+		"streams": [
+			{"codec_type": "audio", "tags": {"TITLE": "Stream Title", "LANGUAGE": "eng"}}
+		],
+		"format": {"tags": {"title": "Episode 12", "artist": "Hack4Impact"}}
+	}`), probe))
+	assert.Equal(map[string]string{
+		"title":    "Episode 12",
+		"artist":   "Hack4Impact",
+		"language": "eng",
+	}, probeMetadata(probe))
+}
+
+func TestProbeMetadataWithoutTags(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(map[string]string{}, probeMetadata(&ffprobeOutput{}))
+}
@@ -0,0 +1,90 @@
+package transcription
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// rangeMarginSeconds is how much audio EstimateByteRange adds on either side
+// of the requested times, since the bitrate of most files is not exactly
+// constant.
+const rangeMarginSeconds = 2.0
+
+// EstimateByteRange returns the first and last byte of a file of
+// contentLength bytes and duration seconds that hold the audio from start to
+// end seconds, plus a margin, assuming a constant bitrate.
+func EstimateByteRange(contentLength int64, duration float64, start float64, end float64) (int64, int64) {
+	if duration <= 0 || contentLength <= 0 {
+		return 0, contentLength - 1
+	}
+	bytesPerSecond := float64(contentLength) / duration
+	first := int64(math.Floor(math.Max(0, start-rangeMarginSeconds) * bytesPerSecond))
+	last := int64(math.Ceil(math.Min(duration, end+rangeMarginSeconds)*bytesPerSecond)) - 1
+	if last >= contentLength {
+		last = contentLength - 1
+	}
+	if first > last {
+		first = last
+	}
+	return first, last
+}
+
+// DownloadFileRange downloads bytes first through last of the file at url,
+// such as the range from EstimateByteRange, to save fetching all of a long
+// recording when only part of it is needed. If the server does not advertise
+// byte ranges, the whole file is downloaded instead.
+//
+// Only formats that can be decoded from any point, such as MP3 and ADTS AAC,
+// can be transcribed this way. The header at the start of formats such as WAV
+// and MP4 is missing from the range.
+func DownloadFileRange(url string, first int64, last int64) (string, error) {
+	if first < 0 || last < first {
+		return "", errors.NotValidf("byte range %d-%d", first, last)
+	}
+	client, err := downloadClient(0)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if !acceptsRanges(client, url) {
+		log.Debugf("%s does not accept byte ranges, downloading all of it", url)
+		return downloadFileToDir(url, "")
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, last))
+	filePath := filePathFromURL(url)
+	status, err := downloadRequest(client, req, filePath, config.GetConfig().MaxDownloadBytes)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	switch status {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		log.Debugf("%s ignored the byte range and sent all of the file", url)
+	default:
+		os.Remove(filePath)
+		return "", errors.Errorf("GET %s bytes %d-%d returned %d", url, first, last, status)
+	}
+	return filePath, nil
+}
+
+// acceptsRanges reports whether a HEAD request to url says that it serves
+// byte ranges.
+func acceptsRanges(client *http.Client, url string) bool {
+	response, err := client.Head(url)
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
+	return response.StatusCode == http.StatusOK && response.Header.Get("Accept-Ranges") == "bytes"
+}
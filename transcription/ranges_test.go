@@ -0,0 +1,64 @@
+package transcription
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateByteRange(t *testing.T) {
+	assert := assert.New(t)
+	// An hour at 16000 bytes per second.
+	first, last := EstimateByteRange(57600000, 3600, 600, 900)
+	assert.Equal(int64(598*16000), first)
+	assert.Equal(int64(902*16000-1), last)
+
+	first, last = EstimateByteRange(57600000, 3600, 0, 3600)
+	assert.Equal(int64(0), first)
+	assert.Equal(int64(57600000-1), last)
+
+	first, last = EstimateByteRange(1000, 0, 10, 20)
+	assert.Equal(int64(0), first)
+	assert.Equal(int64(999), last)
+}
+
+func TestDownloadFileRange(t *testing.T) {
+	assert := assert.New(t)
+	content := strings.Repeat("0123456789", 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "talk.mp3", time.Time{}, bytes.NewReader([]byte(content)))
+	}))
+	defer server.Close()
+
+	filePath, err := DownloadFileRange(server.URL+"/talk.mp3", 15, 24)
+	if assert.NoError(err) {
+		defer os.Remove(filePath)
+		downloaded, _ := ioutil.ReadFile(filePath)
+		assert.Equal("5678901234", string(downloaded))
+	}
+
+	_, err = DownloadFileRange(server.URL+"/talk.mp3", 200, 300)
+	assert.Error(err)
+}
+
+func TestDownloadFileRangeWithoutServerSupport(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("whole file"))
+	}))
+	defer server.Close()
+
+	filePath, err := DownloadFileRange(server.URL+"/talk.mp3", 0, 4)
+	if assert.NoError(err) {
+		defer os.Remove(filePath)
+		downloaded, _ := ioutil.ReadFile(filePath)
+		assert.Equal("whole file", string(downloaded))
+	}
+}
@@ -0,0 +1,90 @@
+package transcription
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// ibmLimiter is shared by every IBM request, whichever job it belongs to,
+// since IBM limits requests per account rather than per job.
+var ibmLimiter = &requestLimiter{}
+
+// requestLimiter is a token bucket combined with a limit on the number of
+// requests in progress.
+type requestLimiter struct {
+	mu      sync.Mutex
+	started bool
+	tokens  float64
+	last    time.Time
+	active  int
+	// released is closed and replaced whenever a request finishes, to wake
+	// the requests waiting for it.
+	released chan struct{}
+}
+
+// acquireIBM waits until an IBM request may start under the limits in
+// config.Config and returns the function to call when it is done.
+func acquireIBM(ctx context.Context) (func(), error) {
+	cfg := config.GetConfig()
+	return ibmLimiter.acquire(ctx, cfg.IBMRequestsPerSecond, cfg.IBMBurst, cfg.IBMMaxConcurrent)
+}
+
+// acquire waits until a request may start without exceeding rate requests per
+// second, in bursts of up to burst, or maxConcurrent requests at once. A rate
+// or maxConcurrent of zero or less is unlimited. It gives up when ctx is done.
+func (l *requestLimiter) acquire(ctx context.Context, rate float64, burst int, maxConcurrent int) (func(), error) {
+	if burst <= 0 {
+		burst = 1
+	}
+	for {
+		l.mu.Lock()
+		if l.released == nil {
+			l.released = make(chan struct{})
+		}
+		current := now()
+		if !l.started {
+			l.started = true
+			l.tokens = float64(burst)
+		} else if rate > 0 {
+			l.tokens = math.Min(float64(burst), l.tokens+current.Sub(l.last).Seconds()*rate)
+		}
+		l.last = current
+
+		free := maxConcurrent <= 0 || l.active < maxConcurrent
+		if free && (rate <= 0 || l.tokens >= 1) {
+			if rate > 0 {
+				l.tokens--
+			}
+			l.active++
+			l.mu.Unlock()
+			return l.release, nil
+		}
+
+		released := l.released
+		var wait <-chan time.Time
+		if free {
+			// Only a token is missing, which will arrive at a known time.
+			wait = time.After(time.Duration((1 - l.tokens) / rate * float64(time.Second)))
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-released:
+		case <-wait:
+		}
+	}
+}
+
+func (l *requestLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	close(l.released)
+	l.released = make(chan struct{})
+}
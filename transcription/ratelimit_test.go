@@ -0,0 +1,61 @@
+package transcription
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLimiterConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	limiter := &requestLimiter{}
+
+	release, err := limiter.acquire(context.Background(), 0, 0, 1)
+	assert.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = limiter.acquire(ctx, 0, 0, 1)
+	assert.Equal(context.DeadlineExceeded, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := limiter.acquire(context.Background(), 0, 0, 1)
+		assert.NoError(err)
+		release()
+		close(acquired)
+	}()
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("waiting request was not woken by release")
+	}
+}
+
+func TestRequestLimiterRate(t *testing.T) {
+	assert := assert.New(t)
+	frozen := time.Unix(100, 0)
+	defer freezeTime(frozen)()
+	limiter := &requestLimiter{}
+
+	// The bucket starts full.
+	for i := 0; i < 2; i++ {
+		release, err := limiter.acquire(context.Background(), 1, 2, 0)
+		assert.NoError(err)
+		release()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := limiter.acquire(ctx, 1, 2, 0)
+	assert.Equal(context.DeadlineExceeded, err)
+
+	// A second later there is another token.
+	now = func() time.Time { return frozen.Add(time.Second) }
+	release, err := limiter.acquire(context.Background(), 1, 2, 0)
+	assert.NoError(err)
+	release()
+}
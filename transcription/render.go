@@ -0,0 +1,64 @@
+package transcription
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// Formatter writes a transcription to w in one output format.
+type Formatter func(t *Transcription, w io.Writer) error
+
+// formatters maps the name of every output format to its Formatter.
+var formatters = struct {
+	sync.RWMutex
+	m map[string]Formatter
+}{m: map[string]Formatter{
+	"csv":     ExportTimestampsCSV,
+	"richvtt": ExportRichVTT,
+	"rtf":     ExportRTF,
+	"srt":     ExportSRT,
+	"txt":     exportText,
+	"vtt":     ExportVTT,
+}}
+
+// RegisterFormatter makes fn available to Render under name, replacing any
+// formatter already registered under it, including the built-in ones: srt,
+// vtt, richvtt, csv, rtf and txt. Names are case-insensitive.
+func RegisterFormatter(name string, fn Formatter) {
+	formatters.Lock()
+	defer formatters.Unlock()
+	formatters.m[strings.ToLower(name)] = fn
+}
+
+// Formats returns the names of the registered formatters in sorted order.
+func Formats() []string {
+	formatters.RLock()
+	defer formatters.RUnlock()
+	names := make([]string, 0, len(formatters.m))
+	for name := range formatters.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render writes t to w with the formatter registered under format.
+func (t *Transcription) Render(format string, w io.Writer) error {
+	formatters.RLock()
+	fn, ok := formatters.m[strings.ToLower(format)]
+	formatters.RUnlock()
+	if !ok {
+		return errors.NotFoundf("formatter %q", format)
+	}
+	return errors.Trace(fn(t, w))
+}
+
+// exportText writes the plain transcript of t to w.
+func exportText(t *Transcription, w io.Writer) error {
+	_, err := io.WriteString(w, strings.TrimSpace(t.Transcript)+"\n")
+	return errors.Trace(err)
+}
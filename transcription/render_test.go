@@ -0,0 +1,47 @@
+package transcription
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{
+		Transcript: "hello world ",
+		Timestamps: []timestamp{{"hello", 0, 0.5}, {"world", 0.5, 1}},
+	}
+
+	var buffer bytes.Buffer
+	assert.NoError(transcription.Render("txt", &buffer))
+	assert.Equal("hello world\n", buffer.String())
+
+	buffer.Reset()
+	assert.NoError(transcription.Render("SRT", &buffer))
+	assert.Equal("1\n00:00:00,000 --> 00:00:01,000\nhello world\n\n", buffer.String())
+
+	err := transcription.Render("docx", &buffer)
+	assert.True(errors.IsNotFound(err))
+}
+
+func TestRegisterFormatter(t *testing.T) {
+	assert := assert.New(t)
+	RegisterFormatter("Shout", func(t *Transcription, w io.Writer) error {
+		_, err := io.WriteString(w, "HELLO")
+		return err
+	})
+	defer func() {
+		formatters.Lock()
+		delete(formatters.m, "shout")
+		formatters.Unlock()
+	}()
+
+	assert.Equal([]string{"csv", "richvtt", "rtf", "shout", "srt", "txt", "vtt"}, Formats())
+	var buffer bytes.Buffer
+	assert.NoError((&Transcription{}).Render("shout", &buffer))
+	assert.Equal("HELLO", buffer.String())
+}
@@ -0,0 +1,89 @@
+package transcription
+
+import (
+	"strings"
+)
+
+// defaultSnippetContextWords is how many words Search shows on either side
+// of a match.
+const defaultSnippetContextWords = 5
+
+// SearchOptions configures Transcription.SearchWithOptions.
+type SearchOptions struct {
+	// Exact only matches words with the same case and punctuation as the
+	// query. Otherwise both are ignored.
+	Exact bool
+	// ContextWords is how many words to include on either side of a match.
+	ContextWords int
+}
+
+// Snippet is an occurrence of a search query in a transcript, with the words
+// around it.
+type Snippet struct {
+	Text      string
+	Context   string
+	StartTime float64
+	EndTime   float64
+}
+
+// Search finds every occurrence of query in the transcript, ignoring case and
+// punctuation. A query may contain several words, which must then appear
+// consecutively.
+func (t *Transcription) Search(query string) []Snippet {
+	return t.SearchWithOptions(query, SearchOptions{ContextWords: defaultSnippetContextWords})
+}
+
+// SearchWithOptions is like Search, but configurable.
+func (t *Transcription) SearchWithOptions(query string, opts SearchOptions) []Snippet {
+	queryWords := strings.Fields(query)
+	snippets := []Snippet{}
+	if len(queryWords) == 0 {
+		return snippets
+	}
+
+	words := transcriptionWords(t)
+	// Prefer the words of the transcript itself, which may have been
+	// punctuated by NormalizeTranscript, when they line up with the timestamps.
+	texts := strings.Fields(t.Transcript)
+	if len(texts) != len(words) {
+		texts = make([]string, len(words))
+		for i, word := range words {
+			texts[i] = word.Word
+		}
+	}
+
+	for i := 0; i+len(queryWords) <= len(texts); i++ {
+		if !searchMatches(texts[i:i+len(queryWords)], queryWords, opts.Exact) {
+			continue
+		}
+		end := i + len(queryWords)
+		contextStart := i - opts.ContextWords
+		if contextStart < 0 {
+			contextStart = 0
+		}
+		contextEnd := end + opts.ContextWords
+		if contextEnd > len(texts) {
+			contextEnd = len(texts)
+		}
+		snippets = append(snippets, Snippet{
+			Text:      strings.Join(texts[i:end], " "),
+			Context:   strings.Join(texts[contextStart:contextEnd], " "),
+			StartTime: words[i].StartTime,
+			EndTime:   words[end-1].EndTime,
+		})
+	}
+	return snippets
+}
+
+func searchMatches(words []string, queryWords []string, exact bool) bool {
+	for i, word := range words {
+		if exact {
+			if word != queryWords[i] {
+				return false
+			}
+		} else if normalizeKeywordWord(word, false) != normalizeKeywordWord(queryWords[i], false) {
+			return false
+		}
+	}
+	return true
+}
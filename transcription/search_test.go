@@ -0,0 +1,38 @@
+package transcription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var searchTranscription = &Transcription{
+	Transcript: "Welcome back. The budget vote is today, and the Budget passed.",
+	Timestamps: []timestamp{
+		{"welcome", 0, 0.5}, {"back", 0.5, 1}, {"the", 1.5, 1.6}, {"budget", 1.6, 2},
+		{"vote", 2, 2.4}, {"is", 2.4, 2.5}, {"today", 2.5, 3}, {"and", 3.2, 3.4},
+		{"the", 3.4, 3.5}, {"budget", 3.5, 4}, {"passed", 4, 4.5},
+	},
+}
+
+func TestSearch(t *testing.T) {
+	assert := assert.New(t)
+
+	snippets := searchTranscription.Search("budget vote")
+	assert.Equal([]Snippet{{
+		Text:      "budget vote",
+		Context:   "Welcome back. The budget vote is today, and the Budget",
+		StartTime: 1.6,
+		EndTime:   2.4,
+	}}, snippets)
+	assert.Len(searchTranscription.Search("BUDGET"), 2)
+	assert.Len(searchTranscription.Search("today"), 1)
+}
+
+func TestSearchExact(t *testing.T) {
+	assert := assert.New(t)
+
+	snippets := searchTranscription.SearchWithOptions("Budget", SearchOptions{Exact: true, ContextWords: 1})
+	assert.Equal([]Snippet{{"Budget", "the Budget passed.", 3.5, 4}}, snippets)
+	assert.Empty(searchTranscription.SearchWithOptions("today", SearchOptions{Exact: true}))
+}
@@ -0,0 +1,53 @@
+package transcription
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// SelfTest transcribes the sample clip at config.Config.SelfTestAudioPath and
+// checks that its transcript contains every word of config.Config.SelfTestWords.
+// It exercises ffmpeg, the IBM credentials and the whole convert, split and
+// transcribe path, so it is a quick check that a deployment works end to end.
+func SelfTest() error {
+	cfg := config.GetConfig()
+	return selfTest(&cfg, nil)
+}
+
+// selfTest is SelfTest with the settings of cfg, transcribing with engine, or
+// IBM if it is nil.
+func selfTest(cfg *config.AppConfig, engine Transcriber) error {
+	samplePath := cfg.SelfTestAudioPath
+	expectedWords := cfg.SelfTestWords
+	if len(samplePath) == 0 || len(expectedWords) == 0 {
+		return errors.New("SelfTestAudioPath and SelfTestWords must be configured to run the self-test")
+	}
+	if _, err := os.Stat(samplePath); err != nil {
+		return errors.Annotate(err, "could not find the self-test audio")
+	}
+
+	transcription, err := transcribeFile(context.Background(), cfg, engine, "self-test", samplePath, nil, nil)
+	if err != nil {
+		return errors.Annotate(err, "self-test transcription failed")
+	}
+
+	words := map[string]bool{}
+	for _, word := range strings.Fields(transcription.Transcript) {
+		words[normalizeKeywordWord(word, false)] = true
+	}
+	missing := []string{}
+	for _, word := range expectedWords {
+		if !words[normalizeKeywordWord(word, false)] {
+			missing = append(missing, word)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("self-test transcript %q is missing the words %v", transcription.Transcript, missing)
+	}
+	return nil
+}
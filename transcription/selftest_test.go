@@ -0,0 +1,79 @@
+package transcription
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// writeSilentWav writes seconds of 16khz mono silence to path.
+func writeSilentWav(path string, seconds int) error {
+	dataSize := uint32(seconds * wideSampleRate * wavBytesPerSample)
+	header := struct {
+		RIFF          [4]byte
+		Size          uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + dataSize, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, 16, 1, 1, wideSampleRate, wideSampleRate * wavBytesPerSample, wavBytesPerSample, 8 * wavBytesPerSample,
+		[4]byte{'d', 'a', 't', 'a'}, dataSize,
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := binary.Write(file, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	_, err = file.Write(make([]byte, dataSize))
+	return err
+}
+
+func TestSelfTestRequiresSample(t *testing.T) {
+	assert := assert.New(t)
+	assert.Error(selfTest(&config.AppConfig{}, &FakeTranscriber{}))
+	assert.Error(selfTest(&config.AppConfig{SelfTestAudioPath: "missing.wav", SelfTestWords: []string{"hello"}}, &FakeTranscriber{}))
+}
+
+func TestSelfTestWithFake(t *testing.T) {
+	if err := CheckFFmpeg(); err != nil {
+		t.Skip(err)
+	}
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "selftest")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	samplePath := filepath.Join(dir, "sample.wav")
+	assert.NoError(writeSilentWav(samplePath, 3))
+
+	fake := &FakeTranscriber{Default: &Transcription{
+		Transcript: "hello world ",
+		Timestamps: []timestamp{{"hello", 0, 0.5}, {"world", 0.5, 1}},
+	}}
+	cfg := &config.AppConfig{ChunkRetries: -1, SelfTestAudioPath: samplePath, SelfTestWords: []string{"Hello", "world"}}
+	assert.NoError(selfTest(cfg, fake))
+	assert.Len(fake.Calls(), 1)
+
+	cfg.SelfTestWords = []string{"hello", "goodbye"}
+	err = selfTest(cfg, fake)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "goodbye")
+	}
+}
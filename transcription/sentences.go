@@ -0,0 +1,61 @@
+package transcription
+
+import (
+	"strings"
+)
+
+// sentencePauseSeconds is the pause between two words that ends a sentence
+// when the transcript has no punctuation.
+const sentencePauseSeconds = 0.8
+
+// Sentence is a sentence of a transcript with its time range.
+type Sentence struct {
+	Text      string
+	StartTime float64
+	EndTime   float64
+}
+
+// Sentences divides the transcript into sentences. If the transcript is
+// punctuated, for example by NormalizeTranscript, sentences end at periods,
+// question marks and exclamation marks. Otherwise they end at pauses of at
+// least sentencePauseSeconds.
+func (t *Transcription) Sentences() []Sentence {
+	words := transcriptionWords(t)
+	texts := strings.Fields(t.Transcript)
+	punctuated := len(texts) == len(words)
+	if punctuated {
+		punctuated = false
+		for _, text := range texts {
+			if endsSentence(text) {
+				punctuated = true
+				break
+			}
+		}
+	}
+	if !punctuated {
+		texts = make([]string, len(words))
+		for i, word := range words {
+			texts[i] = word.Word
+		}
+	}
+
+	sentences := []Sentence{}
+	start := 0
+	for i := range words {
+		var end bool
+		if punctuated {
+			end = endsSentence(texts[i])
+		} else {
+			end = i+1 < len(words) && words[i+1].StartTime-words[i].EndTime >= sentencePauseSeconds
+		}
+		if end || i == len(words)-1 {
+			sentences = append(sentences, Sentence{
+				Text:      strings.Join(texts[start:i+1], " "),
+				StartTime: words[start].StartTime,
+				EndTime:   words[i].EndTime,
+			})
+			start = i + 1
+		}
+	}
+	return sentences
+}
@@ -0,0 +1,35 @@
+package transcription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sentenceTimestamps = []timestamp{
+	{"hello", 0, 0.4}, {"there", 0.4, 0.8}, {"how", 2, 2.2}, {"are", 2.2, 2.4}, {"you", 2.4, 2.6},
+}
+
+func TestSentencesFromPunctuation(t *testing.T) {
+	assert := assert.New(t)
+
+	transcription := &Transcription{Transcript: "Hello there how are you?", Timestamps: sentenceTimestamps}
+	assert.Equal([]Sentence{{"Hello there how are you?", 0, 2.6}}, transcription.Sentences())
+
+	transcription.Transcript = "Hello there. How are you?"
+	assert.Equal([]Sentence{
+		{"Hello there.", 0, 0.8},
+		{"How are you?", 2, 2.6},
+	}, transcription.Sentences())
+}
+
+func TestSentencesFromPauses(t *testing.T) {
+	assert := assert.New(t)
+
+	transcription := &Transcription{Transcript: "hello there how are you", Timestamps: sentenceTimestamps}
+	assert.Equal([]Sentence{
+		{"hello there", 0, 0.8},
+		{"how are you", 2, 2.6},
+	}, transcription.Sentences())
+	assert.Empty((&Transcription{}).Sentences())
+}
@@ -0,0 +1,101 @@
+package transcription
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// These are the silencedetect settings used for Transcription.Segments.
+const (
+	defaultSilenceNoiseDB    = -30
+	defaultMinSilenceSeconds = 0.5
+)
+
+// These are the kinds of a Segment.
+const (
+	SPEECH  = "speech"
+	SILENCE = "silence"
+)
+
+// Segment is a span of audio that either contains speech or does not.
+type Segment struct {
+	Kind      string
+	StartTime float64
+	EndTime   float64
+}
+
+// DetectSegments uses ffmpeg's silencedetect filter to divide a file into
+// speech and silence segments. Audio quieter than noiseDB for at least
+// minSilence seconds counts as silence.
+func DetectSegments(filePath string, noiseDB float64, minSilence float64) ([]Segment, error) {
+	duration, err := getAudioDuration(filePath)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	filter := fmt.Sprintf("silencedetect=noise=%gdB:d=%g", noiseDB, minSilence)
+	out, err := runFFmpegOutput("-i", filePath, "-af", filter, "-f", "null", "-")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return parseSilenceDetect(out, duration), nil
+}
+
+// parseSilenceDetect turns the silence_start and silence_end lines logged by
+// silencedetect into segments covering the whole duration.
+func parseSilenceDetect(out string, duration float64) []Segment {
+	segments := []Segment{}
+	position := 0.0
+	silenceStart := -1.0
+
+	add := func(kind string, start, end float64) {
+		if end > start {
+			segments = append(segments, Segment{kind, start, end})
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := silenceDetectValue(line, "silence_start: "); ok {
+			silenceStart = value
+			add(SPEECH, position, silenceStart)
+			position = silenceStart
+		} else if value, ok := silenceDetectValue(line, "silence_end: "); ok && silenceStart >= 0 {
+			add(SILENCE, silenceStart, value)
+			position = value
+			silenceStart = -1
+		}
+	}
+
+	// A silence that is still open runs to the end of the file.
+	if silenceStart >= 0 {
+		add(SILENCE, silenceStart, duration)
+	} else {
+		add(SPEECH, position, duration)
+	}
+	return segments
+}
+
+// silenceDetectValue parses the number following key in line.
+func silenceDetectValue(line, key string) (float64, bool) {
+	i := strings.Index(line, key)
+	if i < 0 {
+		return 0, false
+	}
+	fields := strings.Fields(line[i+len(key):])
+	if len(fields) == 0 {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	if value < 0 {
+		value = 0
+	}
+	return value, true
+}
@@ -0,0 +1,32 @@
+package transcription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const silenceDetectOutput = `Input #0, wav, from 'talk.wav':
+[silencedetect @ 0x7f] silence_start: 2.5
+[silencedetect @ 0x7f] silence_end: 4 | silence_duration: 1.5
+[silencedetect @ 0x7f] silence_start: 9.25
+size=N/A time=00:00:10.00 bitrate=N/A speed= 500x
+`
+
+func TestParseSilenceDetect(t *testing.T) {
+	assert := assert.New(t)
+
+	segments := parseSilenceDetect(silenceDetectOutput, 10)
+	assert.Equal([]Segment{
+		{SPEECH, 0, 2.5},
+		{SILENCE, 2.5, 4},
+		{SPEECH, 4, 9.25},
+		{SILENCE, 9.25, 10},
+	}, segments)
+}
+
+func TestParseSilenceDetectWithoutSilence(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]Segment{{SPEECH, 0, 10}}, parseSilenceDetect("", 10))
+}
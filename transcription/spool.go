@@ -0,0 +1,75 @@
+package transcription
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// ResultSpool appends IBMResults to a file on disk as each chunk completes, one
+// JSON document per line, so that very long jobs do not hold every raw result
+// in memory until the transcription is assembled.
+type ResultSpool struct {
+	path    string
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewResultSpool creates (or truncates) the spool file at path.
+func NewResultSpool(path string) (*ResultSpool, error) {
+	file, err := createTempFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &ResultSpool{
+		path:    path,
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// Append writes result to the end of the spool.
+func (s *ResultSpool) Append(result *IBMResult) error {
+	return errors.Trace(s.encoder.Encode(result))
+}
+
+// Transcription assembles a Transcription from the spooled results, reading
+// them back from disk one at a time.
+func (s *ResultSpool) Transcription() (*Transcription, error) {
+	cfg := config.GetConfig()
+	return s.transcription(&cfg)
+}
+
+// transcription is Transcription with the settings of cfg.
+func (s *ResultSpool) transcription(cfg *config.AppConfig) (*Transcription, error) {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer s.file.Seek(0, io.SeekEnd)
+
+	builder := newTranscriptionBuilder(cfg)
+	decoder := json.NewDecoder(bufio.NewReader(s.file))
+	for {
+		result := new(IBMResult)
+		err := decoder.Decode(result)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Annotatef(err, "could not read spooled result from %s", s.path)
+		}
+		builder.addChunk(result)
+	}
+	return builder.build(), nil
+}
+
+// Remove closes and deletes the spool file.
+func (s *ResultSpool) Remove() error {
+	s.file.Close()
+	return errors.Trace(os.Remove(s.path))
+}
@@ -0,0 +1,36 @@
+package transcription
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultSpoolMatchesGetTranscription(t *testing.T) {
+	assert := assert.New(t)
+	results := []*IBMResult{}
+	for _, text := range []string{
+		`{"results":[{"alternatives":[{"transcript":"hello world ","timestamps":[["hello",0.1,0.5],["world",0.5,0.9]],"word_confidence":[["hello",0.9],["world",0.8]]}]}]}`,
+		`{"results":[{"alternatives":[{"transcript":"goodbye ","timestamps":[["goodbye",0.2,0.7]],"word_confidence":[["goodbye",0.7]]}]}]}`,
+	} {
+		result := new(IBMResult)
+		assert.NoError(json.Unmarshal([]byte(text), result))
+		results = append(results, result)
+	}
+
+	spool, err := NewResultSpool(os.TempDir() + "/spool_test.results")
+	assert.NoError(err)
+	defer spool.Remove()
+	for _, result := range results {
+		assert.NoError(spool.Append(result))
+	}
+
+	spooled, err := spool.Transcription()
+	assert.NoError(err)
+	expected := GetTranscription(results)
+	assert.Equal(expected.Transcript, spooled.Transcript)
+	assert.Equal(expected.Timestamps, spooled.Timestamps)
+	assert.Equal(expected.Confidences, spooled.Confidences)
+}
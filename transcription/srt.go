@@ -0,0 +1,225 @@
+package transcription
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+const (
+	// maxCueWords is the most words ExportSRT puts in a single cue.
+	maxCueWords = 12
+	// cuePauseSeconds is the pause between two words that starts a new cue.
+	cuePauseSeconds = 1.0
+)
+
+// ExportSRT writes the timestamped words of t to w as SubRip subtitles. Words
+// are grouped into the cues of t.CueStarts if it is set, and otherwise into
+// cues of at most maxCueWords, breaking early at long pauses.
+func ExportSRT(t *Transcription, w io.Writer) error {
+	for i, cue := range groupCues(t.Timestamps, t.CueStarts) {
+		words := make([]string, len(cue))
+		for j, word := range cue {
+			words[j] = word.Word
+		}
+		start := formatSRTTime(cue[0].StartTime)
+		end := formatSRTTime(cue[len(cue)-1].EndTime)
+		if _, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, start, end, strings.Join(words, " ")); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// ExportVTT writes the timestamped words of t to w as WebVTT subtitles, with
+// the same cues as ExportSRT.
+func ExportVTT(t *Transcription, w io.Writer) error {
+	if _, err := io.WriteString(w, "WEBVTT\n\n"); err != nil {
+		return errors.Trace(err)
+	}
+	for _, cue := range groupCues(t.Timestamps, t.CueStarts) {
+		words := make([]string, len(cue))
+		for j, word := range cue {
+			words[j] = word.Word
+		}
+		start := formatVTTTime(cue[0].StartTime)
+		end := formatVTTTime(cue[len(cue)-1].EndTime)
+		if _, err := fmt.Fprintf(w, "%s --> %s\n%s\n\n", start, end, strings.Join(words, " ")); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// groupCues splits timestamps into consecutive groups of words that are
+// displayed together, starting at the indices in starts if they are valid.
+func groupCues(timestamps []timestamp, starts []int) [][]timestamp {
+	if validCueStarts(starts, len(timestamps)) {
+		cues := make([][]timestamp, len(starts))
+		for i, start := range starts {
+			end := len(timestamps)
+			if i+1 < len(starts) {
+				end = starts[i+1]
+			}
+			cues[i] = timestamps[start:end]
+		}
+		return cues
+	}
+
+	cues := [][]timestamp{}
+	var cue []timestamp
+	for i, word := range timestamps {
+		if len(cue) > 0 && (len(cue) == maxCueWords || word.StartTime-timestamps[i-1].EndTime >= cuePauseSeconds) {
+			cues = append(cues, cue)
+			cue = nil
+		}
+		cue = append(cue, word)
+	}
+	if len(cue) > 0 {
+		cues = append(cues, cue)
+	}
+	return cues
+}
+
+// validCueStarts reports whether starts splits count words into non-empty
+// cues.
+func validCueStarts(starts []int, count int) bool {
+	if len(starts) == 0 || starts[0] != 0 {
+		return false
+	}
+	for i := 1; i < len(starts); i++ {
+		if starts[i] <= starts[i-1] {
+			return false
+		}
+	}
+	return starts[len(starts)-1] < count
+}
+
+// ParseSRT reconstructs a Transcription from SubRip subtitles, such as those
+// written by ExportSRT and then corrected by hand. The start and end of every
+// cue are kept exactly; the times of the words within a cue are interpolated.
+// The cues are kept in CueStarts, so that ExportSRT writes them back as they
+// were.
+func ParseSRT(r io.Reader) (*Transcription, error) {
+	timestamps := []timestamp{}
+	words := []string{}
+	cueStarts := []int{}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		return strings.TrimSpace(line), true
+	}
+
+	for {
+		// Skip blank lines and the cue index.
+		line, ok := next()
+		for ok && (len(line) == 0 || !strings.Contains(line, "-->")) {
+			line, ok = next()
+		}
+		if !ok {
+			break
+		}
+
+		times := strings.Split(line, "-->")
+		start, err := parseSRTTime(times[0])
+		if err != nil {
+			return nil, errors.Annotatef(err, "line %d", lineNumber)
+		}
+		end, err := parseSRTTime(times[1])
+		if err != nil {
+			return nil, errors.Annotatef(err, "line %d", lineNumber)
+		}
+
+		cueWords := []string{}
+		for line, ok = next(); ok && len(line) > 0; line, ok = next() {
+			cueWords = append(cueWords, strings.Fields(line)...)
+		}
+		if len(cueWords) > 0 {
+			cueStarts = append(cueStarts, len(timestamps))
+		}
+		timestamps = append(timestamps, interpolateWordTimes(cueWords, start, end)...)
+		words = append(words, cueWords...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	transcription := &Transcription{
+		Transcript:  strings.Join(words, " "),
+		CompletedAt: now(),
+		Timestamps:  timestamps,
+		Confidences: []confidence{},
+		CueStarts:   cueStarts,
+		IBMKeywords: []ibmKeywordResult{},
+	}
+	transcription.Empty = len(words) == 0
+	return transcription, nil
+}
+
+// interpolateWordTimes spreads the span from start to end over words in
+// proportion to the length of each word.
+func interpolateWordTimes(words []string, start, end float64) []timestamp {
+	totalLength := 0
+	for _, word := range words {
+		totalLength += len(word)
+	}
+
+	timestamps := make([]timestamp, len(words))
+	wordStart := start
+	for i, word := range words {
+		wordEnd := wordStart + (end-start)*float64(len(word))/float64(totalLength)
+		if i == len(words)-1 {
+			wordEnd = end
+		}
+		timestamps[i] = timestamp{Word: word, StartTime: wordStart, EndTime: wordEnd}
+		wordStart = wordEnd
+	}
+	return timestamps
+}
+
+// formatSRTTime formats seconds as HH:MM:SS,mmm.
+func formatSRTTime(seconds float64) string {
+	millis := int(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", millis/3600000, millis/60000%60, millis/1000%60, millis%1000)
+}
+
+// formatVTTTime formats seconds as HH:MM:SS.mmm.
+func formatVTTTime(seconds float64) string {
+	return strings.Replace(formatSRTTime(seconds), ",", ".", 1)
+}
+
+// parseSRTTime parses HH:MM:SS,mmm into seconds. A period is also accepted
+// as the decimal separator.
+func parseSRTTime(s string) (float64, error) {
+	s = strings.Replace(strings.TrimSpace(s), ",", ".", 1)
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, errors.Errorf("invalid SRT time %q", s)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, errors.Errorf("invalid SRT time %q", s)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, errors.Errorf("invalid SRT time %q", s)
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid SRT time %q", s)
+	}
+	return float64(hours*3600+minutes*60) + seconds, nil
+}
@@ -0,0 +1,92 @@
+package transcription
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const corrected = `1
+00:00:00,500 --> 00:00:02,000
+hello world
+
+2
+00:00:03,250 --> 00:01:04,000
+this is a test
+`
+
+func TestParseSRT(t *testing.T) {
+	assert := assert.New(t)
+
+	transcription, err := ParseSRT(strings.NewReader(corrected))
+	assert.NoError(err)
+	assert.Equal("hello world this is a test", transcription.Transcript)
+	assert.Len(transcription.Timestamps, 6)
+	assert.Equal(timestamp{"hello", 0.5, 1.25}, transcription.Timestamps[0])
+	assert.Equal(2.0, transcription.Timestamps[1].EndTime)
+	assert.Equal(3.25, transcription.Timestamps[2].StartTime)
+	assert.Equal(64.0, transcription.Timestamps[5].EndTime)
+}
+
+func TestParseSRTRejectsBadTimes(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParseSRT(strings.NewReader("1\n00:00 --> 00:01\nhello\n"))
+	assert.Error(err)
+}
+
+func TestSRTRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	transcription, err := ParseSRT(strings.NewReader(corrected))
+	assert.NoError(err)
+
+	var buffer bytes.Buffer
+	assert.NoError(ExportSRT(transcription, &buffer))
+	assert.Equal(corrected+"\n", buffer.String())
+}
+
+func TestSRTRoundTripKeepsCues(t *testing.T) {
+	assert := assert.New(t)
+	// The first cue is longer than maxCueWords and the second follows it
+	// without a pause, so neither would be grouped like this by default.
+	long := "one two three four five six seven eight nine ten eleven twelve thirteen"
+	subtitles := "1\n00:00:00,000 --> 00:00:05,000\n" + long + "\n\n" +
+		"2\n00:00:05,000 --> 00:00:06,000\nfourteen\n\n"
+
+	transcription, err := ParseSRT(strings.NewReader(subtitles))
+	assert.NoError(err)
+	assert.Equal([]int{0, 13}, transcription.CueStarts)
+
+	var buffer bytes.Buffer
+	assert.NoError(ExportSRT(transcription, &buffer))
+	assert.Equal(subtitles, buffer.String())
+
+	// Without the cues, the words are grouped by maxCueWords.
+	transcription.CueStarts = nil
+	buffer.Reset()
+	assert.NoError(ExportSRT(transcription, &buffer))
+	assert.Contains(buffer.String(), "twelve\n\n2\n")
+}
+
+func TestGroupCuesIgnoresInvalidStarts(t *testing.T) {
+	assert := assert.New(t)
+	timestamps := []timestamp{{"a", 0, 1}, {"b", 1, 2}, {"c", 5, 6}}
+	assert.Len(groupCues(timestamps, []int{0, 1}), 2)
+	assert.Equal([][]timestamp{timestamps[:2], timestamps[2:]}, groupCues(timestamps, []int{1}))
+	assert.Equal([][]timestamp{timestamps[:2], timestamps[2:]}, groupCues(timestamps, []int{0, 3}))
+	assert.Equal([][]timestamp{timestamps[:2], timestamps[2:]}, groupCues(timestamps, []int{0, 2, 2}))
+}
+
+func TestExportVTT(t *testing.T) {
+	assert := assert.New(t)
+
+	transcription, err := ParseSRT(strings.NewReader(corrected))
+	assert.NoError(err)
+
+	var buffer bytes.Buffer
+	assert.NoError(ExportVTT(transcription, &buffer))
+	assert.Equal("WEBVTT\n\n00:00:00.500 --> 00:00:02.000\nhello world\n\n00:00:03.250 --> 00:01:04.000\nthis is a test\n\n", buffer.String())
+}
@@ -0,0 +1,74 @@
+package transcription
+
+import (
+	"github.com/dzhang55/go-torch/config"
+)
+
+// Storage uploads source audio somewhere it can be played back from.
+type Storage interface {
+	// Upload uploads the file at filePath and returns a URL for it.
+	Upload(filePath string) (string, error)
+}
+
+// MetadataStorage is a Storage that can attach metadata, such as the
+// UserMetadata of a job, to the files it uploads.
+type MetadataStorage interface {
+	Storage
+	// UploadWithMetadata is Upload, storing metadata with the file.
+	UploadWithMetadata(filePath string, metadata map[string]string) (string, error)
+}
+
+// BackblazeStorage uploads files to a Backblaze B2 bucket.
+type BackblazeStorage struct {
+	AccountID      string
+	ApplicationKey string
+	Bucket         string
+	// cfg holds the bucket and large file settings of the job, or is nil
+	// for config.Config.
+	cfg *config.AppConfig
+}
+
+// Upload implements Storage.
+func (s BackblazeStorage) Upload(filePath string) (string, error) {
+	return s.UploadWithMetadata(filePath, nil)
+}
+
+// UploadWithMetadata implements MetadataStorage. The metadata is stored as
+// the B2 file info of the file.
+func (s BackblazeStorage) UploadWithMetadata(filePath string, metadata map[string]string) (string, error) {
+	if s.cfg == nil {
+		return UploadFileToBackblazeWithMetadata(filePath, s.AccountID, s.ApplicationKey, s.Bucket, metadata)
+	}
+	return uploadFileToBackblaze(s.cfg, filePath, s.AccountID, s.ApplicationKey, s.Bucket, metadata)
+}
+
+// AzureStorage uploads files to an Azure Blob Storage container.
+type AzureStorage struct {
+	Container        string
+	ConnectionString string
+}
+
+// Upload implements Storage.
+func (s AzureStorage) Upload(filePath string) (string, error) {
+	return UploadFileToAzure(filePath, s.Container, s.ConnectionString)
+}
+
+// configuredStorage returns the Storage selected by cfg, or nil if no storage
+// backend is configured.
+func configuredStorage(cfg *config.AppConfig) Storage {
+	switch {
+	case len(cfg.AzureConnectionString) > 0:
+		return AzureStorage{
+			Container:        cfg.AzureContainer,
+			ConnectionString: cfg.AzureConnectionString,
+		}
+	case len(cfg.BackblazeAccountID) > 0:
+		return BackblazeStorage{
+			AccountID:      cfg.BackblazeAccountID,
+			ApplicationKey: cfg.BackblazeApplicationKey,
+			Bucket:         cfg.BackblazeBucket,
+			cfg:            cfg,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package transcription
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/juju/errors"
+)
+
+// StreamWithIBM transcribes audio from r as it arrives, such as a live feed,
+// and passes each result to onResult as soon as IBM returns it instead of
+// waiting for the end of the audio. It returns once r is exhausted and IBM has
+// finished with the audio, or when ctx is done.
+func StreamWithIBM(ctx context.Context, id string, r io.Reader, contentType string, searchWords []string, IBMUsername string, IBMPassword string, onResult func(*IBMResult)) error {
+	release, err := acquireIBM(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cfg := withIBMCredentials(IBMUsername, IBMPassword)
+	ws, logger, transactionID, err := startIBMRecognition(ctx, cfg, id, contentType, searchWords, ibmModel(cfg))
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	logger.Debug("Starting streaming transcription using IBM")
+
+	// Audio is sent while results are read. All writes happen in this
+	// goroutine, since the websocket allows only one writer at a time.
+	uploaded := make(chan error, 1)
+	go func() {
+		err := uploadWithWebsocket(ws, r)
+		if err == nil {
+			err = ws.WriteMessage(websocket.BinaryMessage, []byte{})
+		}
+		uploaded <- err
+		if err != nil {
+			// Interrupt the read below.
+			ws.Close()
+			return
+		}
+		ticker := time.NewTicker(5 * time.Second)
+		keepConnectionOpen(ws, ticker, ctx.Done())
+	}()
+
+	listening := 0
+	for {
+		message := new(ibmMessage)
+		_, data, err := ws.ReadMessage()
+		if err == nil {
+			err = json.Unmarshal(data, message)
+		}
+		if err != nil {
+			select {
+			case uploadErr := <-uploaded:
+				if uploadErr != nil {
+					err = uploadErr
+				}
+			default:
+			}
+			return annotateIBMError(contextError(ctx, err), transactionID)
+		}
+		if len(message.Error) > 0 {
+			return annotateIBMError(errors.New(message.Error), transactionID)
+		}
+		if len(message.Results) > 0 {
+			result := message.IBMResult
+			onResult(&result)
+		}
+		// IBM is listening once when it is ready for audio and again once it
+		// has finished with all of it.
+		if message.State == "listening" {
+			listening++
+			if listening > 1 {
+				logger.Debug("IBM has finished the stream")
+				return nil
+			}
+		}
+	}
+}
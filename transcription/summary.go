@@ -0,0 +1,37 @@
+package transcription
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+)
+
+// Summarizer writes a short summary of a transcript, such as with a language
+// model.
+type Summarizer interface {
+	Summarize(transcript string) (string, error)
+}
+
+// NoopSummarizer is the default Summarizer, which summarizes nothing.
+type NoopSummarizer struct{}
+
+// Summarize implements Summarizer.
+func (NoopSummarizer) Summarize(transcript string) (string, error) {
+	return "", nil
+}
+
+// summarize sets the Summary of t with summarizer. A summary is a nicety, so
+// failures are logged rather than failing the job.
+func summarize(id string, summarizer Summarizer, t *Transcription) {
+	if summarizer == nil || t.Empty {
+		return
+	}
+	summary, err := summarizer.Summarize(t.Transcript)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"task":  id,
+			"error": errors.ErrorStack(err),
+		}).Warn("Could not summarize the transcript")
+		return
+	}
+	t.Summary = summary
+}
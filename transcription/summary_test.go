@@ -0,0 +1,48 @@
+package transcription
+
+import (
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type firstWordSummarizer struct {
+	err error
+}
+
+func (s firstWordSummarizer) Summarize(transcript string) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	return "About " + transcript[:5], nil
+}
+
+func TestSummarize(t *testing.T) {
+	assert := assert.New(t)
+
+	transcription := &Transcription{Transcript: "hello world"}
+	summarize("abc", firstWordSummarizer{}, transcription)
+	assert.Equal("About hello", transcription.Summary)
+
+	transcription = &Transcription{Transcript: "hello world"}
+	summarize("abc", firstWordSummarizer{err: errors.New("quota exceeded")}, transcription)
+	assert.Equal("", transcription.Summary)
+
+	transcription = &Transcription{Transcript: "hello world"}
+	summarize("abc", NoopSummarizer{}, transcription)
+	assert.Equal("", transcription.Summary)
+
+	transcription = &Transcription{Empty: true}
+	summarize("abc", firstWordSummarizer{}, transcription)
+	assert.Equal("", transcription.Summary)
+}
+
+func TestRenderEmailWithSummary(t *testing.T) {
+	assert := assert.New(t)
+	data := EmailData{ID: "abc", Transcription: &Transcription{Transcript: "hello world", Summary: "A greeting."}}
+
+	_, body, err := renderEmail("", "", defaultSuccessSubject, defaultSuccessBody, data)
+	assert.NoError(err)
+	assert.Equal("Summary: A greeting.\n\nThe transcript is below. It can also be found in the database.\n\nhello world", body)
+}
@@ -0,0 +1,71 @@
+package transcription
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+const (
+	// defaultTempFileMode keeps intermediate audio and transcripts readable
+	// only by the user running the server.
+	defaultTempFileMode os.FileMode = 0600
+	// jobDirMode is the mode of the directory holding a job's files.
+	jobDirMode os.FileMode = 0700
+)
+
+// tempFileMode returns config.Config.TempFileMode, an octal mode such as
+// "0640", or defaultTempFileMode if it is unset or invalid.
+func tempFileMode() os.FileMode {
+	cfg := config.GetConfig()
+	if len(cfg.TempFileMode) == 0 {
+		return defaultTempFileMode
+	}
+	mode, err := strconv.ParseUint(cfg.TempFileMode, 8, 32)
+	if err != nil || mode > 0777 {
+		log.Warnf("Ignoring invalid TempFileMode %q", cfg.TempFileMode)
+		return defaultTempFileMode
+	}
+	return os.FileMode(mode)
+}
+
+// createTempFile creates (or truncates) the file at path with tempFileMode.
+func createTempFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, tempFileMode())
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// The mode passed to OpenFile is reduced by the umask and does not apply
+	// to a file that already existed.
+	if err := file.Chmod(tempFileMode()); err != nil {
+		file.Close()
+		return nil, errors.Trace(err)
+	}
+	return file, nil
+}
+
+// restrictTempFile sets the mode of a file created by another program, such as
+// ffmpeg, to tempFileMode.
+func restrictTempFile(path string) error {
+	return errors.Trace(os.Chmod(path, tempFileMode()))
+}
+
+// makeJobDir creates a directory only the server's user can open, under
+// config.Config.TempDir (the system temporary directory if unset), to hold
+// the files of the job id.
+func makeJobDir(id string) (string, error) {
+	root := config.GetConfig().TempDir
+	if len(root) == 0 {
+		root = os.TempDir()
+	}
+	dir := filepath.Join(root, "transcribe-"+id)
+	if err := os.MkdirAll(dir, jobDirMode); err != nil {
+		return "", errors.Trace(err)
+	}
+	return dir, errors.Trace(os.Chmod(dir, jobDirMode))
+}
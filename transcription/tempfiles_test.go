@@ -0,0 +1,50 @@
+package transcription
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestTempFileMode(t *testing.T) {
+	assert := assert.New(t)
+	defer func(mode string) { config.Config.TempFileMode = mode }(config.Config.TempFileMode)
+
+	config.Config.TempFileMode = ""
+	assert.Equal(os.FileMode(0600), tempFileMode())
+	config.Config.TempFileMode = "0640"
+	assert.Equal(os.FileMode(0640), tempFileMode())
+	config.Config.TempFileMode = "rw-r--r--"
+	assert.Equal(os.FileMode(0600), tempFileMode())
+}
+
+func TestCreateTempFileAndJobDir(t *testing.T) {
+	assert := assert.New(t)
+	root, err := ioutil.TempDir("", "tempfiles")
+	assert.NoError(err)
+	defer os.RemoveAll(root)
+	defer func(dir string) { config.Config.TempDir = dir }(config.Config.TempDir)
+	config.Config.TempDir = root
+
+	dir, err := makeJobDir("abc")
+	assert.NoError(err)
+	assert.Equal(filepath.Join(root, "transcribe-abc"), dir)
+	info, err := os.Stat(dir)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0700), info.Mode().Perm())
+
+	path := filepath.Join(dir, "audio.wav")
+	assert.NoError(ioutil.WriteFile(path, []byte("old"), 0666))
+	file, err := createTempFile(path)
+	assert.NoError(err)
+	file.Close()
+	info, err = os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	assert.Equal(int64(0), info.Size())
+}
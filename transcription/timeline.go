@@ -0,0 +1,116 @@
+package transcription
+
+import (
+	"math"
+	"strings"
+)
+
+// The timestamps of a Transcription are seconds from the start of the
+// downloaded audio. IBM times each word from the start of its chunk, so the
+// chunk's start is added to them, and the words IBM heard twice where chunks
+// overlap are only kept once.
+//
+// Known sources of drift, all well under a second:
+//   - IBM reports times to the hundredth of a second.
+//   - ffmpeg drops a nonzero start time of the source container, such as the
+//     priming samples of some AAC and MP3 encoders, when it converts to wav.
+//     Players usually skip these too.
+//   - Resampling and splitting the wav are sample accurate, so they add no
+//     drift of their own.
+
+// chunkSpan is the part of the converted audio that a chunk covers, in
+// seconds.
+type chunkSpan struct {
+	Start float64
+	End   float64
+}
+
+// chunkWindows returns, for each chunk, the part of the audio whose words are
+// taken from it. Where two chunks overlap, the overlap is split down the
+// middle, so that no word is lost or repeated and each word comes from the
+// chunk in which it is furthest from an edge, where IBM is least accurate.
+func chunkWindows(spans []chunkSpan) []chunkSpan {
+	windows := make([]chunkSpan, len(spans))
+	for i := range spans {
+		windows[i] = chunkSpan{Start: math.Inf(-1), End: math.Inf(1)}
+	}
+	for i := 1; i < len(spans); i++ {
+		cut := spans[i].Start
+		if spans[i-1].End > cut {
+			cut = (cut + spans[i-1].End) / 2
+		}
+		windows[i-1].End = cut
+		windows[i].Start = cut
+	}
+	return windows
+}
+
+// alignChunkResult moves the times in the result of a chunk starting at
+// offset onto the timeline of the whole audio, and drops the words outside
+// window. Alternatives that lose words have their transcript rebuilt from the
+// remaining ones. Results without word timings cannot be placed and are kept
+// as they are.
+func alignChunkResult(result *IBMResult, offset float64, window chunkSpan) *IBMResult {
+	inWindow := func(start float64) bool {
+		return start >= window.Start && start < window.End
+	}
+
+	aligned := &IBMResult{ResultIndex: result.ResultIndex}
+	for _, field := range result.Results {
+		alignedField := ibmResultField{Final: field.Final}
+		for _, alternative := range field.Alternatives {
+			alignedField.Alternatives = append(alignedField.Alternatives, alignAlternative(alternative, offset, inWindow))
+		}
+		for word, keywords := range field.KeywordMap {
+			for _, keyword := range keywords {
+				keyword.StartTime += offset
+				keyword.EndTime += offset
+				if !inWindow(keyword.StartTime) {
+					continue
+				}
+				if alignedField.KeywordMap == nil {
+					alignedField.KeywordMap = make(map[string][]ibmKeywordResult)
+				}
+				alignedField.KeywordMap[word] = append(alignedField.KeywordMap[word], keyword)
+			}
+		}
+		aligned.Results = append(aligned.Results, alignedField)
+	}
+	return aligned
+}
+
+func alignAlternative(alternative ibmAlternativesField, offset float64, inWindow func(float64) bool) ibmAlternativesField {
+	if len(alternative.Timestamps) == 0 {
+		return alternative
+	}
+	// Confidences can only be matched to their words when IBM sent one for
+	// every word.
+	matchConfidences := len(alternative.WordConfidence) == len(alternative.Timestamps)
+
+	aligned := alternative
+	aligned.Timestamps = nil
+	if matchConfidences {
+		aligned.WordConfidence = nil
+	}
+	words := []string{}
+	for i, ts := range alternative.Timestamps {
+		word, _ := ts[0].(string)
+		start, _ := ts[1].(float64)
+		end, _ := ts[2].(float64)
+		if !inWindow(start + offset) {
+			continue
+		}
+		aligned.Timestamps = append(aligned.Timestamps, ibmWordTimestamp{word, start + offset, end + offset})
+		if matchConfidences {
+			aligned.WordConfidence = append(aligned.WordConfidence, alternative.WordConfidence[i])
+		}
+		words = append(words, word)
+	}
+	if len(words) < len(alternative.Timestamps) {
+		aligned.Transcript = ""
+		if len(words) > 0 {
+			aligned.Transcript = strings.Join(words, " ") + " "
+		}
+	}
+	return aligned
+}
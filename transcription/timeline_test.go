@@ -0,0 +1,87 @@
+package transcription
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+func TestChunkWindows(t *testing.T) {
+	assert := assert.New(t)
+	windows := chunkWindows([]chunkSpan{{0, 100}, {95, 195}, {195, 295}})
+	assert.Equal([]chunkSpan{
+		{math.Inf(-1), 97.5},
+		{97.5, 195},
+		{195, math.Inf(1)},
+	}, windows)
+
+	assert.Equal([]chunkSpan{{math.Inf(-1), math.Inf(1)}}, chunkWindows([]chunkSpan{{0, math.Inf(1)}}))
+}
+
+func TestAlignChunkResults(t *testing.T) {
+	assert := assert.New(t)
+	first := ibmResultFromTranscription(&Transcription{
+		Transcript:  "one two three ",
+		Timestamps:  []timestamp{{"one", 90, 91}, {"two", 96, 97}, {"three", 98, 99}},
+		Confidences: []confidence{{"one", 0.9}, {"two", 0.8}, {"three", 0.7}},
+		IBMKeywords: []ibmKeywordResult{{"three", 98, 99, 0.7}},
+	})
+	// The second chunk starts 5 seconds before the first ends, so it hears
+	// "two" and "three" again.
+	second := ibmResultFromTranscription(&Transcription{
+		Transcript:  "two three four ",
+		Timestamps:  []timestamp{{"two", 1, 2}, {"three", 3, 4}, {"four", 6, 7}},
+		Confidences: []confidence{{"two", 0.6}, {"three", 0.9}, {"four", 0.8}},
+		IBMKeywords: []ibmKeywordResult{{"three", 3, 4, 0.9}},
+	})
+
+	windows := chunkWindows([]chunkSpan{{0, 100}, {95, 195}})
+	transcription := GetTranscription([]*IBMResult{
+		alignChunkResult(first, 0, windows[0]),
+		alignChunkResult(second, 95, windows[1]),
+	})
+
+	assert.Equal("one two three four ", transcription.Transcript)
+	assert.Equal([]timestamp{{"one", 90, 91}, {"two", 96, 97}, {"three", 98, 99}, {"four", 101, 102}}, transcription.Timestamps)
+	assert.Equal([]confidence{{"one", 0.9}, {"two", 0.8}, {"three", 0.9}, {"four", 0.8}}, transcription.Confidences)
+	assert.Equal([]ibmKeywordResult{{"three", 98, 99, 0.9}}, transcription.IBMKeywords)
+	assert.NoError(transcription.Validate())
+}
+
+func TestAlignChunkResultWithoutTimings(t *testing.T) {
+	result := ibmResultFromTranscription(&Transcription{Transcript: "hello "})
+	aligned := alignChunkResult(result, 95, chunkSpan{97.5, math.Inf(1)})
+	assert.Equal(t, "hello ", GetTranscription([]*IBMResult{aligned}).Transcript)
+}
+
+func TestGetTranscriptionSeparatesChunks(t *testing.T) {
+	assert := assert.New(t)
+	first := ibmResultFromTranscription(&Transcription{
+		Transcript: "one two",
+		Timestamps: []timestamp{{"one", 0, 1}, {"two", 1, 2}},
+	})
+	// A short gap at the seam is only a space.
+	second := ibmResultFromTranscription(&Transcription{
+		Transcript: "three ",
+		Timestamps: []timestamp{{"three", 2.5, 3}},
+	})
+	// A long pause starts a new line.
+	third := ibmResultFromTranscription(&Transcription{
+		Transcript: "four ",
+		Timestamps: []timestamp{{"four", 10, 11}},
+	})
+	transcription := GetTranscription([]*IBMResult{first, second, third})
+	assert.Equal("one two three\nfour ", transcription.Transcript)
+
+	defer func(pause float64, separator string) {
+		config.Config.ChunkPauseSeconds = pause
+		config.Config.ChunkPauseSeparator = separator
+	}(config.Config.ChunkPauseSeconds, config.Config.ChunkPauseSeparator)
+	config.Config.ChunkPauseSeconds = 0.5
+	config.Config.ChunkPauseSeparator = "\n\n"
+	transcription = GetTranscription([]*IBMResult{first, second, third})
+	assert.Equal("one two\n\nthree\n\nfour ", transcription.Transcript)
+}
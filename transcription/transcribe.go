@@ -0,0 +1,59 @@
+package transcription
+
+import (
+	"github.com/juju/errors"
+)
+
+// Options are the settings of Transcribe. The side effects of a job are off
+// unless enabled, and each also needs to be configured, e.g. Store needs a
+// MongoURL.
+type Options struct {
+	// Source is the URL or local path of the audio or video.
+	Source string
+	// ID identifies the job in logs and notifications. The default is a new
+	// GenerateJobID.
+	ID             string
+	SearchWords    []string
+	EmailAddresses []string
+	// OutputDir is where the transcript is written as <name>_<id>.txt, along
+	// with the subtitle formats enabled by SRT and VTT. Nothing is written if it
+	// is empty.
+	OutputDir string
+	SRT       bool
+	VTT       bool
+	// Upload uploads the source audio to the configured storage.
+	Upload bool
+	// Store writes the transcription to mongo.
+	Store bool
+	// Notify sends the completion email and other notifications.
+	Notify bool
+
+	TaskOptions
+}
+
+// Transcribe runs the whole pipeline on opts.Source and returns everything it
+// produced, for scripts and command line tools that do not want to assemble a
+// task function. Unlike a task, a transcript file that cannot be written is
+// an error.
+func Transcribe(opts Options) (*JobResult, error) {
+	if len(opts.Source) == 0 {
+		return nil, errors.NotValidf("empty source")
+	}
+	if len(opts.ID) == 0 {
+		opts.ID = GenerateJobID()
+	}
+	steps := jobSteps{Upload: opts.Upload, Store: opts.Store, Notify: opts.Notify, AllowLocal: true}
+	result, err := runJob(opts.ID, opts.Source, opts.EmailAddresses, opts.SearchWords, opts.TaskOptions, steps)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if len(opts.OutputDir) > 0 {
+		name := outputName(opts.Source, opts.ID)
+		result.Files, err = writeOutputFiles(result.Transcription, opts.OutputDir, name, opts.SRT, opts.VTT)
+		if err != nil {
+			return result, errors.Trace(err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package transcription
+
+// Transcriber is a speech to text engine that transcribes a single chunk of
+// audio, as produced by SplitWavFile.
+type Transcriber interface {
+	// Transcribe transcribes the audio file at filePath. The task id is
+	// passed along for logging.
+	Transcribe(id string, filePath string, searchWords []string) (*Transcription, error)
+}
+
+// IBMTranscriber transcribes audio with IBM Watson Speech To Text.
+type IBMTranscriber struct {
+	Username string
+	Password string
+}
+
+// MaxChunkBytes implements ChunkLimiter.
+func (t IBMTranscriber) MaxChunkBytes() int64 {
+	return defaultMaxChunkBytes
+}
+
+// Transcribe implements Transcriber.
+func (t IBMTranscriber) Transcribe(id string, filePath string, searchWords []string) (*Transcription, error) {
+	result, err := TranscribeWithIBMID(id, filePath, searchWords, t.Username, t.Password)
+	if err != nil {
+		return nil, err
+	}
+	return GetTranscription([]*IBMResult{result}), nil
+}
+
+// ibmResultFromTranscription converts the transcription of a chunk by another
+// engine into an IBMResult, so that it is assembled like IBM's results.
+func ibmResultFromTranscription(t *Transcription) *IBMResult {
+	alternative := ibmAlternativesField{Transcript: t.Transcript}
+	for _, word := range t.Timestamps {
+		alternative.Timestamps = append(alternative.Timestamps, ibmWordTimestamp{word.Word, word.StartTime, word.EndTime})
+	}
+	for _, word := range t.Confidences {
+		alternative.WordConfidence = append(alternative.WordConfidence, ibmWordConfidence{word.Word, word.Score})
+	}
+	field := ibmResultField{Alternatives: []ibmAlternativesField{alternative}, Final: true}
+	if len(t.IBMKeywords) > 0 {
+		field.KeywordMap = make(map[string][]ibmKeywordResult)
+		for _, keyword := range t.IBMKeywords {
+			field.KeywordMap[keyword.Word] = append(field.KeywordMap[keyword.Word], keyword)
+		}
+	}
+	return &IBMResult{Results: []ibmResultField{field}}
+}
@@ -5,20 +5,21 @@
 package transcription
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/smtp"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"gopkg.in/kothar/go-backblaze.v0"
-	"gopkg.in/mgo.v2"
-
 	log "github.com/Sirupsen/logrus"
 	"github.com/jordan-wright/email"
 	"github.com/juju/errors"
@@ -26,15 +27,42 @@ import (
 	"github.com/dzhang55/go-torch/config"
 )
 
+// defaultChunkOverlapSeconds is the redundancy between consecutive chunks when
+// config.Config.ChunkOverlapSeconds is not set.
+const defaultChunkOverlapSeconds = 5
+
+// defaultMinAudioSeconds is the shortest audio that is sent to IBM by default.
+const defaultMinAudioSeconds = 2.0
+
+const (
+	defaultChunkRetries = 2
+	// chunkRetryDelay is how long transcribeChunk waits before its first retry.
+	chunkRetryDelay = 2 * time.Second
+)
+
+// now returns the current time. It is a variable so that tests can freeze
+// time when asserting on generated file names and completion times.
+var now = time.Now
+
 // SendEmail connects to an email server at host:port and sends an email from
 // address from, to address to, with subject line subject with message body.
 func SendEmail(username string, password string, host string, port int, to []string, subject string, body string) error {
+	return SendEmailFull(username, password, host, port, to, nil, nil, subject, body)
+}
+
+// SendEmailFull is like SendEmail, but also sends the email to the cc and bcc
+// addresses. The bcc addresses are left out of the email's headers. Each
+// address is only sent one copy, even if it is listed more than once.
+func SendEmailFull(username string, password string, host string, port int, to []string, cc []string, bcc []string, subject string, body string) error {
+	to, cc, bcc = dedupeRecipients(to, cc, bcc)
 	auth := smtp.PlainAuth("", username, password, host)
 	addr := host + ":" + strconv.Itoa(port)
 
 	message := email.Email{
 		From:    username,
 		To:      to,
+		Cc:      cc,
+		Bcc:     bcc,
 		Subject: subject,
 		Text:    []byte(body),
 	}
@@ -44,58 +72,330 @@ func SendEmail(username string, password string, host string, port int, to []str
 	return nil
 }
 
-// ConvertAudioIntoFormat converts encoded audio into the required format.
+// ErrOutputExists is returned when the file a conversion would write already
+// exists and config.Config.OverwriteConvertedAudio is not set.
+var ErrOutputExists = errors.New("output file already exists")
+
+// ConvertAudioIntoFormat converts encoded audio into the required format,
+// applying the configured audio filters such as loudness normalization. The
+// result is written to filePath with fileExt appended. If that file exists,
+// it is replaced when config.Config.OverwriteConvertedAudio is set, and
+// ErrOutputExists is returned otherwise.
 func ConvertAudioIntoFormat(filePath, fileExt string) (string, error) {
+	cfg := config.GetConfig()
+	return convertAudio(&cfg, filePath, fileExt, cfg.OverwriteConvertedAudio, wideSampleRate, audioFilters(&cfg))
+}
+
+// convertAudio converts encoded audio into the required format at
+// sampleRate, passing it through the given ffmpeg audio filters. Any
+// outputArgs are passed to ffmpeg before the filters. An existing output
+// file is replaced if overwrite is set, and is an ErrOutputExists otherwise.
+func convertAudio(cfg *config.AppConfig, filePath, fileExt string, overwrite bool, sampleRate int, filters []string, outputArgs ...string) (string, error) {
 	// http://cmusphinx.sourceforge.net/wiki/faq
-	// -ar 16000 sets frequency to required 16khz
+	// -ar sets the frequency, usually to the required 16khz
 	// -ac 1 sets the number of audio channels to 1
 	newPath := filePath + "." + fileExt
-	os.Remove(newPath) // If it already exists, ffmpeg will throw an error
-	cmd := exec.Command("ffmpeg", "-i", filePath, "-ar", "16000", "-ac", "1", newPath)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return "", errors.New(err.Error() + "\nCommand Output:" + string(out))
+	args := ffmpegInputArgs(cfg, filePath)
+	if overwrite {
+		os.Remove(newPath) // If it already exists, ffmpeg will throw an error
+	} else {
+		if _, err := os.Stat(newPath); err == nil {
+			return "", errors.Annotate(ErrOutputExists, newPath)
+		}
+		// -n makes ffmpeg fail rather than replace a file created since.
+		args = append([]string{"-n"}, args...)
+	}
+	args = append(args, outputArgs...)
+	args = append(args, filterArgs(filters)...)
+	args = append(args, "-ar", strconv.Itoa(sampleRate), "-ac", "1", newPath)
+	if err := runFFmpeg(args...); err != nil {
+		return "", errors.Trace(err)
+	}
+	return newPath, restrictTempFile(newPath)
+}
+
+// defaultDenoiseFilter cuts low frequency hum and then reduces broadband
+// noise such as air conditioning.
+const defaultDenoiseFilter = "highpass=f=80,afftdn=nf=-25"
+
+// audioFilters returns the ffmpeg audio filters enabled by cfg.
+func audioFilters(cfg *config.AppConfig) []string {
+	filters := []string{}
+	if cfg.Denoise {
+		filter := cfg.DenoiseFilter
+		if len(filter) == 0 {
+			filter = defaultDenoiseFilter
+		}
+		filters = append(filters, filter)
+	}
+	if cfg.NormalizeAudio {
+		// EBU R128 loudness normalization, which brings up quiet recordings.
+		filters = append(filters, "loudnorm")
 	}
-	return newPath, nil
+	return filters
+}
+
+// filterArgs returns the ffmpeg arguments that apply filters in order.
+func filterArgs(filters []string) []string {
+	if len(filters) == 0 {
+		return nil
+	}
+	return []string{"-af", strings.Join(filters, ",")}
+}
+
+// ffmpegInputArgs returns the ffmpeg arguments that read filePath, preceded by
+// cfg.FFmpegInputOptions (e.g. -analyzeduration 100M) which ffmpeg only
+// applies to the input that follows them.
+func ffmpegInputArgs(cfg *config.AppConfig, filePath string) []string {
+	args := make([]string, 0, len(cfg.FFmpegInputOptions)+2)
+	args = append(args, cfg.FFmpegInputOptions...)
+	return append(args, "-i", filePath)
 }
 
-// DownloadFileFromURL locally downloads an audio file stored at url.
+// ExtractAudioFromVideo writes the first audio track of a video file to a
+// mono 16khz file in the required format, applying the configured audio
+// filters. An existing output file is handled like ConvertAudioIntoFormat.
+func ExtractAudioFromVideo(filePath, fileExt string) (string, error) {
+	// -vn drops the video streams and -map a:0 keeps only the first audio track
+	cfg := config.GetConfig()
+	return convertAudio(&cfg, filePath, fileExt, cfg.OverwriteConvertedAudio, wideSampleRate, audioFilters(&cfg), "-vn", "-map", "a:0")
+}
+
+// ErrFileTooLarge is returned when a download is larger than
+// config.Config.MaxDownloadBytes.
+var ErrFileTooLarge = errors.New("file is too large")
+
+// ErrIncompleteDownload is returned when a download ends before the
+// Content-Length the server sent.
+var ErrIncompleteDownload = errors.New("download is incomplete")
+
+// DownloadFileFromURL locally downloads an audio file stored at url. If
+// config.Config.MaxDownloadBytes is set, files that are larger are rejected,
+// ideally before downloading them. ftp:// and sftp:// URLs are supported too,
+// using the credentials in the URL or else config.Config.FTPUsername and
+// FTPPassword; SFTP downloads require curl.
 func DownloadFileFromURL(url string) (string, error) {
-	// Taken from https://github.com/thbar/golang-playground/blob/master/download-files.go
-	filePath := filePathFromURL(url)
-	file, err := os.Create(filePath)
+	return downloadFileToDir(url, "")
+}
+
+// downloadFileToDir is DownloadFileFromURL, but saves the file in dir.
+func downloadFileToDir(url string, dir string) (string, error) {
+	if strings.HasPrefix(url, "data:") {
+		filePath, err := decodeDataURI(url, dir)
+		return filePath, errors.Trace(err)
+	}
+	if strings.HasPrefix(url, "ftp://") {
+		filePath, err := downloadFTPToDir(url, dir)
+		return filePath, errors.Trace(err)
+	}
+	if strings.HasPrefix(url, "sftp://") {
+		filePath, err := downloadSFTPToDir(url, dir)
+		return filePath, errors.Trace(err)
+	}
+
+	client, err := downloadClient(0)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	maxBytes := config.GetConfig().MaxDownloadBytes
+	if maxBytes > 0 {
+		if err := checkContentLength(client, url, maxBytes); err != nil {
+			return "", errors.Trace(err)
+		}
+	}
+
+	filePath := filepath.Join(dir, filePathFromURL(url))
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return "", errors.Trace(err)
 	}
+	if _, err := downloadRequest(client, req, filePath, maxBytes); err != nil {
+		return "", errors.Trace(err)
+	}
+	return filePath, nil
+}
+
+// downloadRequest saves the body of the response to req as filePath and
+// returns the response status. A body larger than maxBytes, if it is
+// positive, is rejected. Nothing is left at filePath on error.
+func downloadRequest(client *http.Client, req *http.Request, filePath string, maxBytes int64) (int, error) {
+	url := req.URL.String()
+	// Taken from https://github.com/thbar/golang-playground/blob/master/download-files.go
+	file, err := createTempFile(filePath)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
 	defer file.Close()
 
 	// Get file contents
-	response, err := http.Get(url)
+	response, err := client.Do(req)
 	if err != nil {
-		return "", errors.Trace(err)
+		os.Remove(filePath)
+		return 0, errors.Trace(err)
 	}
 	defer response.Body.Close()
 
-	// Write the body to file
-	_, err = io.Copy(file, response.Body)
+	// Write the body to file. When the server does not send a Content-Length,
+	// the limit is enforced while streaming instead.
+	var body io.Reader = response.Body
+	if maxBytes > 0 {
+		body = io.LimitReader(response.Body, maxBytes+1)
+	}
+	written, err := io.Copy(file, body)
 	if err != nil {
-		return "", errors.Trace(err)
+		os.Remove(filePath)
+		return 0, errors.Trace(err)
+	}
+	if maxBytes > 0 && written > maxBytes {
+		os.Remove(filePath)
+		return 0, errors.Annotatef(ErrFileTooLarge, "%s is larger than %d bytes", url, maxBytes)
+	}
+	// A server that closes the connection early without an error still
+	// leaves the file short of the length it announced.
+	if response.ContentLength >= 0 && written != response.ContentLength {
+		os.Remove(filePath)
+		return 0, errors.Annotatef(ErrIncompleteDownload, "got %d of %d bytes of %s", written, response.ContentLength, url)
+	}
+	return response.StatusCode, nil
+}
+
+// checkContentLength sends a HEAD request to url and returns ErrFileTooLarge
+// if the reported Content-Length exceeds maxBytes. Servers that do not report
+// a length, or do not support HEAD, pass the check.
+func checkContentLength(client *http.Client, url string, maxBytes int64) error {
+	response, err := client.Head(url)
+	if err != nil {
+		log.Debugf("Could not HEAD %s: %v", url, err)
+		return nil
+	}
+	response.Body.Close()
+
+	if response.StatusCode == http.StatusOK && response.ContentLength > maxBytes {
+		return errors.Annotatef(ErrFileTooLarge, "%s is %d bytes, more than %d", url, response.ContentLength, maxBytes)
+	}
+	return nil
+}
+
+// decodeDataURI writes the audio inlined in a base64 data URI such as
+// data:audio/mpeg;base64,... to a local file in dir.
+func decodeDataURI(uri string, dir string) (string, error) {
+	comma := strings.Index(uri, ",")
+	if comma < 0 {
+		return "", errors.NotValidf("data URI")
+	}
+	header, data := uri[len("data:"):comma], uri[comma+1:]
+	if !strings.HasSuffix(header, ";base64") {
+		return "", errors.NotValidf("data URI without base64 encoding")
+	}
+	mimeType := strings.Split(header, ";")[0]
+	if !strings.HasPrefix(mimeType, "audio/") && !strings.HasPrefix(mimeType, "video/") {
+		return "", errors.NotValidf("data URI with MIME type %q", mimeType)
 	}
 
+	maxBytes := config.GetConfig().MaxDownloadBytes
+	if maxBytes > 0 && int64(base64.StdEncoding.DecodedLen(len(data))) > maxBytes+2 {
+		return "", errors.Annotatef(ErrFileTooLarge, "data URI is larger than %d bytes", maxBytes)
+	}
+	audio, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", errors.Annotate(err, "could not decode data URI")
+	}
+	if maxBytes > 0 && int64(len(audio)) > maxBytes {
+		return "", errors.Annotatef(ErrFileTooLarge, "data URI is larger than %d bytes", maxBytes)
+	}
+
+	filePath := filepath.Join(dir, "inline"+strconv.Itoa(int(now().UnixNano())))
+	file, err := createTempFile(filePath)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer file.Close()
+	if _, err := file.Write(audio); err != nil {
+		os.Remove(filePath)
+		return "", errors.Trace(err)
+	}
 	return filePath, nil
 }
 
+// filePathFromURL returns a unique local file name for the file at url, such
+// as audio_<timestamp>.mp3 for http://example.com/audio.MP3?token=abc. The
+// extension is kept last and lowercased so that ffmpeg can infer the format.
 func filePathFromURL(url string) string {
+	base, ext := fileNameFromURL(url)
+
+	// ensure the filePath is unique by inserting a timestamp before the extension
+	return base + "_" + strconv.Itoa(int(now().UnixNano())) + strings.ToLower(ext)
+}
+
+// fileNameFromURL returns the name of the file at url without its query or
+// fragment, split into the base name (audio if there is none) and extension.
+// Data URIs are named inline.
+func fileNameFromURL(url string) (string, string) {
+	if strings.HasPrefix(url, "data:") {
+		return "inline", ""
+	}
 	tokens := strings.Split(url, "/")
-	filePath := tokens[len(tokens)-1]
-	filePath = strings.Split(filePath, "?")[0]
+	name := tokens[len(tokens)-1]
+	name = strings.Split(name, "?")[0]
+	name = strings.Split(name, "#")[0]
 
-	// ensure the filePath is unique by appending timestamp
-	filePath = filePath + strconv.Itoa(int(time.Now().UnixNano()))
-	return filePath
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if len(base) == 0 {
+		base = "audio"
+	}
+	return base, ext
 }
 
 // SplitWavFile ensures that the input audio files to IBM are less than 100mb, with 5 seconds of redundancy between files.
+// The size can be changed with config.Config.MaxChunkBytes.
 func SplitWavFile(wavFilePath string) ([]string, error) {
+	cfg := config.GetConfig()
+	names, _, err := splitWavFile(&cfg, wavFilePath, maxChunkBytes(&cfg, IBMTranscriber{}), wideSampleRate)
+	return names, err
+}
+
+const (
+	// defaultMaxChunkBytes keeps chunks under IBM's 100MB limit.
+	defaultMaxChunkBytes = 95000000
+	// wavBytesPerSample is the size of a sample of the 16 bit, mono wav files
+	// made by ConvertAudioIntoFormat.
+	wavBytesPerSample = 2
+)
+
+// ChunkLimiter is implemented by Transcribers that only accept chunks up to a
+// certain size.
+type ChunkLimiter interface {
+	MaxChunkBytes() int64
+}
+
+// maxChunkBytes returns the size of the chunks to split audio into for t:
+// cfg.MaxChunkBytes if set, otherwise the limit t advertises, or
+// defaultMaxChunkBytes.
+func maxChunkBytes(cfg *config.AppConfig, t Transcriber) int64 {
+	if cfg.MaxChunkBytes > 0 {
+		return cfg.MaxChunkBytes
+	}
+	if limiter, ok := t.(ChunkLimiter); ok && limiter.MaxChunkBytes() > 0 {
+		return limiter.MaxChunkBytes()
+	}
+	return defaultMaxChunkBytes
+}
+
+// chunkLengthInSeconds returns how many seconds of wav audio at sampleRate fit
+// in maxBytes.
+func chunkLengthInSeconds(maxBytes int64, sampleRate int) int {
+	seconds := int(maxBytes / int64(sampleRate*wavBytesPerSample))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// splitWavFile is SplitWavFile with chunks of at most maxBytes of audio at
+// sampleRate, but also returns the part of the file each chunk covers.
+func splitWavFile(cfg *config.AppConfig, wavFilePath string, maxBytes int64, sampleRate int) ([]string, []chunkSpan, error) {
 	// http://stackoverflow.com/questions/36632511/split-audio-file-into-several-files-each-below-a-size-threshold
 	// The Stack Overflow answer ultimately calculated the length of each audio chunk in seconds.
 	// chunk_length_in_sec = math.ceil((duration_in_sec * file_split_size ) / wav_file_size)
@@ -105,34 +405,170 @@ func SplitWavFile(wavFilePath string) ([]string, error) {
 	// wav_file_size = (sample_rate * bit_rate * channel_count * duration_in_sec) / 8
 	// sample_rate = 44100, bit_rate = 16, channels_count = 1 (stereo: 2, but Sphinx prefers 1)
 	// As a chunk of the Wav file is extracted using FFMPEG, it is converted back into Flac format.
-	numChunks, err := getNumChunks(wavFilePath)
+	numChunks, err := getNumChunks(wavFilePath, maxBytes)
 	if err != nil {
-		return []string{}, errors.Trace(err)
+		return []string{}, nil, errors.Trace(err)
 	}
 	if numChunks == 1 {
+		return []string{wavFilePath}, []chunkSpan{{Start: 0, End: math.Inf(1)}}, nil
+	}
+
+	duration, err := getAudioDuration(wavFilePath)
+	if err != nil {
+		return []string{}, nil, errors.Trace(err)
+	}
+	// Chunks after the first are longer by the overlap, which has to fit in
+	// maxBytes too.
+	chunkLength := chunkLengthInSeconds(maxBytes, sampleRate) - chunkOverlap(cfg)
+	if chunkLength < 1 {
+		chunkLength = 1
+	}
+	spans := chunkSpans(cfg, duration, chunkLength)
+	names, err := extractSpans(cfg, wavFilePath, spans)
+	if err != nil {
+		return []string{}, nil, errors.Trace(err)
+	}
+	return names, spans, nil
+}
+
+// SplitWavFileByDuration splits a wav file into chunks of chunkSeconds each,
+// regardless of their size. Like SplitWavFile, every chunk after the first
+// overlaps the previous one by config.Config.ChunkOverlapSeconds.
+func SplitWavFileByDuration(wavFilePath string, chunkSeconds int) ([]string, error) {
+	if chunkSeconds <= 0 {
+		return []string{}, errors.NotValidf("chunk length of %d seconds", chunkSeconds)
+	}
+	duration, err := getAudioDuration(wavFilePath)
+	if err != nil {
+		return []string{}, errors.Trace(err)
+	}
+	cfg := config.GetConfig()
+	spans := chunkSpans(&cfg, duration, chunkSeconds)
+	if len(spans) <= 1 {
 		return []string{wavFilePath}, nil
 	}
+	return extractSpans(&cfg, wavFilePath, spans)
+}
 
-	chunkLengthInSeconds := 2968
-	names := make([]string, numChunks)
-	for i := 0; i < numChunks; i++ {
-		startingSecond := i * chunkLengthInSeconds
-		// 5 seconds of redundancy for each chunk after the first
+// ErrAudioTooShort is the cause of the error returned for audio shorter than
+// IBM will transcribe, unless config.Config.PadShortAudio is set.
+var ErrAudioTooShort = errors.New("audio is too short to transcribe")
+
+// ensureMinimumDuration checks that the wav file at wavPath is at least
+// cfg.MinAudioSeconds long (defaultMinAudioSeconds if unset). If
+// cfg.PadShortAudio is set, shorter audio is padded with silence in place
+// instead of being rejected.
+func ensureMinimumDuration(cfg *config.AppConfig, wavPath string) error {
+	minimum := cfg.MinAudioSeconds
+	if minimum <= 0 {
+		minimum = defaultMinAudioSeconds
+	}
+	duration, err := getAudioDuration(wavPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if duration >= minimum {
+		return nil
+	}
+	if !cfg.PadShortAudio {
+		return errors.Annotatef(ErrAudioTooShort, "%.2f seconds is less than the minimum of %.2f", duration, minimum)
+	}
+
+	paddedPath := wavPath + ".padded.wav"
+	os.Remove(paddedPath) // If it already exists, ffmpeg will throw an error
+	if err := runFFmpeg("-i", wavPath, "-af", "apad", "-t", strconv.FormatFloat(minimum, 'f', -1, 64), paddedPath); err != nil {
+		return errors.Trace(err)
+	}
+	if err := restrictTempFile(paddedPath); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(paddedPath, wavPath))
+}
+
+// getAudioDuration returns the duration of an audio file in seconds.
+func getAudioDuration(filePath string) (float64, error) {
+	info, err := ProbeAudio(filePath)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return info.Duration, nil
+}
+
+// chunkOverlap returns how many seconds each chunk after the first starts
+// early for redundancy: cfg.ChunkOverlapSeconds, or
+// defaultChunkOverlapSeconds if unset.
+func chunkOverlap(cfg *config.AppConfig) int {
+	if cfg.ChunkOverlapSeconds <= 0 {
+		return defaultChunkOverlapSeconds
+	}
+	return cfg.ChunkOverlapSeconds
+}
+
+// chunkSpans returns the parts of duration seconds of audio to split it into
+// chunks of chunkLength seconds. The i-th chunk ends at (i+1)*chunkLength,
+// or at the end of the audio for the last one, and every chunk after the
+// first starts chunkOverlap seconds early, so it is longer by as much.
+func chunkSpans(cfg *config.AppConfig, duration float64, chunkLength int) []chunkSpan {
+	numChunks := int(math.Ceil(duration / float64(chunkLength)))
+	if numChunks < 1 {
+		numChunks = 1
+	}
+	overlap := chunkOverlap(cfg)
+	spans := make([]chunkSpan, numChunks)
+	for i := range spans {
+		start := i * chunkLength
+		// redundancy for each chunk after the first
 		if i > 0 {
-			startingSecond -= 5
-		}
-		newFilePath := strconv.Itoa(i) + "_" + wavFilePath
-		if err := extractAudioSegment(wavFilePath, newFilePath, startingSecond, chunkLengthInSeconds); err != nil {
-			return []string{}, errors.Trace(err)
+			start -= overlap
 		}
+		spans[i] = chunkSpan{Start: float64(start), End: float64((i + 1) * chunkLength)}
+	}
+	spans[numChunks-1].End = math.Max(duration, spans[numChunks-1].Start)
+	return spans
+}
+
+// extractSpans writes each of spans of wavFilePath to a chunk of its own and
+// returns their paths in order.
+func extractSpans(cfg *config.AppConfig, wavFilePath string, spans []chunkSpan) ([]string, error) {
+	numChunks := len(spans)
+	names := make([]string, numChunks)
+	errs := make([]error, numChunks)
+
+	// The chunks are independent, so they are extracted concurrently by a
+	// bounded number of ffmpeg processes.
+	workers := cfg.FFmpegWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, span := range spans {
+		newFilePath := filepath.Join(filepath.Dir(wavFilePath), strconv.Itoa(i)+"_"+filepath.Base(wavFilePath))
 		names[i] = newFilePath
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, span chunkSpan) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = extractAudioSegment(wavFilePath, names[i], span.Start, span.End-span.Start)
+		}(i, span)
 	}
+	wg.Wait()
 
+	for _, err := range errs {
+		if err != nil {
+			for _, name := range names {
+				os.Remove(name)
+			}
+			return []string{}, errors.Trace(err)
+		}
+	}
 	return names, nil
 }
 
-// getNumChunks gets file size in MB, divides by 95 MB, and add 1 more chunk in case
-func getNumChunks(filePath string) (int, error) {
+// getNumChunks gets file size in MB, divides by maxBytes, and add 1 more chunk in case
+func getNumChunks(filePath string, maxBytes int64) (int, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return -1, errors.Trace(err)
@@ -144,130 +580,871 @@ func getNumChunks(filePath string) (int, error) {
 		return -1, errors.Trace(err)
 	}
 
-	wavFileSize := int(stat.Size())
-	fileSplitSize := 95000000
+	wavFileSize := stat.Size()
 	// The redundant seconds (5 seconds for every ~50 mintues) won't add own chunk
 	// In case the remainder is almost the file size, add one more chunk
-	numChunks := wavFileSize/fileSplitSize + 1
+	numChunks := int(wavFileSize/maxBytes) + 1
 	return numChunks, nil
 }
 
 // extractAudioSegment uses FFMPEG to write a new audio file starting at a given time of a given length
-func extractAudioSegment(inFilePath string, outFilePath string, ss int, t int) error {
+func extractAudioSegment(inFilePath string, outFilePath string, ss float64, t float64) error {
 	// -ss: starting second, -t: duration in seconds
-	cmd := exec.Command("ffmpeg", "-i", inFilePath, "-ss", strconv.Itoa(ss), "-t", strconv.Itoa(t), outFilePath)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return errors.New(err.Error() + "\nOutput:\n" + string(out))
+	// Placing -ss before -i makes ffmpeg seek in the input instead of decoding
+	// everything up to the starting second.
+	if err := runFFmpeg("-ss", strconv.FormatFloat(ss, 'f', -1, 64), "-i", inFilePath, "-t", strconv.FormatFloat(t, 'f', -1, 64), outFilePath); err != nil {
+		return err
 	}
-	return nil
+	return restrictTempFile(outFilePath)
 }
 
-// MakeIBMTaskFunction returns a task function for transcription using IBM transcription functions.
-// TODO(#52): Quite a lot of the transcription process could be done concurrently.
-func MakeIBMTaskFunction(audioURL string, emailAddresses []string, searchWords []string) (task func(string) error, onFailure func(string, string)) {
-	task = func(id string) error {
-		filePath, err := DownloadFileFromURL(audioURL)
-		if err != nil {
-			return errors.Trace(err)
-		}
-		defer os.Remove(filePath)
+// uploadSourceAudio uploads filePath to the storage configured in cfg, if any,
+// with metadata if the storage supports it, and passes the URL to
+// onAudioReady. A failed upload is logged and only leaves the URL empty.
+func uploadSourceAudio(cfg *config.AppConfig, id string, filePath string, metadata map[string]string, onAudioReady func(string)) string {
+	storage := configuredStorage(cfg)
+	if storage == nil {
+		return ""
+	}
+	var url string
+	var err error
+	if withMetadata, ok := storage.(MetadataStorage); ok && len(metadata) > 0 {
+		url, err = withMetadata.UploadWithMetadata(filePath, metadata)
+	} else {
+		url, err = storage.Upload(filePath)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"task":  id,
+			"error": errors.ErrorStack(err),
+		}).Errorf("Could not upload to %T", storage)
+		return ""
+	}
+	log.WithField("task", id).
+		Debugf("Uploaded %s to %T", filePath, storage)
+	if onAudioReady != nil {
+		onAudioReady(url)
+	}
+	return url
+}
+
+// TranscribeURL downloads, converts, splits and transcribes the audio at url
+// and returns the Transcription. Unlike MakeIBMTaskFunction, it does not upload
+// the audio, write to Mongo or send emails.
+func TranscribeURL(url string, searchWords []string) (*Transcription, error) {
+	filePath, err := DownloadFileFromURL(url)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer os.Remove(filePath)
+
+	cfg := config.GetConfig()
+	transcription, err := transcribeFileCached(context.Background(), &cfg, nil, filepath.Base(filePath), filePath, searchWords, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return transcription, nil
+}
+
+// transcribeFileCached is transcribeFile, but returns the cached transcription
+// of the same audio if there is one, and caches the result if not. Cache
+// failures are logged and otherwise ignored.
+func transcribeFileCached(ctx context.Context, cfg *config.AppConfig, engine Transcriber, id string, filePath string, searchWords []string, onChunk chunkHandler) (*Transcription, error) {
+	cache := configuredCache(cfg)
+	if cache == nil {
+		return transcribeFile(ctx, cfg, engine, id, filePath, searchWords, onChunk)
+	}
 
+	key, err := cacheKey(cfg, engine, filePath, searchWords)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	cached, err := cache.Get(key)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"task":  id,
+			"error": errors.ErrorStack(err),
+		}).Warn("Could not read the transcription cache")
+	} else if cached != nil {
 		log.WithField("task", id).
-			Debugf("Downloaded file at %s to %s", audioURL, filePath)
+			Infof("Using the cached transcription %s", key)
+		// The timings are those of the job that cached it.
+		cached.Durations = nil
+		cached.Elapsed = 0
+		return cached, nil
+	}
+
+	transcription, err := transcribeFile(ctx, cfg, engine, id, filePath, searchWords, onChunk)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := cache.Put(key, transcription); err != nil {
+		log.WithFields(log.Fields{
+			"task":  id,
+			"error": errors.ErrorStack(err),
+		}).Warn("Could not cache the transcription")
+	}
+	return transcription, nil
+}
+
+// convertedChunk is a chunk converted to flac by convertChunks.
+type convertedChunk struct {
+	path string
+	err  error
+}
+
+// convertChunks converts wavPaths to flac in order in the background, one
+// ahead of the consumer of the returned channel, which is closed after the
+// last chunk or the first error. The returned function must be called when
+// the consumer is done; it stops the conversion and removes any converted
+// chunks that were not received.
+func convertChunks(cfg *config.AppConfig, id string, wavPaths []string, sampleRate int) (<-chan convertedChunk, func()) {
+	chunks := make(chan convertedChunk)
+	quit := make(chan struct{})
+	go func() {
+		defer close(chunks)
+		for _, wavPath := range wavPaths {
+			// The audio filters were already applied to the whole file.
+			flacPath, err := convertAudio(cfg, wavPath, "flac", true, sampleRate, nil)
+			if err == nil {
+				log.WithField("task", id).
+					Debugf("Converted file %s to %s", wavPath, flacPath)
+			}
+			select {
+			case chunks <- convertedChunk{flacPath, err}:
+			case <-quit:
+				if err == nil {
+					os.Remove(flacPath)
+				}
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	stop := func() {
+		close(quit)
+		for chunk := range chunks {
+			if chunk.err == nil {
+				os.Remove(chunk.path)
+			}
+		}
+	}
+	return chunks, stop
+}
+
+// chunkHandler is called with the index and result of each chunk as soon as
+// it is transcribed.
+type chunkHandler func(index int, result *IBMResult)
+
+// transcribeChannel converts and splits a local audio or video file and
+// transcribes the chunks, passing each result to onChunk if it is set. The
+// channel is the index of the audio channel to transcribe, or allChannels to
+// mix them all down.
+func transcribeChannel(ctx context.Context, cfg *config.AppConfig, engine Transcriber, id string, filePath string, info *AudioInfo, channel int, searchWords []string, onChunk chunkHandler) (*Transcription, error) {
+	name := "wav"
+	filters := audioFilters(cfg)
+	if channel != allChannels {
+		name = "ch" + strconv.Itoa(channel) + ".wav"
+		filters = append([]string{fmt.Sprintf("pan=mono|c0=c%d", channel)}, filters...)
+	}
+
+	var outputArgs []string
+	if info.HasVideo {
+		// -vn drops the video streams and -map a:0 keeps only the first audio track
+		outputArgs = []string{"-vn", "-map", "a:0"}
+	}
+	// Audio recorded below 16khz, such as telephone calls, is not upsampled
+	// but transcribed with IBM's narrowband model instead.
+	sampleRate, model := ibmAudioSettings(cfg, info)
+	publishJobEvent(id, stageEvent, StageEvent{CONVERT})
+	start := now()
+	wavPath, err := convertAudio(cfg, filePath, name, true, sampleRate, filters, outputArgs...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer os.Remove(wavPath)
+	convertDuration := now().Sub(start)
+
+	log.WithField("task", id).
+		Debugf("Converted file %s to %s", filePath, wavPath)
 
-		wavPath, err := ConvertAudioIntoFormat(filePath, "wav")
+	if err := ensureMinimumDuration(cfg, wavPath); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	publishJobEvent(id, stageEvent, StageEvent{SPLIT})
+	start = now()
+	// Chapters are only split on if each fits in a chunk.
+	var wavPaths []string
+	maxBytes := maxChunkBytes(cfg, engine)
+	spans, ok := chapterSpans(info.Chapters, info.Duration, maxBytes, sampleRate)
+	if cfg.SplitOnChapters && ok {
+		wavPaths, err = extractSpans(cfg, wavPath, spans)
+	} else {
+		wavPaths, spans, err = splitWavFile(cfg, wavPath, maxBytes, sampleRate)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	splitDuration := now().Sub(start)
+	for i := 0; i < len(wavPaths); i++ {
+		defer os.Remove(wavPaths[i])
+	}
+
+	log.WithField("task", id).
+		Debugf("Split file %s into %d file(s)", wavPath, len(wavPaths))
+
+	// Results are either kept in memory or, for very long recordings, spooled
+	// to disk as each chunk completes.
+	ibmResults := []*IBMResult{}
+	var spool *ResultSpool
+	if cfg.SpoolResults {
+		spool, err = NewResultSpool(wavPath + ".results")
 		if err != nil {
-			return errors.Trace(err)
+			return nil, errors.Trace(err)
 		}
-		defer os.Remove(wavPath)
+		defer spool.Remove()
+	}
 
-		log.WithField("task", id).
-			Debugf("Converted file %s to %s", filePath, wavPath)
+	// The next chunk is converted to flac while the current one is being
+	// transcribed.
+	flacChunks, stop := convertChunks(cfg, id, wavPaths, sampleRate)
+	defer stop()
+	windows := chunkWindows(spans)
+	i := 0
+	for chunk := range flacChunks {
+		if chunk.err != nil {
+			return nil, errors.Trace(chunk.err)
+		}
+		defer os.Remove(chunk.path)
+		if err := ctx.Err(); err != nil {
+			return nil, errors.Trace(err)
+		}
 
-		wavPaths, err := SplitWavFile(wavPath)
+		ibmResult, err := transcribeChunkWithFallback(ctx, cfg, engine, id, chunk.path, searchWords, model)
 		if err != nil {
-			return errors.Trace(err)
+			return nil, errors.Trace(err)
+		}
+		if cfg.InterpolateWordTimes {
+			ibmResult = interpolateResultTimes(ibmResult, chunkDuration(spans[i], info.Duration))
 		}
-		for i := 0; i < len(wavPaths); i++ {
-			defer os.Remove(wavPaths[i])
+		// The words are timed from the start of the whole audio rather than
+		// the chunk.
+		ibmResult = alignChunkResult(ibmResult, spans[i].Start, windows[i])
+		if onChunk != nil {
+			onChunk(i, ibmResult)
 		}
+		i++
+		if spool != nil {
+			if err := spool.Append(ibmResult); err != nil {
+				return nil, errors.Trace(err)
+			}
+			continue
+		}
+		ibmResults = append(ibmResults, ibmResult)
+	}
 
+	var transcription *Transcription
+	if spool != nil {
+		transcription, err = spool.transcription(cfg)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	} else {
+		transcription = getTranscription(cfg, ibmResults)
+	}
+	transcription.Durations = map[Stage]time.Duration{CONVERT: convertDuration, SPLIT: splitDuration}
+	if err := transcription.Validate(); err != nil {
 		log.WithField("task", id).
-			Debugf("Split file %s into %d file(s)", filePath, len(wavPaths))
+			Warnf("The transcription is inconsistent: %v", err)
+	}
+	if cfg.RecordChunkBoundaries {
+		transcription.ChunkBoundaries = make([]float64, len(spans))
+		for i, span := range spans {
+			transcription.ChunkBoundaries[i] = span.Start
+		}
+	}
+	return transcription, nil
+}
 
-		ibmResults := []*IBMResult{}
+// chunkDuration returns how many seconds of audio span holds, which for the
+// last chunk is less than its nominal length when the audio, audioDuration
+// seconds long, ends first.
+func chunkDuration(span chunkSpan, audioDuration float64) float64 {
+	end := span.End
+	if end > audioDuration && (audioDuration > 0 || math.IsInf(end, 1)) {
+		end = audioDuration
+	}
+	return math.Max(end-span.Start, 0)
+}
 
-		for _, wavPath := range wavPaths {
-			flacPath, err := ConvertAudioIntoFormat(wavPath, "flac")
-			if err != nil {
-				return errors.Trace(err)
-			}
-			defer os.Remove(flacPath)
+// transcribeChunk transcribes one chunk with engine, or IBM if it is nil.
+// Since the chunk is already on disk, a failed attempt is retried on its own, up to
+// cfg.ChunkRetries times (defaultChunkRetries if unset, none if negative)
+// with exponential backoff, without redoing the rest of the job.
+func transcribeChunk(ctx context.Context, cfg *config.AppConfig, engine Transcriber, id string, flacPath string, searchWords []string, model string) (*IBMResult, error) {
+	retries := cfg.ChunkRetries
+	if retries == 0 {
+		retries = defaultChunkRetries
+	} else if retries < 0 {
+		retries = 0
+	}
 
-			log.WithField("task", id).
-				Debugf("Converted file %s to %s", wavPath, flacPath)
+	delay := chunkRetryDelay
+	for attempt := 0; ; attempt++ {
+		result, err := transcribeChunkOnce(ctx, cfg, engine, id, flacPath, searchWords, model)
+		if err == nil {
+			return result, nil
+		}
+		if attempt == retries || ctx.Err() != nil || errors.Cause(err) == ErrBadIBMCredentials {
+			return nil, errors.Trace(err)
+		}
+		log.WithField("task", id).
+			Warnf("Transcribing %s failed, retrying in %v: %v", flacPath, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, errors.Trace(ctx.Err())
+		}
+		delay *= 2
+	}
+}
 
-			ibmResult, err := TranscribeWithIBM(flacPath, searchWords, config.Config.IBMUsername, config.Config.IBMPassword)
-			if err != nil {
-				return errors.Trace(err)
+// transcribeChunkWithFallback is transcribeChunk, but if cfg.IBMFallbackModel
+// is set and the chunk's average confidence is below cfg.IBMFallbackConfidence
+// (defaultFallbackConfidence if unset), the chunk is transcribed again with the
+// fallback model, such as one for another language, and whichever result is
+// more confident is kept. A failed fallback keeps the first result. Only IBM
+// has models, so chunks transcribed by another engine are not retried.
+func transcribeChunkWithFallback(ctx context.Context, cfg *config.AppConfig, engine Transcriber, id string, flacPath string, searchWords []string, model string) (*IBMResult, error) {
+	result, err := transcribeChunk(ctx, cfg, engine, id, flacPath, searchWords, model)
+	if err != nil || engine != nil || len(cfg.IBMFallbackModel) == 0 || cfg.IBMFallbackModel == model {
+		return result, err
+	}
+	threshold := cfg.IBMFallbackConfidence
+	if threshold <= 0 {
+		threshold = defaultFallbackConfidence
+	}
+	// A chunk without scored words, such as one without speech, would not
+	// be transcribed better by another model.
+	confidence, ok := resultConfidence(cfg, result)
+	if !ok || confidence >= threshold {
+		return result, nil
+	}
+
+	log.WithField("task", id).
+		Infof("Confidence of %s is %.2f, retrying with %s", flacPath, confidence, cfg.IBMFallbackModel)
+	fallback, err := transcribeChunk(ctx, cfg, engine, id, flacPath, searchWords, cfg.IBMFallbackModel)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"task":  id,
+			"error": errors.ErrorStack(err),
+		}).Warnf("Could not transcribe %s with %s", flacPath, cfg.IBMFallbackModel)
+		return result, nil
+	}
+	if fallbackConfidence, ok := resultConfidence(cfg, fallback); ok && fallbackConfidence > confidence {
+		log.WithField("task", id).
+			Infof("Using %s for %s, with confidence %.2f", cfg.IBMFallbackModel, flacPath, fallbackConfidence)
+		return fallback, nil
+	}
+	return result, nil
+}
+
+// transcribeChunkOnce transcribes a chunk with engine, or with the given IBM
+// model using the IBM account in cfg if engine is nil.
+func transcribeChunkOnce(ctx context.Context, cfg *config.AppConfig, engine Transcriber, id string, flacPath string, searchWords []string, model string) (*IBMResult, error) {
+	if engine == nil {
+		return transcribeFileWithIBM(ctx, cfg, id, flacPath, searchWords, model)
+	}
+	transcription, err := engine.Transcribe(id, flacPath, searchWords)
+	if err != nil {
+		return nil, err
+	}
+	return ibmResultFromTranscription(transcription), nil
+}
+
+// transcribeFile converts, splits and transcribes a local audio or video file
+// with engine (IBM if nil), and assembles the chunk results into a single Transcription. If
+// config.Config.AudioChannels splits the channels, each is transcribed
+// separately and the results are merged.
+func transcribeFile(ctx context.Context, cfg *config.AppConfig, engine Transcriber, id string, filePath string, searchWords []string, onChunk chunkHandler) (*Transcription, error) {
+	info, err := ProbeAudio(filePath)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !info.HasAudio {
+		return nil, errors.Errorf("%s has no audio stream", filePath)
+	}
+
+	channels, err := channelPasses(cfg.AudioChannels, info.Channels)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var activity []ChannelActivity
+	if cfg.DetectSilentChannels && info.Channels > 1 {
+		// Detecting silence only saves work, so the channels are all
+		// transcribed if it fails.
+		activity, err = detectChannelActivity(cfg, filePath)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"task":  id,
+				"error": errors.ErrorStack(err),
+			}).Warn("Could not detect silent channels")
+		} else {
+			active := skipSilentChannels(channels, activity)
+			if len(active) != len(channels) || active[0] != channels[0] {
+				log.WithField("task", id).
+					Infof("Transcribing channel(s) %v instead of %v, since the others are silent", active, channels)
 			}
-			ibmResults = append(ibmResults, ibmResult)
+			channels = active
 		}
-		transcription := GetTranscription(ibmResults)
+	}
+	// Chunks are numbered across every channel pass.
+	chunks := 0
+	countChunk := func(_ int, result *IBMResult) {
+		if onChunk != nil {
+			onChunk(chunks, result)
+		}
+		chunks++
+	}
+	passes := make([]*Transcription, len(channels))
+	for i, channel := range channels {
+		passes[i], err = transcribeChannel(ctx, cfg, engine, id, filePath, info, channel, searchWords, countChunk)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
 
-		if len(config.Config.BackblazeAccountID) > 0 {
-			audioURL, err := UploadFileToBackblaze(filePath, config.Config.BackblazeAccountID, config.Config.BackblazeApplicationKey, config.Config.BackblazeBucket)
-			if err != nil {
-				return errors.Trace(err)
+	var transcription *Transcription
+	if len(passes) == 1 {
+		transcription = passes[0]
+	} else {
+		transcription = mergeChannels(cfg, passes)
+		transcription.Durations = make(map[Stage]time.Duration)
+		for _, pass := range passes {
+			for stage, d := range pass.Durations {
+				transcription.Durations[stage] += d
 			}
-			transcription.AudioURL = audioURL
-			log.WithField("task", id).
-				Debugf("Uploaded %s to backblaze", filePath)
 		}
+	}
+	transcription.KeywordMatches = SearchKeywords(transcription, searchWords, KeywordMatchOptions{
+		Stem:        cfg.KeywordStemming,
+		MaxDistance: cfg.KeywordMaxDistance,
+	})
+	if cfg.MinWordConfidence > 0 {
+		transcription.DropLowConfidenceWords(cfg.MinWordConfidence, cfg.LowConfidenceReplacement)
+	}
+	if cfg.NormalizeTranscript {
+		NormalizeTranscript(transcription, DefaultNormalizeOptions)
+	}
+	// The hash covers the transcript as it is delivered.
+	transcription.setHash(cfg)
+	transcription.ChannelActivity = activity
+	transcription.Metadata, err = ExtractMetadata(filePath)
+	if err != nil {
+		log.WithField("task", id).
+			Warnf("Could not read metadata of %s: %v", filePath, err)
+	}
+	if cfg.SplitOnChapters {
+		transcription.Chapters = info.Chapters
+	}
+	if cfg.DetectSilence {
+		transcription.Segments, err = DetectSegments(filePath, defaultSilenceNoiseDB, defaultMinSilenceSeconds)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return transcription, nil
+}
+
+// TaskOptions are the optional settings of MakeIBMTaskFunctionWithOptions.
+type TaskOptions struct {
+	// OnAudioReady is called with the URL of the uploaded source audio as
+	// soon as the upload finishes, which is usually long before the
+	// transcription does.
+	OnAudioReady func(url string)
+	// Transcriber transcribes each chunk instead of IBM, such as a
+	// FakeTranscriber in tests.
+	Transcriber Transcriber
+	// Config holds the accounts and settings of the job, such as the IBM
+	// credentials, storage, mongo URL and notifications, so that jobs for
+	// different tenants can run in one process. The default is config.Config.
+	// Settings of the process, such as ffmpeg's and the temporary files',
+	// always come from config.Config.
+	Config *config.AppConfig
+	// Summarizer sets the Summary of the transcription before it is stored
+	// and emailed. The default is NoopSummarizer.
+	Summarizer Summarizer
+	// Metadata tags the job with attributes of the caller, such as a
+	// customer id, which are stored as the UserMetadata of the transcription
+	// and with the uploaded audio if the storage supports it.
+	Metadata map[string]string
+	// Priority is the name of the priority the task is queued with, as
+	// accepted by tasks.ParsePriority, which is kept with the job if it
+	// fails so that it is retried with the same priority.
+	Priority string
+	// retryOf is the record of the failed job this job retries.
+	retryOf *FailedJob
+}
+
+// appConfig returns opts.Config, or config.Config if it is unset.
+func (opts TaskOptions) appConfig() *config.AppConfig {
+	if opts.Config == nil {
+		cfg := config.GetConfig()
+		return &cfg
+	}
+	return opts.Config
+}
+
+// MakeIBMTaskFunction returns a task function for transcription using IBM transcription functions.
+// TODO(#52): Quite a lot of the transcription process could be done concurrently.
+func MakeIBMTaskFunction(audioURL string, emailAddresses []string, searchWords []string) (task func(string) error, onFailure func(string, string)) {
+	return MakeIBMTaskFunctionWithOptions(audioURL, emailAddresses, searchWords, TaskOptions{})
+}
+
+// MakeIBMTaskFunctionWithOptions is like MakeIBMTaskFunction, but configurable.
+func MakeIBMTaskFunctionWithOptions(audioURL string, emailAddresses []string, searchWords []string, opts TaskOptions) (task func(string) error, onFailure func(string, string)) {
+	job, onFailure := MakeIBMJobFunction(audioURL, emailAddresses, searchWords, opts)
+	task = func(id string) error {
+		_, err := job(id)
+		return err
+	}
+	return task, onFailure
+}
+
+// Stage is a step of a job timed in JobResult.Durations.
+type Stage string
+
+// These are the stages of a job.
+// DOWNLOAD: Downloading the source audio.
+// CONVERT: Converting the audio to wav with ffmpeg.
+// SPLIT: Splitting the wav into chunks small enough for IBM.
+// TRANSCRIBE: Transcribing the chunks, apart from CONVERT and SPLIT.
+// UPLOAD: Uploading the source audio to storage, during TRANSCRIBE.
+// STORE: Writing the transcription to mongo.
+// NOTIFY: Sending the completion notifications.
+const (
+	DOWNLOAD   Stage = "download"
+	CONVERT    Stage = "convert"
+	SPLIT      Stage = "split"
+	TRANSCRIBE Stage = "transcribe"
+	UPLOAD     Stage = "upload"
+	STORE      Stage = "store"
+	NOTIFY     Stage = "notify"
+)
+
+// JobResult is everything a successful job produced.
+type JobResult struct {
+	Transcription *Transcription
+	// AudioURL is where the source audio was uploaded, or empty if it was not.
+	AudioURL  string
+	Durations map[Stage]time.Duration
+	// Files are the paths of the transcript files written, such as the .txt
+	// and .srt in config.Config.OutputDir.
+	Files []string
+}
+
+// MakeIBMJobFunction is like MakeIBMTaskFunctionWithOptions, but the job
+// function returns the JobResult so that callers do not have to read it back
+// from mongo.
+func MakeIBMJobFunction(audioURL string, emailAddresses []string, searchWords []string, opts TaskOptions) (job func(string) (*JobResult, error), onFailure func(string, string)) {
+	job = func(id string) (*JobResult, error) {
+		steps := jobSteps{Upload: true, Store: true, WriteOutput: true, Notify: true}
+		result, err := runJob(id, audioURL, emailAddresses, searchWords, opts, steps)
+		if err == nil && opts.retryOf != nil {
+			removeFailedJob(opts.appConfig(), opts.retryOf.ID)
+		}
+		return result, err
+	}
 
-		if len(config.Config.MongoURL) > 0 {
-			if err := WriteToMongo(transcription, config.Config.MongoURL); err != nil {
-				return errors.Trace(err)
+	onFailure = func(id string, errMessage string) {
+		cfg := opts.appConfig()
+		// The job is recorded so that it can be run again by RetryFailedJobs,
+		// unless it failed because someone cancelled it.
+		if !wasCancelled(id) {
+			recordFailedJob(cfg, newFailedJob(id, audioURL, emailAddresses, searchWords, opts, errMessage))
+		} else if opts.retryOf != nil {
+			removeFailedJob(cfg, opts.retryOf.ID)
+		}
+		notifyAll(configuredNotifiers(cfg, emailAddresses), JobEvent{ID: id, Status: FAILED, Error: errMessage})
+	}
+	return job, onFailure
+}
+
+// jobSteps are the side effects of runJob that can be skipped. Each also
+// needs to be configured, e.g. Store needs a MongoURL.
+type jobSteps struct {
+	Upload      bool
+	Store       bool
+	WriteOutput bool
+	Notify      bool
+	// AllowLocal lets the source be a path on this machine. It is only set
+	// for Transcribe, since the sources of tasks come from clients.
+	AllowLocal bool
+}
+
+// runJob transcribes the audio at source, a URL or a local path, and carries
+// out the given steps with the result. An empty id is replaced by a new one.
+// Its progress is published to the streams of StreamJobEvents.
+func runJob(id string, source string, emailAddresses []string, searchWords []string, opts TaskOptions, steps jobSteps) (*JobResult, error) {
+	if len(id) == 0 {
+		id = GenerateJobID()
+	}
+	result, err := executeJob(id, source, emailAddresses, searchWords, opts, steps)
+	if err != nil {
+		publishJobEvent(id, failedEvent, JobEvent{ID: id, Status: FAILED, Error: err.Error()})
+		return nil, err
+	}
+	publishJobEvent(id, completedEvent, JobEvent{ID: id, Status: COMPLETED, Transcription: result.Transcription})
+	return result, nil
+}
+
+func executeJob(id string, source string, emailAddresses []string, searchWords []string, opts TaskOptions, steps jobSteps) (*JobResult, error) {
+	ctx, done := RegisterJob(id)
+	defer done()
+	if ctx.Err() != nil {
+		return nil, errors.Trace(ErrShuttingDown)
+	}
+	cfg := opts.appConfig()
+	result := &JobResult{Durations: make(map[Stage]time.Duration)}
+	jobStart := now()
+
+	// Every file of the job is kept in a directory only this user can
+	// open, since the audio may be sensitive.
+	jobDir, err := makeJobDir(id)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer os.RemoveAll(jobDir)
+
+	filePath := source
+	if isLocalSource(source) && !steps.AllowLocal {
+		return nil, errors.NotValidf("local source %q", source)
+	}
+	if !isLocalSource(source) {
+		publishJobEvent(id, stageEvent, StageEvent{DOWNLOAD})
+		start := now()
+		filePath, err = downloadFileToDir(source, jobDir)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		result.Durations[DOWNLOAD] = now().Sub(start)
+
+		log.WithField("task", id).
+			Debugf("Downloaded file at %s to %s", source, filePath)
+	}
+
+	// The source audio is uploaded while it is transcribed, so that it can
+	// be played back before the transcript is ready.
+	uploaded := make(chan string, 1)
+	var uploadDuration time.Duration
+	if steps.Upload {
+		publishJobEvent(id, stageEvent, StageEvent{UPLOAD})
+		go func() {
+			start := now()
+			url := uploadSourceAudio(cfg, id, filePath, opts.Metadata, opts.OnAudioReady)
+			uploadDuration = now().Sub(start)
+			uploaded <- url
+		}()
+	} else {
+		uploaded <- ""
+	}
+
+	// Partial results are streamed as each chunk completes, and written to
+	// the job's document for clients that poll mongo.
+	chunkUpdates := steps.Store && len(cfg.MongoURL) > 0 && cfg.MongoChunkUpdates
+	onChunk := func(index int, result *IBMResult) {
+		if !chunkUpdates && !hasJobSubscribers(id) {
+			return
+		}
+		chunk := getTranscription(cfg, []*IBMResult{result})
+		publishJobEvent(id, chunkEvent, ChunkEvent{Index: index, Transcript: chunk.Transcript, Timestamps: chunk.Timestamps})
+		if !chunkUpdates {
+			return
+		}
+		if err := updateTranscriptionChunk(cfg.MongoURL, id, index, chunk.Transcript, chunk.Timestamps); err != nil {
+			log.WithFields(log.Fields{
+				"task":  id,
+				"error": errors.ErrorStack(err),
+			}).Warn("Could not write the chunk to mongo")
+		}
+	}
+
+	publishJobEvent(id, stageEvent, StageEvent{TRANSCRIBE})
+	start := now()
+	transcription, err := transcribeFileCached(ctx, cfg, opts.Transcriber, id, filePath, searchWords, onChunk)
+	transcribeDuration := now().Sub(start)
+	// Wait for the upload to finish before the file is removed.
+	uploadedURL := <-uploaded
+	if steps.Upload {
+		result.Durations[UPLOAD] = uploadDuration
+	}
+	if err != nil {
+		if chunkUpdates {
+			if err := markTranscriptionFailed(cfg.MongoURL, id, err.Error()); err != nil {
+				log.WithFields(log.Fields{
+					"task":  id,
+					"error": errors.ErrorStack(err),
+				}).Warn("Could not mark the partial transcription failed")
 			}
+		}
+		return nil, errors.Trace(err)
+	}
+	for _, stage := range []Stage{CONVERT, SPLIT} {
+		if d, ok := transcription.Durations[stage]; ok {
+			result.Durations[stage] = d
+			transcribeDuration -= d
+		}
+	}
+	result.Durations[TRANSCRIBE] = transcribeDuration
+	// The transcription records the stages up to this point, since it is
+	// stored and emailed before the later ones finish.
+	transcription.Durations = make(map[Stage]time.Duration)
+	for stage, d := range result.Durations {
+		transcription.Durations[stage] = d
+	}
+	transcription.Elapsed = now().Sub(jobStart)
+	log.WithField("task", id).
+		Infof("Transcribed in %v", transcription.Elapsed)
+	transcription.AudioURL = uploadedURL
+	if len(opts.Metadata) > 0 {
+		transcription.UserMetadata = make(map[string]string, len(opts.Metadata))
+		for key, value := range opts.Metadata {
+			transcription.UserMetadata[key] = value
+		}
+	}
+	if chunkUpdates {
+		transcription.ID = id
+	}
+	summarizer := opts.Summarizer
+	if summarizer == nil {
+		summarizer = NoopSummarizer{}
+	}
+	summarize(id, summarizer, transcription)
+	result.Transcription = transcription
+	result.AudioURL = uploadedURL
+
+	if steps.Store && len(cfg.MongoURL) > 0 {
+		publishJobEvent(id, stageEvent, StageEvent{STORE})
+		start = now()
+		// The transcript is still emailed if every write attempt fails.
+		if err := WriteToMongo(transcription, cfg.MongoURL); err != nil {
+			log.WithFields(log.Fields{
+				"task":  id,
+				"error": errors.ErrorStack(err),
+			}).Error("Could not write to mongo")
+		} else {
 			log.WithField("task", id).
 				Debugf("Wrote to mongo")
 		}
+		result.Durations[STORE] = now().Sub(start)
+	}
 
-		if len(config.Config.EmailUsername) > 0 {
-			if err := SendEmail(config.Config.EmailUsername, config.Config.EmailPassword, config.Config.EmailSMTPServer, config.Config.EmailPort, emailAddresses, fmt.Sprintf("IBM Transcription %s Complete", id), "The transcript is below. It can also be found in the database."+"\n\n"+transcription.Transcript); err != nil {
-				return errors.Trace(err)
-			}
+	if steps.WriteOutput && len(cfg.OutputDir) > 0 {
+		paths, err := writeOutputFiles(transcription, cfg.OutputDir, outputName(source, id), cfg.OutputSRT, cfg.OutputVTT)
+		result.Files = paths
+		if err != nil {
+			log.WithFields(log.Fields{
+				"task":  id,
+				"error": errors.ErrorStack(err),
+			}).Error("Could not write output files")
+		} else {
+			log.WithField("task", id).
+				Debugf("Wrote %v", paths)
 		}
+	}
 
-		log.WithField("task", id).
-			Debugf("Sent email to %v", emailAddresses)
+	if steps.Notify {
+		publishJobEvent(id, stageEvent, StageEvent{NOTIFY})
+		start = now()
+		notifyAll(configuredNotifiers(cfg, emailAddresses), JobEvent{ID: id, Status: COMPLETED, Transcription: transcription})
+		result.Durations[NOTIFY] = now().Sub(start)
+	}
+	return result, nil
+}
+
+// isLocalSource reports whether source is a path on this machine rather than
+// a URL.
+func isLocalSource(source string) bool {
+	return !strings.Contains(source, "://") && !strings.HasPrefix(source, "data:")
+}
+
+// archiveBCC returns the standing BCC recipients of completion emails.
+func archiveBCC(cfg *config.AppConfig) []string {
+	if len(cfg.EmailArchiveBCC) == 0 {
 		return nil
 	}
+	return []string{cfg.EmailArchiveBCC}
+}
 
-	onFailure = func(id string, errMessage string) {
-		err := SendEmail(config.Config.EmailUsername, config.Config.EmailPassword, "smtp.gmail.com", 587, emailAddresses, fmt.Sprintf("IBM Transcription %s Failed", id), errMessage)
+// CheckURLAvailable sends HEAD requests to url until one succeeds, making at
+// most attempts requests spaced delay apart.
+func CheckURLAvailable(url string, attempts int, delay time.Duration) error {
+	client, err := downloadClient(10 * time.Second)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+		}
+		var response *http.Response
+		response, err = client.Head(url)
 		if err != nil {
-			log.WithField("task", id).
-				Debugf("Could not send error email to %v because of the error %v", emailAddresses, err.Error())
-			return
+			continue
 		}
-		log.WithField("task", id).
-			Debugf("Sent email to %v", emailAddresses)
+		response.Body.Close()
+		if response.StatusCode < 400 {
+			return nil
+		}
+		err = errors.Errorf("HEAD %s returned %s", url, response.Status)
 	}
-	return task, onFailure
+	return errors.Trace(err)
 }
 
-// UploadFileToBackblaze uploads the given gile to the given backblaze bucket
+// audioURLNote describes where the uploaded audio can be found. If
+// cfg.CheckAudioURL is set and the URL cannot be reached yet, the note warns
+// that the link may not work for a few minutes.
+func audioURLNote(cfg *config.AppConfig, url string) string {
+	note := "The audio can be found at " + url
+	if cfg.CheckAudioURL {
+		if err := CheckURLAvailable(url, 3, 2*time.Second); err != nil {
+			log.Debugf("Audio URL is not available yet: %v", err)
+			note += " (the file is still being made available, so the link may not work for a few minutes)"
+		}
+	}
+	return note
+}
+
+// UploadFileToBackblaze uploads the given gile to the given backblaze bucket,
+// named after its content; see backblazeFileName. Files larger than
+// config.Config.BackblazeLargeFileThreshold are uploaded in parts, which are
+// retried individually and resumed after an interruption.
 func UploadFileToBackblaze(filePath string, accountID string, applicationKey string, bucketName string) (string, error) {
-	b2, err := backblaze.NewB2(backblaze.Credentials{
-		AccountID:      accountID,
-		ApplicationKey: applicationKey,
-	})
+	return UploadFileToBackblazeWithMetadata(filePath, accountID, applicationKey, bucketName, nil)
+}
+
+// UploadFileToBackblazeWithMetadata is UploadFileToBackblaze, storing
+// metadata as the file info of the file. B2 allows at most 10 entries.
+func UploadFileToBackblazeWithMetadata(filePath string, accountID string, applicationKey string, bucketName string, metadata map[string]string) (string, error) {
+	cfg := config.GetConfig()
+	return uploadFileToBackblaze(&cfg, filePath, accountID, applicationKey, bucketName, metadata)
+}
+
+// uploadFileToBackblaze is UploadFileToBackblazeWithMetadata with the bucket
+// and large file settings of cfg.
+func uploadFileToBackblaze(cfg *config.AppConfig, filePath string, accountID string, applicationKey string, bucketName string, metadata map[string]string) (string, error) {
+	session, err := authorizeB2(accountID, applicationKey)
 	if err != nil {
 		return "", errors.Trace(err)
 	}
 
-	bucket, err := b2.Bucket(bucketName)
+	bucket, err := session.findOrCreateBucket(cfg, bucketName)
 	if err != nil {
 		return "", errors.Trace(err)
 	}
@@ -276,37 +1453,93 @@ func UploadFileToBackblaze(filePath string, accountID string, applicationKey str
 	if err != nil {
 		return "", errors.Trace(err)
 	}
-
-	name := filepath.Base(filePath)
-	metadata := make(map[string]string) // empty metadata
-
-	_, err = bucket.UploadFile(name, metadata, file)
+	defer file.Close()
+	stat, err := file.Stat()
 	if err != nil {
 		return "", errors.Trace(err)
 	}
 
-	url, err := bucket.FileURL(name)
+	name, err := backblazeFileName(file, filePath)
 	if err != nil {
 		return "", errors.Trace(err)
 	}
-	return url, nil
-}
-
-type mgoLogger struct{}
-
-func (mgoLogger) Output(_ int, s string) error {
-	log.Debug(s)
-	return nil
+	if stat.Size() > backblazeLargeFileThreshold(cfg) {
+		err = session.uploadLargeFile(file, stat.Size(), name, bucket.ID, metadata)
+	} else {
+		err = session.uploadFile(file, stat.Size(), name, bucket.ID, metadata)
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return session.fileURL(bucketName, name), nil
 }
 
 // Transcription contains the full transcription and other information.
 type Transcription struct {
+	// ID is the id of the job when its document is written chunk by chunk,
+	// and otherwise empty, in which case mongo assigns one.
+	ID          string `json:",omitempty" bson:"_id,omitempty"`
 	Transcript  string
 	AudioURL    string
 	CompletedAt time.Time
 	Timestamps  []timestamp
 	Confidences []confidence
-	Keywords    []ibmKeywordResult
+	// CueStarts are the indices in Timestamps of the first word of each
+	// subtitle cue, when the words came from subtitles such as those read by
+	// ParseSRT. ExportSRT and ExportVTT keep these cues instead of grouping
+	// the words themselves, so that hand-made cues survive a round trip.
+	// Dropping words clears them.
+	CueStarts []int `json:",omitempty" bson:",omitempty"`
+	// Hash is the SHA-256 of the transcript and timestamps when they were
+	// generated, if config.Config.HashTranscriptions is set; see
+	// VerifyTranscriptionHash.
+	Hash string `json:",omitempty" bson:",omitempty"`
+	// ApproximateTimestamps is set when some of the Timestamps were
+	// interpolated from the times of whole phrases, because
+	// config.Config.InterpolateWordTimes is set and the engine did not time
+	// every word.
+	ApproximateTimestamps bool `json:",omitempty" bson:",omitempty"`
+	// OverallConfidence is the AverageConfidence of the words, or 0 if no
+	// word has a confidence score.
+	OverallConfidence float64
+	// IBMKeywords are the keywords spotted by IBM; see Keywords. They keep
+	// their original name when stored.
+	IBMKeywords []ibmKeywordResult `json:"Keywords" bson:"keywords"`
+	// KeywordMatches are the search words found by SearchKeywords.
+	KeywordMatches []KeywordMatch
+	// Empty is set when no speech was detected in the audio.
+	Empty bool
+	// Segments mark which spans of the audio contain speech. They are only
+	// detected when config.Config.DetectSilence is set.
+	Segments []Segment
+	// Chapters are the chapters marked in the audio, such as those of an
+	// audiobook. They are only kept when config.Config.SplitOnChapters is
+	// set, in which case each chapter is transcribed as a chunk of its own
+	// if every chapter fits in a chunk. Otherwise the audio is split by size.
+	Chapters []Chapter `json:",omitempty" bson:",omitempty"`
+	// Metadata holds the tags of the source file, such as its title.
+	Metadata map[string]string
+	// UserMetadata holds the attributes the job was tagged with through
+	// TaskOptions.Metadata, such as a customer id, so that transcriptions can
+	// be queried by them.
+	UserMetadata map[string]string `json:",omitempty" bson:",omitempty"`
+	// Summary is a short summary of the transcript written by the job's
+	// Summarizer, if any.
+	Summary string
+	// ChunkBoundaries are the seconds at which each chunk transcribed
+	// separately started. They are only recorded when
+	// config.Config.RecordChunkBoundaries is set.
+	ChunkBoundaries []float64
+	// Channels holds the transcription of each audio channel when they are
+	// transcribed separately.
+	Channels []*Transcription
+	// ChannelActivity is how loud each channel of the source audio is. It
+	// is only measured when config.Config.DetectSilentChannels is set.
+	ChannelActivity []ChannelActivity
+	// Durations are how long each stage of the job took, up to UPLOAD.
+	Durations map[Stage]time.Duration
+	// Elapsed is how long the job took to download and transcribe the audio.
+	Elapsed time.Duration
 }
 
 type timestamp struct {
@@ -319,25 +1552,3 @@ type confidence struct {
 	Word  string
 	Score float64
 }
-
-// WriteToMongo takes a string and writes it to the database
-func WriteToMongo(data *Transcription, url string) error {
-	mgo.SetLogger(mgoLogger{})
-	session, err := mgo.Dial(url)
-	if err != nil {
-		return err
-	}
-	defer session.Close()
-
-	session.SetMode(mgo.Monotonic, true)
-
-	c := session.DB("database").C("transcriptions")
-
-	// Insert data
-	err = c.Insert(&data)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
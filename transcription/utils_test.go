@@ -0,0 +1,236 @@
+package transcription
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// freezeTime sets the package clock to t and returns a function restoring it.
+func freezeTime(t time.Time) func() {
+	now = func() time.Time { return t }
+	return func() { now = time.Now }
+}
+
+func TestFilePathFromURLUsesClock(t *testing.T) {
+	assert := assert.New(t)
+	defer freezeTime(time.Unix(0, 42))()
+
+	filePath := filePathFromURL("http://hack4impact.org/audio.mp3?token=abc")
+	assert.Equal("audio_42.mp3", filePath)
+}
+
+func TestFilePathFromURLNormalizesExtension(t *testing.T) {
+	assert := assert.New(t)
+	defer freezeTime(time.Unix(0, 42))()
+
+	assert.Equal("episode.12_42.mp3", filePathFromURL("http://hack4impact.org/episode.12.MP3#t=10"))
+	assert.Equal("stream_42", filePathFromURL("http://hack4impact.org/stream"))
+	assert.Equal("audio_42", filePathFromURL("http://hack4impact.org/"))
+}
+
+func TestGetTranscriptionUsesClock(t *testing.T) {
+	assert := assert.New(t)
+	frozen := time.Date(2016, 6, 1, 12, 0, 0, 0, time.UTC)
+	defer freezeTime(frozen)()
+
+	transcription := GetTranscription([]*IBMResult{})
+	assert.Equal(frozen, transcription.CompletedAt)
+}
+
+func TestGetTranscriptionWithoutSpeechIsEmpty(t *testing.T) {
+	assert := assert.New(t)
+
+	result := &IBMResult{Results: []ibmResultField{{}}}
+	transcription := GetTranscription([]*IBMResult{result})
+	assert.True(transcription.Empty)
+	assert.Equal("", transcription.Transcript)
+}
+
+func TestDecodeDataURI(t *testing.T) {
+	assert := assert.New(t)
+	defer freezeTime(time.Unix(0, 7))()
+
+	filePath, err := DownloadFileFromURL("data:audio/wav;base64,UklGRg==")
+	assert.NoError(err)
+	defer os.Remove(filePath)
+
+	assert.Equal("inline7", filePath)
+	contents, _ := ioutil.ReadFile(filePath)
+	assert.Equal("RIFF", string(contents))
+}
+
+func TestDecodeDataURIRejectsOtherTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := DownloadFileFromURL("data:text/plain;base64,UklGRg==")
+	assert.Error(err)
+}
+
+func TestDownloadFileFromURLDetectsTruncation(t *testing.T) {
+	assert := assert.New(t)
+	defer freezeTime(time.Unix(0, 7))()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("only ten b"))
+	}))
+	defer server.Close()
+
+	_, err := DownloadFileFromURL(server.URL + "/audio.wav")
+	assert.Error(err)
+	_, statErr := os.Stat("audio_7.wav")
+	assert.True(os.IsNotExist(statErr))
+}
+
+func TestFFmpegInputArgs(t *testing.T) {
+	cfg := &config.AppConfig{FFmpegInputOptions: []string{"-analyzeduration", "100M"}}
+	assert.Equal(t, []string{"-analyzeduration", "100M", "-i", "in.mp3"}, ffmpegInputArgs(cfg, "in.mp3"))
+}
+
+func TestAudioFilterArgs(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &config.AppConfig{}
+	assert.Empty(filterArgs(audioFilters(cfg)))
+
+	cfg.NormalizeAudio = true
+	assert.Equal([]string{"-af", "loudnorm"}, filterArgs(audioFilters(cfg)))
+
+	cfg.Denoise = true
+	assert.Equal([]string{"-af", defaultDenoiseFilter + ",loudnorm"}, filterArgs(audioFilters(cfg)))
+
+	cfg.DenoiseFilter = "arnndn=m=hum.rnnn"
+	assert.Equal([]string{"-af", "arnndn=m=hum.rnnn,loudnorm"}, filterArgs(audioFilters(cfg)))
+}
+
+func TestSanitizeText(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("caf\ufffd ok\tfine", sanitizeText("caf\xe9 o\x00k\tfine"))
+	assert.Equal("naïve", sanitizeText("naïve"))
+
+	assert.Equal("ok", newTranscriptionBuilder(&config.AppConfig{}).sanitize("o\x00k"))
+	assert.Equal("o\x00k", newTranscriptionBuilder(&config.AppConfig{RawTranscript: true}).sanitize("o\x00k"))
+
+	b := newTranscriptionBuilder(&config.AppConfig{})
+	b.add(&IBMResult{Results: []ibmResultField{{
+		Alternatives: []ibmAlternativesField{{Transcript: "caf\xe9 "}},
+		KeywordMap:   map[string][]ibmKeywordResult{"cafe": {{"caf\xe9\x00", 0, 1, 0.9}}},
+	}}})
+	assert.Equal([]ibmKeywordResult{{"caf\ufffd", 0, 1, 0.9}}, b.build().IBMKeywords)
+}
+
+func TestChunkSpans(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &config.AppConfig{}
+	assert.Equal([]chunkSpan{{0, 100}, {95, 200}, {195, 250}}, chunkSpans(cfg, 250, 100))
+	// The end of audio that is a multiple of the chunk length is not lost to
+	// the overlap.
+	assert.Equal([]chunkSpan{{0, 600}, {595, 1200}}, chunkSpans(cfg, 1200, 600))
+	assert.Equal([]chunkSpan{{0, 600}, {595, 1198}}, chunkSpans(cfg, 1198, 600))
+	assert.Equal([]chunkSpan{{0, 100}, {90, 150}}, chunkSpans(&config.AppConfig{ChunkOverlapSeconds: 10}, 150, 100))
+	assert.Equal([]chunkSpan{{0, 50}}, chunkSpans(cfg, 50, 100))
+}
+
+func TestChunkDuration(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(100.0, chunkDuration(chunkSpan{0, 100}, 250))
+	// The last chunk ends with the audio.
+	assert.Equal(55.0, chunkDuration(chunkSpan{195, 300}, 250))
+	assert.Equal(250.0, chunkDuration(chunkSpan{0, math.Inf(1)}, 250))
+	// Without a duration, only an unbounded span is clamped.
+	assert.Equal(100.0, chunkDuration(chunkSpan{0, 100}, 0))
+	assert.Equal(0.0, chunkDuration(chunkSpan{0, math.Inf(1)}, 0))
+}
+
+func TestMaxChunkBytes(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &config.AppConfig{}
+	assert.Equal(int64(95000000), maxChunkBytes(cfg, IBMTranscriber{}))
+	assert.Equal(int64(95000000), maxChunkBytes(cfg, stubTranscriber{}))
+	assert.Equal(2968, chunkLengthInSeconds(maxChunkBytes(cfg, IBMTranscriber{}), wideSampleRate))
+
+	cfg.MaxChunkBytes = 10 * 1000 * 1000
+	assert.Equal(int64(10000000), maxChunkBytes(cfg, IBMTranscriber{}))
+	assert.Equal(312, chunkLengthInSeconds(cfg.MaxChunkBytes, wideSampleRate))
+	assert.Equal(625, chunkLengthInSeconds(cfg.MaxChunkBytes, narrowSampleRate))
+	assert.Equal(1, chunkLengthInSeconds(100, wideSampleRate))
+}
+
+func TestIBMAudioSettings(t *testing.T) {
+	assert := assert.New(t)
+	rate, model := ibmAudioSettings(&config.AppConfig{}, &AudioInfo{SampleRate: 8000})
+	assert.Equal(8000, rate)
+	assert.Equal("en-US_NarrowbandModel", model)
+	rate, model = ibmAudioSettings(&config.AppConfig{}, &AudioInfo{SampleRate: 11025})
+	assert.Equal(8000, rate)
+	assert.Equal("en-US_NarrowbandModel", model)
+	rate, model = ibmAudioSettings(&config.AppConfig{}, &AudioInfo{SampleRate: 44100})
+	assert.Equal(16000, rate)
+	assert.Equal("en-US_BroadbandModel", model)
+	// Unknown rates are treated as broadband.
+	rate, model = ibmAudioSettings(&config.AppConfig{}, &AudioInfo{})
+	assert.Equal(16000, rate)
+	assert.Equal("en-US_BroadbandModel", model)
+
+	cfg := &config.AppConfig{IBMModel: "es-ES_BroadbandModel", IBMNarrowbandModel: "es-ES_NarrowbandModel"}
+	_, model = ibmAudioSettings(cfg, &AudioInfo{SampleRate: 44100})
+	assert.Equal("es-ES_BroadbandModel", model)
+	_, model = ibmAudioSettings(cfg, &AudioInfo{SampleRate: 8000})
+	assert.Equal("es-ES_NarrowbandModel", model)
+}
+
+func TestIBMRecognizeParams(t *testing.T) {
+	assert := assert.New(t)
+	query, args, err := ibmRecognizeParams(map[string]string{
+		"customization_id": "abc",
+		"audio_metrics":    "true",
+		"max_alternatives": "3",
+		"smart_formatting": "false",
+		"end_of_phrase":    "1.5s",
+	})
+	assert.NoError(err)
+	assert.Equal("customization_id=abc", query.Encode())
+	assert.Equal(map[string]interface{}{
+		"audio_metrics":    true,
+		"max_alternatives": 3.0,
+		"smart_formatting": false,
+		"end_of_phrase":    "1.5s",
+	}, args)
+
+	_, _, err = ibmRecognizeParams(map[string]string{"Bad Key": "x"})
+	assert.Error(err)
+	_, _, err = ibmRecognizeParams(map[string]string{"action": "stop"})
+	assert.Error(err)
+}
+
+func TestIBMInactivityTimeout(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(-1, ibmInactivityTimeout(&config.AppConfig{}))
+	cfg := &config.AppConfig{IBMInactivityTimeout: config.Duration{Duration: 90500 * time.Millisecond}}
+	assert.Equal(91, ibmInactivityTimeout(cfg))
+}
+
+func TestConvertAudioIntoFormatKeepsExistingOutput(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "convert")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	source := dir + "/talk.mp3"
+	target := source + ".wav"
+	assert.NoError(ioutil.WriteFile(target, []byte("keep me"), 0644))
+
+	_, err = ConvertAudioIntoFormat(source, "wav")
+	assert.Equal(ErrOutputExists, errors.Cause(err))
+	_, err = ExtractAudioFromVideo(source, "wav")
+	assert.Equal(ErrOutputExists, errors.Cause(err))
+	content, _ := ioutil.ReadFile(target)
+	assert.Equal("keep me", string(content))
+}
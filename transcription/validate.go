@@ -0,0 +1,42 @@
+package transcription
+
+import (
+	"github.com/juju/errors"
+)
+
+// Validate checks that the timing and confidence information of t is
+// consistent: every word ends after it starts, words are in order, and there
+// is a confidence between 0 and 1 for each word, in the same order. It
+// returns an error describing the first problem found.
+func (t *Transcription) Validate() error {
+	for i, word := range t.Timestamps {
+		if word.StartTime < 0 {
+			return errors.NotValidf("word %d (%q) starting at %v", i, word.Word, word.StartTime)
+		}
+		if word.EndTime < word.StartTime {
+			return errors.NotValidf("word %d (%q) ending at %v before it starts at %v", i, word.Word, word.EndTime, word.StartTime)
+		}
+		if i > 0 && word.StartTime < t.Timestamps[i-1].StartTime {
+			return errors.NotValidf("word %d (%q) starting at %v before the previous word at %v", i, word.Word, word.StartTime, t.Timestamps[i-1].StartTime)
+		}
+	}
+
+	if len(t.Confidences) != len(t.Timestamps) {
+		return errors.NotValidf("%d confidences for %d words", len(t.Confidences), len(t.Timestamps))
+	}
+	for i, c := range t.Confidences {
+		if c.Word != t.Timestamps[i].Word {
+			return errors.NotValidf("confidence %d for %q instead of %q", i, c.Word, t.Timestamps[i].Word)
+		}
+		if c.Score < 0 || c.Score > 1 {
+			return errors.NotValidf("confidence %d (%q) of %v", i, c.Word, c.Score)
+		}
+	}
+
+	for _, keyword := range t.IBMKeywords {
+		if keyword.EndTime < keyword.StartTime {
+			return errors.NotValidf("keyword %q ending at %v before it starts at %v", keyword.Word, keyword.EndTime, keyword.StartTime)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package transcription
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+	valid := func() *Transcription {
+		return &Transcription{
+			Timestamps:  []timestamp{{"hello", 0, 0.5}, {"world", 0.5, 1}},
+			Confidences: []confidence{{"hello", 0.9}, {"world", 0.8}},
+		}
+	}
+	assert.NoError(valid().Validate())
+	assert.NoError((&Transcription{}).Validate())
+
+	transcription := valid()
+	transcription.Timestamps[1].EndTime = 0.2
+	assert.EqualError(transcription.Validate(), `word 1 ("world") ending at 0.2 before it starts at 0.5 not valid`)
+
+	transcription = valid()
+	transcription.Timestamps[0].StartTime = 0.7
+	transcription.Timestamps[0].EndTime = 0.8
+	assert.EqualError(transcription.Validate(), `word 1 ("world") starting at 0.5 before the previous word at 0.7 not valid`)
+
+	transcription = valid()
+	transcription.Confidences = transcription.Confidences[:1]
+	assert.EqualError(transcription.Validate(), "1 confidences for 2 words not valid")
+
+	transcription = valid()
+	transcription.Confidences[1].Score = 1.5
+	assert.EqualError(transcription.Validate(), `confidence 1 ("world") of 1.5 not valid`)
+}
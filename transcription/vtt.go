@@ -0,0 +1,140 @@
+package transcription
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+
+	"github.com/dzhang55/go-torch/config"
+)
+
+// defaultLowConfidenceThreshold is the confidence below which ExportRichVTT
+// styles a word as uncertain when config.Config.LowConfidenceThreshold is
+// unset.
+const defaultLowConfidenceThreshold = 0.5
+
+// richVTTStyle is the style block of ExportRichVTT, which greys out the words
+// in the low class.
+const richVTTStyle = "STYLE\n::cue(.low) {\n  color: gray;\n  font-style: italic;\n}\n\n"
+
+// noSpeaker is the speaker of words from a transcription that was not split
+// into channels.
+const noSpeaker = -1
+
+// richWord is a timestamped word with its speaker and confidence, either of
+// which may be unknown.
+type richWord struct {
+	timestamp
+	speaker int
+	// score is 0 if the word has no confidence score.
+	score float64
+}
+
+// ExportRichVTT writes t to w as WebVTT subtitles for players that support
+// voice spans and cue styling. When the channels were transcribed
+// separately, each cue holds the words of one speaker, one per channel, and
+// starts with a <v Speaker N> span. Words whose confidence is below
+// config.Config.LowConfidenceThreshold are wrapped in a <c.low> span, which is
+// styled in the header. Either is left out when the transcription lacks the
+// data, so that the result is then the same as ExportVTT.
+func ExportRichVTT(t *Transcription, w io.Writer) error {
+	threshold := config.GetConfig().LowConfidenceThreshold
+	if threshold <= 0 {
+		threshold = defaultLowConfidenceThreshold
+	}
+	words, scored := richWords(t)
+
+	var buffer bytes.Buffer
+	buffer.WriteString("WEBVTT\n\n")
+	if scored {
+		buffer.WriteString(richVTTStyle)
+	}
+	for _, cue := range groupRichCues(words) {
+		fmt.Fprintf(&buffer, "%s --> %s\n", formatVTTTime(cue[0].StartTime), formatVTTTime(cue[len(cue)-1].EndTime))
+		if cue[0].speaker != noSpeaker {
+			fmt.Fprintf(&buffer, "<v Speaker %d>", cue[0].speaker+1)
+		}
+		low := false
+		for i, word := range cue {
+			isLow := word.score > 0 && word.score < threshold
+			if low && !isLow {
+				buffer.WriteString("</c>")
+			}
+			if i > 0 {
+				buffer.WriteString(" ")
+			}
+			if isLow && !low {
+				buffer.WriteString("<c.low>")
+			}
+			buffer.WriteString(vttEscape(word.Word))
+			low = isLow
+		}
+		if low {
+			buffer.WriteString("</c>")
+		}
+		buffer.WriteString("\n\n")
+	}
+
+	_, err := buffer.WriteTo(w)
+	return errors.Trace(err)
+}
+
+// richWords returns the words of t in order of time with their speakers and
+// confidence scores, and whether any word has a score. Confidences are only
+// used when there is one for every timestamp.
+func richWords(t *Transcription) ([]richWord, bool) {
+	words := []richWord{}
+	scored := false
+	add := func(transcription *Transcription, speaker int) {
+		withScores := len(transcription.Confidences) == len(transcription.Timestamps)
+		for i, ts := range transcription.Timestamps {
+			word := richWord{timestamp: ts, speaker: speaker}
+			if withScores {
+				word.score = transcription.Confidences[i].Score
+				scored = scored || word.score > 0
+			}
+			words = append(words, word)
+		}
+	}
+
+	if len(t.Channels) > 1 {
+		for i, channel := range t.Channels {
+			add(channel, i)
+		}
+		sort.SliceStable(words, func(i, j int) bool {
+			return words[i].StartTime < words[j].StartTime
+		})
+	} else {
+		add(t, noSpeaker)
+	}
+	return words, scored
+}
+
+// groupRichCues splits words into cues like groupCues, and also when the
+// speaker changes.
+func groupRichCues(words []richWord) [][]richWord {
+	cues := [][]richWord{}
+	var cue []richWord
+	for i, word := range words {
+		if len(cue) > 0 && (len(cue) == maxCueWords ||
+			word.StartTime-words[i-1].EndTime >= cuePauseSeconds ||
+			word.speaker != cue[0].speaker) {
+			cues = append(cues, cue)
+			cue = nil
+		}
+		cue = append(cue, word)
+	}
+	if len(cue) > 0 {
+		cues = append(cues, cue)
+	}
+	return cues
+}
+
+// vttEscape escapes the characters of s that have a meaning in cue text.
+func vttEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,42 @@
+package transcription
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportRichVTT(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{
+		Channels: []*Transcription{
+			{
+				Timestamps:  []timestamp{{"hello", 0, 0.5}, {"there", 0.5, 1}},
+				Confidences: []confidence{{"hello", 0.9}, {"there", 0.3}},
+			},
+			{
+				Timestamps:  []timestamp{{"a<b", 1.2, 1.5}, {"hi", 1.5, 2}},
+				Confidences: []confidence{{"a<b", 0.2}, {"hi", 0.8}},
+			},
+		},
+	}
+
+	var buffer bytes.Buffer
+	assert.NoError(ExportRichVTT(transcription, &buffer))
+	assert.Equal("WEBVTT\n\n"+richVTTStyle+
+		"00:00:00.000 --> 00:00:01.000\n<v Speaker 1>hello <c.low>there</c>\n\n"+
+		"00:00:01.200 --> 00:00:02.000\n<v Speaker 2><c.low>a&lt;b</c> hi\n\n", buffer.String())
+}
+
+func TestExportRichVTTWithoutSpeakersOrConfidence(t *testing.T) {
+	assert := assert.New(t)
+	transcription := &Transcription{
+		Timestamps: []timestamp{{"hello", 0, 0.5}, {"world", 0.5, 1}},
+	}
+
+	var rich, plain bytes.Buffer
+	assert.NoError(ExportRichVTT(transcription, &rich))
+	assert.NoError(ExportVTT(transcription, &plain))
+	assert.Equal(plain.String(), rich.String())
+}
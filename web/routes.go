@@ -5,15 +5,16 @@ import (
 	"encoding/json"
 	"html/template"
 	"io"
-	"net/http"
 	"math/rand"
+	"net/http"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/gorilla/mux"
-	"github.com/gorilla/sessions"
 	"github.com/dzhang55/go-torch/config"
 	"github.com/dzhang55/go-torch/tasks"
 	"github.com/dzhang55/go-torch/transcription"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	"github.com/juju/errors"
 )
 
 type route struct {
@@ -27,6 +28,8 @@ type transcriptionJobData struct {
 	AudioURL       string   `json:"audioURL"`
 	EmailAddresses []string `json:"emailAddresses"`
 	SearchWords    []string `json:"searchWords"`
+	// Priority is "low", "normal" or "high"; see tasks.ParsePriority.
+	Priority string `json:"priority"`
 }
 
 type flash struct {
@@ -59,6 +62,24 @@ var routes = []route{
 		"/job_status/{id}",
 		jobStatusHandler,
 	},
+	route{
+		"cancel_job",
+		"POST",
+		"/cancel_job/{id}",
+		cancelJobHandler,
+	},
+	route{
+		"retry_failed_jobs",
+		"POST",
+		"/retry_failed_jobs",
+		retryFailedJobsHandler,
+	},
+	route{
+		"job_events",
+		"GET",
+		"/job_events/{id}",
+		jobEventsHandler,
+	},
 	route{
 		"form",
 		"GET",
@@ -68,7 +89,7 @@ var routes = []route{
 }
 
 var (
-	store        = sessions.NewCookieStore([]byte(config.Config.SecretKey))
+	store        = sessions.NewCookieStore([]byte(config.GetConfig().SecretKey))
 	flashSession = "flash"
 )
 
@@ -88,8 +109,21 @@ func initiateImageJobHandlerJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	priority, err := tasks.ParsePriority(jsonData.Priority)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if transcription.ShuttingDown() {
+		http.Error(w, transcription.ErrShuttingDown.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
 	executer := tasks.DefaultTaskExecuter
-	executer.QueueTask(transcription.MakeIBMTaskFunction(jsonData.AudioURL, jsonData.EmailAddresses, jsonData.SearchWords))
+	opts := transcription.TaskOptions{Priority: jsonData.Priority}
+	task, onFailure := transcription.MakeIBMTaskFunctionWithOptions(jsonData.AudioURL, jsonData.EmailAddresses, jsonData.SearchWords, opts)
+	executer.QueueTaskWithPriority(task, onFailure, priority)
 }
 
 // initiateImageJobHandler takes a POST request from a form,
@@ -140,6 +174,49 @@ func jobStatusHandler(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, status.String())
 }
 
+// cancelJobHandler cancels the running task with given id.
+func cancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	args := mux.Vars(r)
+	id := args["id"]
+
+	if !transcription.CancelJob(id) {
+		http.Error(w, tasks.NOTFOUND.String(), http.StatusNotFound)
+		return
+	}
+	io.WriteString(w, "The task is being cancelled.")
+}
+
+// retryFailedJobsHandler queues the failed transcription jobs again with the
+// priority they were queued with, and reports how many were retried and how
+// many were dead-lettered instead; see transcription.RetryFailedJobs.
+func retryFailedJobsHandler(w http.ResponseWriter, r *http.Request) {
+	retried, deadLettered, err := transcription.RetryFailedJobs(func(task func(string) error, onFailure func(string, string), priority string) string {
+		// An invalid priority was rejected when the job was queued.
+		p, _ := tasks.ParsePriority(priority)
+		return tasks.DefaultTaskExecuter.QueueTaskWithPriority(task, onFailure, p)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int{"retried": retried, "deadLettered": deadLettered})
+}
+
+// jobEventsHandler streams the progress and partial results of the running
+// task with given id as server-sent events until it finishes.
+func jobEventsHandler(w http.ResponseWriter, r *http.Request) {
+	args := mux.Vars(r)
+	id := args["id"]
+
+	err := transcription.StreamJobEventsContext(r.Context(), id, w)
+	if errors.IsNotFound(err) {
+		http.Error(w, tasks.NOTFOUND.String(), http.StatusNotFound)
+	} else if err != nil {
+		log.WithField("task", id).
+			Debugf("Stopped streaming events: %v", err)
+	}
+}
+
 func formHandler(w http.ResponseWriter, r *http.Request) {
 	t, err := template.ParseFiles("templates/form.html")
 	if err != nil {